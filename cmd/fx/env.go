@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nitwhiz/fxscript/fx"
+)
+
+// memoryEnv keeps the script memory in a map and collects runtime errors.
+type memoryEnv struct {
+	memory map[fx.Identifier]int
+	errs   fx.ErrorList
+}
+
+func newMemoryEnv() *memoryEnv {
+	return &memoryEnv{
+		memory: make(map[fx.Identifier]int),
+	}
+}
+
+func (e *memoryEnv) Get(identifier fx.Identifier) int {
+	return e.memory[identifier]
+}
+
+func (e *memoryEnv) Set(identifier fx.Identifier, value int) {
+	e.memory[identifier] = value
+}
+
+func (e *memoryEnv) HandleError(err error) {
+	e.errs = append(e.errs, err)
+}
+
+func resolveName(script *fx.Script, identifiers fx.IdentifierTable, name string) (fx.Identifier, bool) {
+	if addr, ok := script.Variables()[name]; ok {
+		return fx.Identifier(addr), true
+	}
+
+	identifier, ok := identifiers[name]
+
+	return identifier, ok
+}
+
+// seed sets memory from a JSON object of var or identifier names and values.
+func (e *memoryEnv) seed(path string, script *fx.Script, identifiers fx.IdentifierTable) (err error) {
+	var data []byte
+
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+
+	values := make(map[string]int)
+
+	if err = json.Unmarshal(data, &values); err != nil {
+		return
+	}
+
+	for name, value := range values {
+		identifier, ok := resolveName(script, identifiers, name)
+
+		if !ok {
+			return fmt.Errorf("%s: unknown var or identifier '%s'", path, name)
+		}
+
+		e.memory[identifier] = value
+	}
+
+	return
+}
+
+// dump returns the values of all named vars. Arrays are dumped as lists.
+func (e *memoryEnv) dump(script *fx.Script) map[string]any {
+	variables := script.Variables()
+	values := make(map[string]any)
+
+	for name, addr := range variables {
+		size := script.VariableSize(name)
+
+		if size == 1 {
+			values[name] = e.memory[fx.Identifier(addr)]
+			continue
+		}
+
+		elements := make([]int, size)
+
+		for i := range elements {
+			elements[i] = e.memory[fx.Identifier(addr+i)]
+		}
+
+		values[name] = elements
+	}
+
+	return values
+}
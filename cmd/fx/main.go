@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nitwhiz/fxscript/cmd/internal/cli"
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/plugins"
+	"github.com/nitwhiz/fxscript/repl"
+	"github.com/nitwhiz/fxscript/vm"
+)
+
+const usage = `usage: fx <command> [flags] [file...]
+
+commands:
+  run     run a script
+  check   parse a script and report all errors
+  disasm  print the compiled commands with their pc and source position
+  expand  print the script with macros, defs and includes expanded
+  compile write the compiled script, which all commands accept instead of the source
+  repl    read and run commands and expressions interactively
+
+several files are linked as modules, the first file is the entry point
+
+run "fx <command> -h" for the flags of a command
+`
+
+// exitError carries the exit code of a failed command. Its diagnostics are already printed.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+type options struct {
+	flags *flag.FlagSet
+
+	config  *string
+	plugins *string
+}
+
+func newOptions(name string) *options {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	return &options{
+		flags: flags,
+
+		config:  flags.String("config", "", "JSON file with additional commands, identifiers and symbols"),
+		plugins: flags.String("plugins", "std", "comma separated list of plugins to load, available: "+strings.Join(plugins.Names(), ", ")),
+	}
+}
+
+func (o *options) parse(args []string) (filenames []string, err error) {
+	if err = o.flags.Parse(args); err != nil {
+		return nil, &exitError{2}
+	}
+
+	if o.flags.NArg() == 0 {
+		_, _ = fmt.Fprintf(o.flags.Output(), "usage: fx %s [flags] file...\n", o.flags.Name())
+		o.flags.PrintDefaults()
+
+		return nil, &exitError{2}
+	}
+
+	return o.flags.Args(), nil
+}
+
+// parserConfig returns the built-in commands, the commands of the loaded plugins and the config
+// file.
+func (o *options) parserConfig() (cfg *fx.ParserConfig, commands []*vm.Command, err error) {
+	var names []string
+
+	for _, name := range strings.Split(*o.plugins, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if commands, err = plugins.Commands(names...); err != nil {
+		return
+	}
+
+	if cfg, err = cli.ParserConfig(*o.config); err != nil {
+		return
+	}
+
+	// a config command may name a plugin command, but must not take the type of another one
+	for _, name := range slices.Sorted(maps.Keys(cfg.CommandTypes)) {
+		typ := cfg.CommandTypes[name]
+
+		for _, cmd := range commands {
+			if cmd.Type == typ && cmd.Name != name {
+				return nil, nil, fmt.Errorf("command '%s' of the config file has type %d, which is used by plugin command '%s'", name, typ, cmd.Name)
+			}
+		}
+	}
+
+	for _, cmd := range commands {
+		cfg.CommandTypes[cmd.Name] = cmd.Type
+	}
+
+	return
+}
+
+// load parses and links the modules with the parser config of the options.
+func (o *options) load(filenames []string) (script *fx.Script, cfg *fx.ParserConfig, commands []*vm.Command, err error) {
+	if cfg, commands, err = o.parserConfig(); err != nil {
+		return
+	}
+
+	var warnings []error
+
+	cfg.WarningFn = func(err error) {
+		warnings = append(warnings, err)
+	}
+
+	script, err = cli.LoadModules(filenames, cfg)
+
+	// errors and warnings of all modules are printed in source order
+	diags := fx.Diagnostics(err, cfg.FS)
+
+	for _, warning := range warnings {
+		diags = append(diags, fx.NewDiagnostic(warning, fx.SeverityWarning, cfg.FS))
+	}
+
+	fx.SortDiagnostics(diags)
+
+	for _, d := range diags {
+		_, _ = fmt.Fprint(os.Stderr, d)
+	}
+
+	if err != nil {
+		err = &exitError{1}
+	}
+
+	return
+}
+
+func runCheck(args []string) (err error) {
+	o := newOptions("check")
+
+	var filenames []string
+
+	if filenames, err = o.parse(args); err != nil {
+		return
+	}
+
+	_, _, _, err = o.load(filenames)
+
+	return
+}
+
+func runExpand(args []string) (err error) {
+	o := newOptions("expand")
+
+	var filenames []string
+
+	if filenames, err = o.parse(args); err != nil {
+		return
+	}
+
+	script, cfg, _, err := o.load(filenames)
+
+	if err != nil {
+		return
+	}
+
+	return (&fx.Printer{Commands: cfg.CommandTypes, Identifiers: cfg.Identifiers}).Fprint(os.Stdout, script)
+}
+
+func runDisasm(args []string) (err error) {
+	o := newOptions("disasm")
+
+	asm := o.flags.Bool("asm", false, "print source that parses to the same commands, annotated with pc and source position")
+
+	var filenames []string
+
+	if filenames, err = o.parse(args); err != nil {
+		return
+	}
+
+	script, cfg, _, err := o.load(filenames)
+
+	if err != nil {
+		return
+	}
+
+	printer := &fx.Printer{Commands: cfg.CommandTypes, Identifiers: cfg.Identifiers, Annotate: true}
+
+	if *asm {
+		return printer.Fprint(os.Stdout, script)
+	}
+
+	return printer.Listing(os.Stdout, script)
+}
+
+func runCompile(args []string) (err error) {
+	o := newOptions("compile")
+
+	output := o.flags.String("o", "", "output file, defaults to the input file with the extension .fxc")
+	strip := o.flags.Bool("strip", false, "leave out source positions")
+
+	var filenames []string
+
+	if filenames, err = o.parse(args); err != nil {
+		return
+	}
+
+	script, _, _, err := o.load(filenames)
+
+	if err != nil {
+		return
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(filenames[0], filepath.Ext(filenames[0])) + ".fxc"
+	}
+
+	var buf bytes.Buffer
+
+	if err = fx.EncodeScript(&buf, script, &fx.EncodeOptions{SourceInfo: !*strip}); err != nil {
+		return
+	}
+
+	return os.WriteFile(*output, buf.Bytes(), 0o644)
+}
+
+func writeJSON(path string, v any) (err error) {
+	var w io.Writer = os.Stdout
+
+	if path != "-" {
+		var f *os.File
+
+		if f, err = os.Create(path); err != nil {
+			return
+		}
+
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+func runRun(args []string) (err error) {
+	o := newOptions("run")
+
+	memoryPath := o.flags.String("memory", "", "JSON file with initial values of vars and identifiers")
+	dumpPath := o.flags.String("dump", "", "write the final values of all vars as JSON to this file, - for stdout")
+	entry := o.flags.String("entry", "", "label to start at instead of the beginning of the script")
+
+	var filenames []string
+
+	if filenames, err = o.parse(args); err != nil {
+		return
+	}
+
+	script, cfg, commands, err := o.load(filenames)
+
+	if err != nil {
+		return
+	}
+
+	provided := make(map[fx.CommandType]bool)
+
+	for _, cmd := range slices.Concat(vm.BaseCommands, commands) {
+		provided[cmd.Type] = true
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.CommandTypes)) {
+		if !provided[cfg.CommandTypes[name]] {
+			return fmt.Errorf("command '%s' has no handler, load a plugin that provides it", name)
+		}
+	}
+
+	rt := vm.NewRuntime(script, &vm.RuntimeConfig{
+		UserCommands: commands,
+		Identifiers:  cfg.Identifiers,
+	})
+
+	env := newMemoryEnv()
+
+	// values of the memory file replace the initial values
+	rt.InitMemory(env)
+
+	if *memoryPath != "" {
+		if err = env.seed(*memoryPath, script, cfg.Identifiers); err != nil {
+			return
+		}
+	}
+
+	pc := 0
+
+	if *entry != "" {
+		var ok bool
+
+		if pc, ok = script.Label(*entry); !ok {
+			return fmt.Errorf("unknown label '%s'", *entry)
+		}
+	}
+
+	rt.Start(pc, env)
+
+	if *dumpPath != "" {
+		if err = writeJSON(*dumpPath, env.dump(script)); err != nil {
+			return
+		}
+	}
+
+	if len(env.errs) > 0 {
+		_ = fx.RenderDiagnostics(os.Stderr, env.errs, cfg.FS)
+		return &exitError{1}
+	}
+
+	return
+}
+
+func runRepl(args []string) (err error) {
+	o := newOptions("repl")
+
+	if err = o.flags.Parse(args); err != nil {
+		return &exitError{2}
+	}
+
+	if o.flags.NArg() != 0 {
+		_, _ = fmt.Fprintln(o.flags.Output(), "usage: fx repl [flags]")
+		o.flags.PrintDefaults()
+
+		return &exitError{2}
+	}
+
+	cfg, commands, err := o.parserConfig()
+
+	if err != nil {
+		return
+	}
+
+	r := repl.New(cfg, &vm.RuntimeConfig{
+		UserCommands: commands,
+		Identifiers:  cfg.Identifiers,
+	}, os.Stdout)
+
+	return r.Run(os.Stdin)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		_, _ = fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "run":
+		err = runRun(os.Args[2:])
+	case "check":
+		err = runCheck(os.Args[2:])
+	case "disasm":
+		err = runDisasm(os.Args[2:])
+	case "expand":
+		err = runExpand(os.Args[2:])
+	case "compile":
+		err = runCompile(os.Args[2:])
+	case "repl":
+		err = runRepl(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		_, _ = fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "fx: unknown command '%s'\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		if exitErr, ok := err.(*exitError); ok {
+			os.Exit(exitErr.code)
+		}
+
+		_, _ = fmt.Fprintln(os.Stderr, "fx:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nitwhiz/fxscript/cmd/internal/cli"
+	"github.com/nitwhiz/fxscript/fx"
+)
+
+var (
+	write      = flag.Bool("w", false, "write result to the source file instead of stdout")
+	list       = flag.Bool("l", false, "list files whose formatting differs")
+	configPath = flag.String("config", "", "JSON file with additional commands, identifiers and symbols")
+	tokens     = flag.Bool("tokens", false, "check the result by its tokens instead of parsing it, for included files")
+)
+
+func formatFile(filename string, in io.Reader, out io.Writer, cfg *fx.ParserConfig) (err error) {
+	var src []byte
+
+	if src, err = io.ReadAll(in); err != nil {
+		return
+	}
+
+	var formatted []byte
+
+	if formatted, err = fx.Format(src, filename, cfg); err != nil {
+		return
+	}
+
+	changed := !bytes.Equal(src, formatted)
+
+	if *list {
+		if changed {
+			_, err = fmt.Fprintln(out, filename)
+		}
+
+		return
+	}
+
+	if *write {
+		if changed {
+			err = os.WriteFile(filename, formatted, 0644)
+		}
+
+		return
+	}
+
+	_, err = out.Write(formatted)
+
+	return
+}
+
+func main() {
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: fxfmt [-w] [-l] [-tokens] [-config file] [file ...]")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	cfg, err := cli.ParserConfig(*configPath)
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "fxfmt:", err)
+		os.Exit(2)
+	}
+
+	// includes are resolved relative to the working directory
+	if wd, err := os.Getwd(); err == nil {
+		cfg.FS = fx.NewParserFS(os.DirFS(wd))
+	}
+
+	if *tokens {
+		cfg = nil
+	}
+
+	if flag.NArg() == 0 {
+		if *write {
+			_, _ = fmt.Fprintln(os.Stderr, "fxfmt: cannot use -w with standard input")
+			os.Exit(2)
+		}
+
+		if err := formatFile("<stdin>", os.Stdin, os.Stdout, cfg); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	exitCode := 0
+
+	for _, filename := range flag.Args() {
+		f, err := os.Open(filename)
+
+		if err == nil {
+			err = formatFile(filename, f, os.Stdout, cfg)
+			_ = f.Close()
+		}
+
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+		}
+	}
+
+	os.Exit(exitCode)
+}
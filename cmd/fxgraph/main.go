@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nitwhiz/fxscript/cmd/internal/cli"
+	"github.com/nitwhiz/fxscript/flow"
+	"github.com/nitwhiz/fxscript/fx"
+)
+
+func main() {
+	configPath := flag.String("config", "", "JSON file with additional commands, identifiers and symbols")
+	format := flag.String("format", "dot", "output format: dot or json")
+	calls := flag.Bool("calls", false, "export the call graph instead of the control-flow graph")
+
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: fxgraph [flags] file")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 1 || (*format != "dot" && *format != "json") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := cli.ParserConfig(*configPath)
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	script, err := cli.LoadScript(flag.Arg(0), cfg)
+
+	if err != nil {
+		_ = fx.RenderDiagnostics(os.Stderr, err, cfg.FS)
+		os.Exit(1)
+	}
+
+	g := flow.Build(script, cfg.CommandTypes)
+
+	switch {
+	case *calls && *format == "json":
+		err = g.CallGraph().WriteJSON(os.Stdout)
+	case *calls:
+		err = g.CallGraph().WriteDOT(os.Stdout)
+	case *format == "json":
+		err = g.WriteJSON(os.Stdout)
+	default:
+		err = g.WriteDOT(os.Stdout)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
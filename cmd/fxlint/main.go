@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nitwhiz/fxscript/cmd/internal/cli"
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/lint"
+)
+
+type jsonFinding struct {
+	Code lint.Code `json:"code"`
+	*fx.Diagnostic
+}
+
+func splitList(s string) (items []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return
+}
+
+func main() {
+	configPath := flag.String("config", "", "JSON file with additional commands, identifiers and symbols")
+	disable := flag.String("disable", "", "comma separated list of check codes to disable, e.g. FX001,FX005")
+	exported := flag.String("export", "", "comma separated list of labels and defs used by the host")
+	jsonOutput := flag.Bool("json", false, "print findings as JSON")
+
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: fxlint [flags] file ...")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	lintCfg := &lint.Config{Exported: splitList(*exported)}
+
+	for _, code := range splitList(*disable) {
+		lintCfg.Disabled = append(lintCfg.Disabled, lint.Code(code))
+	}
+
+	exitCode := 0
+	results := make([]*jsonFinding, 0)
+
+	for _, filename := range flag.Args() {
+		cfg, err := cli.ParserConfig(*configPath)
+
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		script, err := cli.LoadScript(filename, cfg)
+
+		if err != nil {
+			exitCode = 1
+
+			if *jsonOutput {
+				for _, d := range fx.Diagnostics(err, cfg.FS) {
+					results = append(results, &jsonFinding{Diagnostic: d})
+				}
+			} else {
+				_ = fx.RenderDiagnostics(os.Stderr, err, cfg.FS)
+			}
+
+			continue
+		}
+
+		for _, finding := range lint.Lint(script, lintCfg) {
+			exitCode = 1
+
+			d := fx.NewDiagnostic(finding, fx.SeverityWarning, cfg.FS)
+
+			if *jsonOutput {
+				results = append(results, &jsonFinding{finding.Code, d})
+			} else {
+				_, _ = fmt.Fprint(os.Stdout, d)
+			}
+		}
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		_ = enc.Encode(results)
+	}
+
+	os.Exit(exitCode)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/nitwhiz/fxscript/cmd/internal/cli"
+	"github.com/nitwhiz/fxscript/lsp"
+)
+
+func main() {
+	configPath := flag.String("config", "", "JSON file with additional commands, identifiers and symbols")
+
+	flag.Parse()
+
+	cfg, err := cli.ParserConfig(*configPath)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = lsp.NewServer(cfg, os.DirFS("/")).Run(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/vm"
+)
+
+// Config adds host commands, identifiers and symbols to the built-in commands.
+type Config struct {
+	Commands    fx.CommandTypeTable `json:"commands"`
+	Identifiers fx.IdentifierTable  `json:"identifiers"`
+	Symbols     fx.SymbolTable      `json:"symbols"`
+	Strict      bool                `json:"strict"`
+}
+
+// ParserConfig returns a parser config with the built-in commands and, if configPath is not
+// empty, the commands, identifiers, symbols and strict mode of the JSON config file.
+func ParserConfig(configPath string) (cfg *fx.ParserConfig, err error) {
+	cfg = (&vm.RuntimeConfig{}).ParserConfig(nil, nil)
+
+	if configPath == "" {
+		return
+	}
+
+	var data []byte
+
+	if data, err = os.ReadFile(configPath); err != nil {
+		return
+	}
+
+	var c Config
+
+	if err = json.Unmarshal(data, &c); err != nil {
+		return
+	}
+
+	for name, typ := range c.Commands {
+		cfg.CommandTypes[name] = typ
+	}
+
+	cfg.Identifiers = c.Identifiers
+	cfg.Symbols = c.Symbols
+	cfg.Strict = c.Strict
+
+	return
+}
+
+// LoadScript parses a script file, or decodes it if it is a compiled script. Includes are resolved
+// relative to the working directory, which is also where cfg.FS is rooted afterward.
+func LoadScript(filename string, cfg *fx.ParserConfig) (script *fx.Script, err error) {
+	var wd string
+
+	if wd, err = os.Getwd(); err != nil {
+		return
+	}
+
+	if filepath.IsAbs(filename) {
+		if filename, err = filepath.Rel(wd, filename); err != nil {
+			return
+		}
+	}
+
+	var data []byte
+
+	if data, err = os.ReadFile(filename); err != nil {
+		return
+	}
+
+	cfg.FS = fx.NewParserFS(os.DirFS(wd))
+
+	if bytes.HasPrefix(data, []byte(fx.EncodingMagic)) {
+		return fx.DecodeScript(data, cfg)
+	}
+
+	return fx.LoadScript(data, filepath.ToSlash(filename), cfg)
+}
+
+// LoadModules loads every file with LoadScript. The scripts are linked if there is more than one
+// file or the script imports modules, the first file is the entry point.
+func LoadModules(filenames []string, cfg *fx.ParserConfig) (script *fx.Script, err error) {
+	var errs fx.ErrorList
+
+	modules := make([]*fx.Script, 0, len(filenames))
+
+	for _, filename := range filenames {
+		var module *fx.Script
+
+		if module, err = LoadScript(filename, cfg); err != nil {
+			var parseErrs fx.ErrorList
+
+			if !errors.As(err, &parseErrs) {
+				return
+			}
+
+			errs = append(errs, parseErrs...)
+		}
+
+		modules = append(modules, module)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if len(modules) == 1 && len(modules[0].Imports()) == 0 {
+		return modules[0], nil
+	}
+
+	return fx.Link(modules...)
+}
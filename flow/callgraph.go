@@ -0,0 +1,122 @@
+package flow
+
+import (
+	"fmt"
+	"slices"
+)
+
+// EntryFunction names the code starting at pc 0 if there is no label there.
+const EntryFunction = "<entry>"
+
+// UnknownFunction is the callee of calls through computed targets that can not be resolved.
+const UnknownFunction = "?"
+
+// Function is the code reachable from a call target, or from the start of the script, without
+// following calls.
+type Function struct {
+	Name   string `json:"name"`
+	PC     int    `json:"pc"`
+	Blocks []int  `json:"blocks"`
+}
+
+type Call struct {
+	Caller  string `json:"caller"`
+	Callee  string `json:"callee"`
+	PC      int    `json:"pc"`
+	Dynamic bool   `json:"dynamic,omitempty"`
+}
+
+type CallGraph struct {
+	Functions []*Function `json:"functions"`
+	Calls     []*Call     `json:"calls"`
+}
+
+func (g *Graph) functionName(id int) string {
+	if id == Unknown {
+		return UnknownFunction
+	}
+
+	if id < 0 || id >= len(g.Blocks) {
+		return fmt.Sprintf("<block %d>", id)
+	}
+
+	block := g.Blocks[id]
+
+	if len(block.Labels) > 0 {
+		return block.Labels[0]
+	}
+
+	if block.Start == 0 {
+		return EntryFunction
+	}
+
+	return fmt.Sprintf("<pc %d>", block.Start)
+}
+
+// CallGraph derives the calls between functions from the control-flow graph.
+func (g *Graph) CallGraph() *CallGraph {
+	cg := &CallGraph{
+		Functions: make([]*Function, 0),
+		Calls:     make([]*Call, 0),
+	}
+
+	if len(g.Blocks) == 0 {
+		return cg
+	}
+
+	entries := []int{0}
+
+	for _, e := range g.Edges {
+		if e.Kind == EdgeCall && e.To >= 0 && !slices.Contains(entries, e.To) {
+			entries = append(entries, e.To)
+		}
+	}
+
+	for _, entry := range entries {
+		fn := &Function{
+			Name:   g.functionName(entry),
+			PC:     g.Blocks[entry].Start,
+			Blocks: make([]int, 0),
+		}
+
+		visited := map[int]bool{entry: true}
+		pending := []int{entry}
+
+		for len(pending) > 0 {
+			id := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+
+			fn.Blocks = append(fn.Blocks, id)
+
+			for _, e := range g.Successors(id) {
+				if e.Kind == EdgeCall {
+					block := g.Blocks[id]
+
+					cg.Calls = append(cg.Calls, &Call{
+						Caller:  fn.Name,
+						Callee:  g.functionName(e.To),
+						PC:      block.End - 1,
+						Dynamic: e.Dynamic,
+					})
+
+					continue
+				}
+
+				if e.To >= 0 && !visited[e.To] {
+					visited[e.To] = true
+					pending = append(pending, e.To)
+				}
+			}
+		}
+
+		slices.Sort(fn.Blocks)
+
+		cg.Functions = append(cg.Functions, fn)
+	}
+
+	slices.SortStableFunc(cg.Calls, func(a, b *Call) int {
+		return a.PC - b.PC
+	})
+
+	return cg
+}
@@ -0,0 +1,118 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func dotNode(id int) string {
+	switch id {
+	case Exit:
+		return "exit"
+	case Unknown:
+		return "unknown"
+	}
+
+	return fmt.Sprintf("b%d", id)
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// WriteDOT writes the control-flow graph in Graphviz DOT format. Dynamic edges are dashed.
+func (g *Graph) WriteDOT(w io.Writer) (err error) {
+	var sb strings.Builder
+
+	sb.WriteString("digraph cfg {\n")
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	sb.WriteString("  exit [shape=doublecircle];\n")
+
+	for _, block := range g.Blocks {
+		var label strings.Builder
+
+		for _, name := range block.Labels {
+			label.WriteString(name + ":\\l")
+		}
+
+		for _, cmd := range block.Commands {
+			label.WriteString(fmt.Sprintf("%d: %s (%s)\\l", cmd.PC, dotEscape(cmd.Name), dotEscape(cmd.Position)))
+		}
+
+		sb.WriteString(fmt.Sprintf("  %s [label=\"%s\"];\n", dotNode(block.ID), label.String()))
+	}
+
+	hasUnknown := false
+
+	for _, e := range g.Edges {
+		attrs := []string{fmt.Sprintf("label=\"%s\"", e.Kind)}
+
+		if e.Dynamic {
+			attrs = append(attrs, "style=dashed")
+		}
+
+		if e.To == Unknown {
+			hasUnknown = true
+		}
+
+		sb.WriteString(fmt.Sprintf("  %s -> %s [%s];\n", dotNode(e.From), dotNode(e.To), strings.Join(attrs, ", ")))
+	}
+
+	if hasUnknown {
+		sb.WriteString("  unknown [shape=diamond, label=\"?\"];\n")
+	}
+
+	sb.WriteString("}\n")
+
+	_, err = io.WriteString(w, sb.String())
+
+	return
+}
+
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the call graph in Graphviz DOT format. Dynamic calls are dashed.
+func (cg *CallGraph) WriteDOT(w io.Writer) (err error) {
+	var sb strings.Builder
+
+	sb.WriteString("digraph calls {\n")
+
+	for _, fn := range cg.Functions {
+		sb.WriteString(fmt.Sprintf("  \"%s\";\n", dotEscape(fn.Name)))
+	}
+
+	seen := make(map[string]bool)
+
+	for _, call := range cg.Calls {
+		edge := fmt.Sprintf("  \"%s\" -> \"%s\"", dotEscape(call.Caller), dotEscape(call.Callee))
+
+		if call.Dynamic {
+			edge += " [style=dashed]"
+		}
+
+		if !seen[edge] {
+			seen[edge] = true
+			sb.WriteString(edge + ";\n")
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	_, err = io.WriteString(w, sb.String())
+
+	return
+}
+
+func (cg *CallGraph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(cg)
+}
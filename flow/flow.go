@@ -0,0 +1,289 @@
+package flow
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/nitwhiz/fxscript/fx"
+)
+
+// Pseudo block ids for edges that leave the script or go to a target that can not be determined
+// statically.
+const (
+	Exit    = -1
+	Unknown = -2
+)
+
+type EdgeKind string
+
+const (
+	EdgeFallthrough EdgeKind = "fallthrough"
+	EdgeJump        EdgeKind = "jump"
+	EdgeBranch      EdgeKind = "branch"
+	EdgeCall        EdgeKind = "call"
+	EdgeExit        EdgeKind = "exit"
+)
+
+type Command struct {
+	PC       int    `json:"pc"`
+	Name     string `json:"name"`
+	Position string `json:"position"`
+}
+
+// Block is a basic block: a run of commands that is only entered at its first command and only
+// left after its last one.
+type Block struct {
+	ID       int        `json:"id"`
+	Start    int        `json:"start"`
+	End      int        `json:"end"`
+	Labels   []string   `json:"labels,omitempty"`
+	Commands []*Command `json:"commands"`
+}
+
+// Edge connects two blocks. Dynamic edges are jumps or calls through computed targets, e.g. a
+// var holding a label address.
+type Edge struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Kind    EdgeKind `json:"kind"`
+	Dynamic bool     `json:"dynamic,omitempty"`
+}
+
+// Graph is the control-flow graph of a script.
+type Graph struct {
+	Blocks []*Block `json:"blocks"`
+	Edges  []*Edge  `json:"edges"`
+
+	blockAt  map[int]int
+	labelsAt map[int][]string
+}
+
+type builder struct {
+	script   *fx.Script
+	commands []*fx.CommandNode
+	names    map[fx.CommandType]string
+
+	// varTargets are the label addresses assigned to each var
+	varTargets map[fx.Identifier][]int
+
+	g *Graph
+}
+
+// Build creates the control-flow graph of a script. commands is used to name the commands and
+// may be nil.
+func Build(script *fx.Script, commands fx.CommandTypeTable) *Graph {
+	b := &builder{
+		script:   script,
+		commands: script.Commands(),
+		names:    make(map[fx.CommandType]string),
+
+		varTargets: make(map[fx.Identifier][]int),
+
+		g: &Graph{
+			Blocks: make([]*Block, 0),
+			Edges:  make([]*Edge, 0),
+
+			blockAt:  make(map[int]int),
+			labelsAt: make(map[int][]string),
+		},
+	}
+
+	for name, typ := range commands {
+		b.names[typ] = name
+	}
+
+	for name, pc := range script.Labels() {
+		b.g.labelsAt[pc] = append(b.g.labelsAt[pc], name)
+	}
+
+	for _, labels := range b.g.labelsAt {
+		slices.Sort(labels)
+	}
+
+	b.collectVarTargets()
+	b.buildBlocks()
+	b.buildEdges()
+
+	return b.g
+}
+
+func (b *builder) collectVarTargets() {
+	for _, cmd := range b.commands {
+		if cmd.Type != fx.CmdSet || len(cmd.Args) < 2 {
+			continue
+		}
+
+		v, ok := cmd.Args[0].(*fx.IdentifierNode)
+
+		if !ok {
+			continue
+		}
+
+		if addr, ok := cmd.Args[1].(*fx.AddressNode); ok && !slices.Contains(b.varTargets[v.Identifier], addr.Address) {
+			b.varTargets[v.Identifier] = append(b.varTargets[v.Identifier], addr.Address)
+		}
+	}
+
+	for _, targets := range b.varTargets {
+		slices.Sort(targets)
+	}
+}
+
+// targets resolves a jump target expression. Computed targets are resolved to the label addresses
+// ever assigned to the var, if any.
+func (b *builder) targets(expr fx.ExpressionNode) (pcs []int, dynamic bool) {
+	switch n := expr.(type) {
+	case *fx.AddressNode:
+		return []int{n.Address}, false
+	case *fx.IdentifierNode:
+		return b.varTargets[n.Identifier], true
+	}
+
+	return nil, true
+}
+
+func (b *builder) jumpArg(cmd *fx.CommandNode) fx.ExpressionNode {
+	switch cmd.Type {
+	case fx.CmdGoto, fx.CmdCall:
+		if len(cmd.Args) > 0 {
+			return cmd.Args[0]
+		}
+	case fx.CmdJumpIf:
+		if len(cmd.Args) > 1 {
+			return cmd.Args[1]
+		}
+	}
+
+	return nil
+}
+
+func endsBlock(cmd *fx.CommandNode) bool {
+	switch cmd.Type {
+	case fx.CmdGoto, fx.CmdJumpIf, fx.CmdCall, fx.CmdRet, fx.CmdExit:
+		return true
+	}
+
+	return false
+}
+
+func (b *builder) commandName(typ fx.CommandType) string {
+	if name, ok := b.names[typ]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("cmd%d", typ)
+}
+
+func (b *builder) buildBlocks() {
+	n := len(b.commands)
+	leaders := map[int]bool{0: true}
+
+	for pc := range b.g.labelsAt {
+		leaders[pc] = true
+	}
+
+	for pc, cmd := range b.commands {
+		if endsBlock(cmd) {
+			leaders[pc+1] = true
+		}
+
+		if arg := b.jumpArg(cmd); arg != nil {
+			pcs, _ := b.targets(arg)
+
+			for _, target := range pcs {
+				leaders[target] = true
+			}
+		}
+	}
+
+	starts := slices.Sorted(maps.Keys(leaders))
+
+	for i, start := range starts {
+		if start < 0 || start >= n {
+			continue
+		}
+
+		end := n
+
+		if i+1 < len(starts) && starts[i+1] < n {
+			end = starts[i+1]
+		}
+
+		block := &Block{
+			ID:       len(b.g.Blocks),
+			Start:    start,
+			End:      end,
+			Labels:   b.g.labelsAt[start],
+			Commands: make([]*Command, 0, end-start),
+		}
+
+		for pc := start; pc < end; pc++ {
+			cmd := b.commands[pc]
+
+			block.Commands = append(block.Commands, &Command{pc, b.commandName(cmd.Type), cmd.SourceInfo.Position()})
+		}
+
+		b.g.blockAt[start] = block.ID
+		b.g.Blocks = append(b.g.Blocks, block)
+	}
+}
+
+func (b *builder) block(pc int) int {
+	if id, ok := b.g.blockAt[pc]; ok {
+		return id
+	}
+
+	if pc >= len(b.commands) {
+		return Exit
+	}
+
+	return Unknown
+}
+
+func (b *builder) addEdges(from int, expr fx.ExpressionNode, kind EdgeKind) {
+	pcs, dynamic := b.targets(expr)
+
+	if len(pcs) == 0 {
+		b.g.Edges = append(b.g.Edges, &Edge{from, Unknown, kind, true})
+		return
+	}
+
+	for _, pc := range pcs {
+		b.g.Edges = append(b.g.Edges, &Edge{from, b.block(pc), kind, dynamic})
+	}
+}
+
+func (b *builder) buildEdges() {
+	for _, block := range b.g.Blocks {
+		last := b.commands[block.End-1]
+		next := b.block(block.End)
+
+		switch last.Type {
+		case fx.CmdGoto:
+			b.addEdges(block.ID, b.jumpArg(last), EdgeJump)
+		case fx.CmdJumpIf:
+			b.addEdges(block.ID, b.jumpArg(last), EdgeBranch)
+			b.g.Edges = append(b.g.Edges, &Edge{block.ID, next, EdgeFallthrough, false})
+		case fx.CmdCall:
+			b.addEdges(block.ID, b.jumpArg(last), EdgeCall)
+			b.g.Edges = append(b.g.Edges, &Edge{block.ID, next, EdgeFallthrough, false})
+		case fx.CmdExit:
+			b.g.Edges = append(b.g.Edges, &Edge{block.ID, Exit, EdgeExit, false})
+		case fx.CmdRet:
+		default:
+			b.g.Edges = append(b.g.Edges, &Edge{block.ID, next, EdgeFallthrough, false})
+		}
+	}
+}
+
+// Successors returns the edges leaving a block.
+func (g *Graph) Successors(id int) (edges []*Edge) {
+	for _, e := range g.Edges {
+		if e.From == id {
+			edges = append(edges, e)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,108 @@
+package flow
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/stretchr/testify/require"
+)
+
+var testCommands = fx.CommandTypeTable{
+	"set":    fx.CmdSet,
+	"goto":   fx.CmdGoto,
+	"call":   fx.CmdCall,
+	"ret":    fx.CmdRet,
+	"exit":   fx.CmdExit,
+	"jumpIf": fx.CmdJumpIf,
+}
+
+func buildGraph(t *testing.T, src string) *Graph {
+	t.Helper()
+
+	script, err := fx.LoadScript([]byte(src), "test.fx", &fx.ParserConfig{
+		CommandTypes: testCommands,
+		Identifiers:  fx.IdentifierTable{"A": 1},
+	})
+
+	require.NoError(t, err)
+
+	return Build(script, testCommands)
+}
+
+func TestBuild_FunctionPointer(t *testing.T) {
+	g := buildGraph(t, `var fn
+
+set fn, updateA
+
+goto main
+
+updateA:
+  set A, 42
+  ret
+
+main:
+  call fn
+  set A, 1
+`)
+
+	require.Len(t, g.Blocks, 4)
+	require.Equal(t, []string{"updateA"}, g.Blocks[1].Labels)
+	require.Equal(t, []*Command{{2, "set", "test.fx:8:3"}, {3, "ret", "test.fx:9:3"}}, g.Blocks[1].Commands)
+
+	require.Equal(t, []*Edge{
+		{0, 2, EdgeJump, false},
+		{2, 1, EdgeCall, true},
+		{2, 3, EdgeFallthrough, false},
+		{3, Exit, EdgeFallthrough, false},
+	}, g.Edges)
+
+	cg := g.CallGraph()
+
+	require.Equal(t, []*Function{
+		{EntryFunction, 0, []int{0, 2, 3}},
+		{"updateA", 2, []int{1}},
+	}, cg.Functions)
+	require.Equal(t, []*Call{{EntryFunction, "updateA", 4, true}}, cg.Calls)
+
+	var dot bytes.Buffer
+
+	require.NoError(t, g.WriteDOT(&dot))
+	require.Contains(t, dot.String(), `b2 -> b1 [label="call", style=dashed];`)
+	require.Contains(t, dot.String(), `b1 [label="updateA:\l2: set (test.fx:8:3)\l3: ret (test.fx:9:3)\l"];`)
+
+	dot.Reset()
+
+	require.NoError(t, cg.WriteDOT(&dot))
+	require.Equal(t, "digraph calls {\n  \"<entry>\";\n  \"updateA\";\n  \"<entry>\" -> \"updateA\" [style=dashed];\n}\n", dot.String())
+}
+
+func TestBuild_Branches(t *testing.T) {
+	g := buildGraph(t, `loop:
+  set A, A - 1
+  jumpIf A, loop
+  call sub
+  call A
+  exit
+
+sub:
+  ret
+`)
+
+	require.Len(t, g.Blocks, 5)
+
+	require.Equal(t, []*Edge{
+		{0, 0, EdgeBranch, false},
+		{0, 1, EdgeFallthrough, false},
+		{1, 4, EdgeCall, false},
+		{1, 2, EdgeFallthrough, false},
+		{2, Unknown, EdgeCall, true},
+		{2, 3, EdgeFallthrough, false},
+		{3, Exit, EdgeExit, false},
+	}, g.Edges)
+
+	require.Equal(t, []*Call{
+		{"loop", "sub", 2, false},
+		{"loop", UnknownFunction, 3, true},
+	}, g.CallGraph().Calls)
+}
@@ -0,0 +1,152 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/stretchr/testify/require"
+)
+
+func load(t *testing.T, src string) *fx.Script {
+	t.Helper()
+
+	s, err := fx.LoadScript([]byte(src), "test.fx", &fx.ParserConfig{
+		CommandTypes: fx.CommandTypeTable{"set": fx.CmdSet},
+	})
+
+	require.NoError(t, err)
+
+	return s
+}
+
+// maxNode is a user-defined node kind with sub-expressions.
+type maxNode struct {
+	*fx.SourceInfo
+	A, B fx.ExpressionNode
+}
+
+func (n *maxNode) ExprNode() {}
+
+func (n *maxNode) Children() []fx.ExpressionNode {
+	return []fx.ExpressionNode{n.A, n.B}
+}
+
+func (n *maxNode) WithChildren(children []fx.ExpressionNode) fx.ExpressionNode {
+	return &maxNode{n.SourceInfo, children[0], children[1]}
+}
+
+func (n *maxNode) Eval(s *fx.Script, getValue fx.IdentifierValueRetriever) (v any, err error) {
+	var a, b any
+
+	if a, err = s.Eval(n.A, getValue); err != nil {
+		return
+	}
+
+	if b, err = s.Eval(n.B, getValue); err != nil {
+		return
+	}
+
+	return max(a.(int), b.(int)), nil
+}
+
+func TestInspect(t *testing.T) {
+	s := load(t, "var a\nvar b\nset a, b + 2 * -a\nset b, 1\n")
+
+	var kinds []string
+
+	InspectScript(s, func(node Node) bool {
+		switch node.(type) {
+		case *fx.IdentifierNode:
+			kinds = append(kinds, "ident")
+		case *fx.IntegerNode:
+			kinds = append(kinds, "int")
+		case *fx.UnaryOpNode:
+			kinds = append(kinds, "unary")
+			return false
+		}
+
+		return true
+	})
+
+	require.Equal(t, []string{"ident", "ident", "int", "unary", "ident", "int"}, kinds)
+}
+
+func TestRewrite(t *testing.T) {
+	s := load(t, "var a\nset a, (1 + 2) * a\n")
+
+	original := s.Commands()[0]
+	sum := original.Args[1].(*fx.BinaryOpNode).Left
+
+	// fold additions of integer constants
+	RewriteScript(s, func(node Node) Node {
+		if n, ok := node.(*fx.BinaryOpNode); ok && n.Operator.Type == fx.ADD {
+			l, lok := n.Left.(*fx.IntegerNode)
+			r, rok := n.Right.(*fx.IntegerNode)
+
+			if lok && rok {
+				return &fx.IntegerNode{SourceInfo: n.SourceInfo, Value: l.Value + r.Value}
+			}
+		}
+
+		return node
+	})
+
+	cmd := s.Commands()[0]
+
+	require.NotSame(t, original, cmd)
+	require.Same(t, original.SourceInfo, cmd.SourceInfo)
+	require.Same(t, original.Args[0], cmd.Args[0])
+
+	product := cmd.Args[1].(*fx.BinaryOpNode)
+
+	require.Same(t, original.Args[1].Source(), product.Source())
+	require.Equal(t, &fx.IntegerNode{SourceInfo: sum.Source(), Value: 3}, product.Left)
+
+	// the input tree is unchanged
+	require.IsType(t, &fx.BinaryOpNode{}, original.Args[1].(*fx.BinaryOpNode).Left)
+}
+
+func TestUserDefinedNode(t *testing.T) {
+	s := load(t, "set 1, 2\n")
+
+	expr := &maxNode{
+		A: &fx.IntegerNode{Value: 4},
+		B: &fx.BinaryOpNode{
+			Left:     &fx.IntegerNode{Value: 2},
+			Operator: &fx.Token{Type: fx.MUL},
+			Right:    &fx.IntegerNode{Value: 3},
+		},
+	}
+
+	count := 0
+
+	Inspect(expr, func(node Node) bool {
+		if node != nil {
+			count++
+		}
+
+		return true
+	})
+
+	require.Equal(t, 5, count)
+
+	rewritten := Rewrite(expr, func(node Node) Node {
+		if n, ok := node.(*fx.IntegerNode); ok && n.Value == 4 {
+			return &fx.IntegerNode{Value: 7}
+		}
+
+		return node
+	}).(fx.ExpressionNode)
+
+	require.IsType(t, &maxNode{}, rewritten)
+
+	v, err := s.Eval(expr, nil)
+
+	require.NoError(t, err)
+	require.Equal(t, 6, v)
+
+	v, err = s.Eval(rewritten, nil)
+
+	require.NoError(t, err)
+	require.Equal(t, 7, v)
+}
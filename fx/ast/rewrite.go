@@ -0,0 +1,97 @@
+package ast
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/nitwhiz/fxscript/fx"
+)
+
+// Rewrite replaces nodes bottom-up. f is called for every node after its children were rewritten
+// and returns the replacement, or the node itself to keep it. Nodes whose children changed are
+// copied with their SourceInfo, all other nodes are shared with the input tree.
+//
+// Commands can only be replaced by commands and expressions only by expressions.
+func Rewrite(node Node, f func(Node) Node) Node {
+	children := Children(node)
+	rewritten := make([]fx.ExpressionNode, len(children))
+	changed := false
+
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+
+		replacement, ok := Rewrite(child, f).(fx.ExpressionNode)
+
+		if !ok {
+			panic(fmt.Sprintf("ast: expression %T rewritten to a non-expression", child))
+		}
+
+		rewritten[i] = replacement
+		changed = changed || replacement != child
+	}
+
+	if changed {
+		node = withChildren(node, rewritten)
+	}
+
+	replacement := f(node)
+
+	if _, isCommand := node.(*fx.CommandNode); isCommand {
+		if _, ok := replacement.(*fx.CommandNode); !ok {
+			panic(fmt.Sprintf("ast: command rewritten to %T", replacement))
+		}
+	}
+
+	return replacement
+}
+
+// withChildren copies a node and replaces its children.
+func withChildren(node Node, children []fx.ExpressionNode) Node {
+	switch n := node.(type) {
+	case *fx.CommandNode:
+		c := *n
+		c.Args = slices.Clone(children)
+
+		return &c
+	case *fx.UnaryOpNode:
+		c := *n
+		c.Expr = children[0]
+
+		return &c
+	case *fx.BinaryOpNode:
+		c := *n
+		c.Left, c.Right = children[0], children[1]
+
+		return &c
+	case *fx.ArrayAccessNode:
+		c := *n
+		c.Index = children[0]
+
+		return &c
+	case *fx.IndexCheckNode:
+		c := *n
+		c.Index = children[0]
+
+		return &c
+	case *fx.ImportNode:
+		c := *n
+		c.Index = children[0]
+
+		return &c
+	case Parent:
+		return n.WithChildren(children)
+	}
+
+	return node
+}
+
+// RewriteScript rewrites every command of a script in place.
+func RewriteScript(s *fx.Script, f func(Node) Node) {
+	commands := s.Commands()
+
+	for pc, cmd := range commands {
+		commands[pc] = Rewrite(cmd, f).(*fx.CommandNode)
+	}
+}
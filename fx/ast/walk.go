@@ -0,0 +1,94 @@
+// Package ast walks and rewrites the commands and expressions of parsed scripts.
+package ast
+
+import (
+	"fmt"
+
+	"github.com/nitwhiz/fxscript/fx"
+)
+
+// Node is a *fx.CommandNode or an fx.ExpressionNode.
+type Node interface {
+	Source() *fx.SourceInfo
+}
+
+// Parent is implemented by user-defined expression nodes that have sub-expressions, so Walk and
+// Rewrite can descend into them.
+type Parent interface {
+	fx.ExpressionNode
+
+	Children() []fx.ExpressionNode
+
+	// WithChildren returns a copy of the node with the children replaced, in the order returned by
+	// Children.
+	WithChildren(children []fx.ExpressionNode) fx.ExpressionNode
+}
+
+// Visitor is called for every node by Walk. If it returns a non-nil visitor w, the children of the
+// node are walked with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Children returns the direct sub-expressions of a node in source order.
+func Children(node Node) []fx.ExpressionNode {
+	switch n := node.(type) {
+	case *fx.CommandNode:
+		return n.Args
+	case *fx.UnaryOpNode:
+		return []fx.ExpressionNode{n.Expr}
+	case *fx.BinaryOpNode:
+		return []fx.ExpressionNode{n.Left, n.Right}
+	case *fx.ArrayAccessNode:
+		return []fx.ExpressionNode{n.Index}
+	case *fx.IndexCheckNode:
+		return []fx.ExpressionNode{n.Index}
+	case *fx.ImportNode:
+		return []fx.ExpressionNode{n.Index}
+	case Parent:
+		return n.Children()
+	case fx.ExpressionNode, nil:
+		// leaves and user-defined nodes without children
+		return nil
+	}
+
+	panic(fmt.Sprintf("ast: unexpected node %T", node))
+}
+
+// Walk traverses the tree below node in depth-first order. Missing sub-expressions are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range Children(node) {
+		if child != nil {
+			Walk(v, child)
+		}
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect calls f for every node below and including node in depth-first order. If f returns
+// false, the children of the node are skipped. After the children, f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// InspectScript inspects all commands of a script in pc order.
+func InspectScript(s *fx.Script, f func(Node) bool) {
+	for _, cmd := range s.Commands() {
+		Inspect(cmd, f)
+	}
+}
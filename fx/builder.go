@@ -0,0 +1,255 @@
+package fx
+
+import "fmt"
+
+// Builder creates a script from Go code instead of source, e.g. for generated scripts. The
+// result is the same as parsing the equivalent source. Nodes carry the SourceInfo set with At,
+// which is nil by default.
+//
+// Errors are collected and returned by Build.
+type Builder struct {
+	cfg *ParserConfig
+
+	// parser declares symbols and looks up operators like in source
+	parser *Parser
+
+	script *Script
+	source *SourceInfo
+	errs   ErrorList
+}
+
+func NewBuilder(cfg *ParserConfig) *Builder {
+	parser := NewParser(NewLexer(nil, ""), cfg)
+
+	script := newScript()
+	script.operators = cfg.Operators
+
+	return &Builder{
+		cfg:    cfg,
+		parser: parser,
+		script: script,
+		errs:   append(ErrorList{}, parser.configErrs...),
+	}
+}
+
+// At sets the SourceInfo of all following nodes, e.g. to point errors to the object in an editor
+// that a command was generated from.
+func (b *Builder) At(source *SourceInfo) {
+	b.source = source
+}
+
+func (b *Builder) fail(err error) {
+	b.errs = append(b.errs, &SyntaxError{b.source, err})
+}
+
+// PC returns the pc of the next command.
+func (b *Builder) PC() int {
+	return b.script.PC()
+}
+
+// declare declares a symbol like the parser does, so duplicates and conflicts with other symbols
+// are reported the same way.
+func (b *Builder) declare(kind SymbolKind, name string, declared func(string) bool) (ok bool) {
+	tok := &Token{SourceInfo: b.source, Type: IDENT, Value: name}
+
+	if _, err := b.parser.declare(b.script, kind, tok, name, declared); err != nil {
+		b.errs = append(b.errs, err)
+		return false
+	}
+
+	return true
+}
+
+// Var declares a var and returns a reference to it.
+func (b *Builder) Var(name string) *IdentifierNode {
+	if !b.declare(SymbolVariable, name, b.script.isVariable) {
+		return &IdentifierNode{b.source, Identifier(b.script.variables[name])}
+	}
+
+	return &IdentifierNode{b.source, Identifier(b.script.addVariable(name, 1))}
+}
+
+// Array declares a var with size elements and returns a reference to its first element.
+func (b *Builder) Array(name string, size int) *IdentifierNode {
+	if size < 1 {
+		b.fail(&InvalidLengthError{name, size})
+		return &IdentifierNode{b.source, Identifier(b.script.variables[name])}
+	}
+
+	if !b.declare(SymbolVariable, name, b.script.isVariable) {
+		return &IdentifierNode{b.source, Identifier(b.script.variables[name])}
+	}
+
+	offset := b.script.addVariable(name, size)
+	b.script.shapes[name] = &variableShape{dimensions: []int{size}}
+
+	return &IdentifierNode{b.source, Identifier(offset)}
+}
+
+// Define declares a def. References to it with Ident are replaced by expr.
+func (b *Builder) Define(name string, expr ExpressionNode) {
+	if b.declare(SymbolDefine, name, b.script.isDefine) {
+		b.script.defines[name] = expr
+	}
+}
+
+// Label declares a label at the pc of the next command.
+func (b *Builder) Label(name string) {
+	if b.declare(SymbolLabel, name, b.script.isLabel) {
+		b.script.labels[name] = b.script.PC()
+	}
+}
+
+// Emit appends a command by its type. A user command type must be in the command table of the
+// config.
+func (b *Builder) Emit(typ CommandType, args ...ExpressionNode) {
+	name := ""
+
+	if typ >= UserCommandOffset {
+		var ok bool
+
+		if name, ok = b.commandName(typ); !ok {
+			b.fail(&UnknownCommandError{fmt.Sprintf("%d", typ)})
+			return
+		}
+	}
+
+	b.emit(typ, name, args)
+}
+
+// Command appends a command by its name in the command table of the config.
+func (b *Builder) Command(name string, args ...ExpressionNode) {
+	typ, ok := b.cfg.CommandTypes[name]
+
+	if !ok {
+		b.fail(&UnknownCommandError{name})
+		return
+	}
+
+	b.emit(typ, name, args)
+}
+
+func (b *Builder) emit(typ CommandType, name string, args []ExpressionNode) {
+	b.script.addCommand(&CommandNode{
+		SourceInfo: b.source,
+		Type:       typ,
+		Args:       args,
+	}, name)
+}
+
+// commandName returns the smallest name of typ in the command table, like Printer does.
+func (b *Builder) commandName(typ CommandType) (name string, ok bool) {
+	for n, t := range b.cfg.CommandTypes {
+		if t == typ && (!ok || n < name) {
+			name, ok = n, true
+		}
+	}
+
+	return
+}
+
+func (b *Builder) Int(v int) *IntegerNode {
+	return &IntegerNode{b.source, v}
+}
+
+func (b *Builder) Float(v float64) *FloatNode {
+	return &FloatNode{b.source, v}
+}
+
+func (b *Builder) Str(v string) *StringNode {
+	return &StringNode{b.source, v}
+}
+
+// Ident resolves a name like an identifier in an expression: defs first, then vars and the
+// identifiers of the config. Labels are referenced with LabelRef.
+func (b *Builder) Ident(name string) ExpressionNode {
+	if expr, ok := b.script.defines[name]; ok {
+		b.script.addReference(SymbolDefine, name, b.source)
+		return expr
+	}
+
+	if offset, ok := b.script.variables[name]; ok {
+		b.script.addReference(SymbolVariable, name, b.source)
+		return &IdentifierNode{b.source, Identifier(offset)}
+	}
+
+	if identifier, ok := b.cfg.Identifiers[name]; ok {
+		b.script.addReference(SymbolIdentifier, name, b.source)
+		return &IdentifierNode{b.source, identifier}
+	}
+
+	b.fail(&UnresolvedSymbolError{name})
+
+	return &IntegerNode{b.source, 0}
+}
+
+// LabelRef references a label, which may be declared later. It is resolved by Build.
+func (b *Builder) LabelRef(name string) *AddressNode {
+	addr := &AddressNode{b.source, 0}
+
+	b.script.addSymbol(name, addr)
+	b.script.addReference(SymbolLabel, name, b.source)
+
+	return addr
+}
+
+// Index accesses an element of an array var.
+func (b *Builder) Index(name string, index ExpressionNode) ExpressionNode {
+	offset, ok := b.script.variables[name]
+
+	if !ok {
+		b.fail(&UnresolvedSymbolError{name})
+		return &IntegerNode{b.source, 0}
+	}
+
+	b.script.addReference(SymbolVariable, name, b.source)
+
+	return &ArrayAccessNode{b.source, Identifier(offset), index}
+}
+
+// operator lexes the source text of an operator, e.g. "<=" or the name of a custom operator.
+func (b *Builder) operator(op string) *Token {
+	tok, err := NewLexer([]byte(op), "").NextToken()
+
+	if err != nil || tok.Value != op {
+		tok = &Token{Type: ILLEGAL, Value: op}
+	}
+
+	return &Token{SourceInfo: b.source, Type: tok.Type, Value: tok.Value}
+}
+
+// Unary applies one of the prefix operators "+", "-", "*", "!", "^" and "&".
+func (b *Builder) Unary(op string, expr ExpressionNode) ExpressionNode {
+	tok := b.operator(op)
+
+	switch tok.Type {
+	case ADD, SUB, MUL, EXCL, INV, AND:
+	default:
+		b.fail(&UnknownOperatorError{tok.Type, op})
+	}
+
+	return &UnaryOpNode{b.source, tok, expr}
+}
+
+// Binary applies a binary operator, given as in source, e.g. "<<" or the name of an operator of
+// the config. Unlike in source, the operands are grouped as given, regardless of precedence.
+func (b *Builder) Binary(left ExpressionNode, op string, right ExpressionNode) ExpressionNode {
+	tok := b.operator(op)
+
+	if _, ok := b.parser.binaryPrecedence(tok); !ok && tok.Type == IDENT {
+		b.fail(&UndefinedOperatorError{tok.Value})
+	} else if !ok {
+		b.fail(&UnknownOperatorError{tok.Type, op})
+	}
+
+	return &BinaryOpNode{b.source, left, tok, right}
+}
+
+// Build resolves all label references and returns the script.
+func (b *Builder) Build() (script *Script, err error) {
+	errs := append(b.errs, augmentAddressNodes(b.script)...)
+
+	errs.sort()
+
+	return b.script, errs.Err()
+}
@@ -0,0 +1,127 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	cfg := printerTestConfig()
+	cfg.CommandTypes["call"] = CmdCall
+	cfg.CommandTypes["ret"] = CmdRet
+	cfg.Identifiers = IdentifierTable{"hp": 1}
+
+	parsed, err := LoadScript([]byte(`var counter
+var list[3]
+def LIMIT 3
+
+main:
+  set counter, 0
+loop:
+  set list[counter], hp * 2
+  set counter, counter + 1
+  jumpIf counter < LIMIT, loop
+  call done
+done:
+  ret
+`), "test.fx", cfg)
+
+	require.NoError(t, err)
+
+	b := NewBuilder(cfg)
+
+	counter := b.Var("counter")
+	b.Array("list", 3)
+	b.Define("LIMIT", b.Int(3))
+
+	b.Label("main")
+	b.Command("set", counter, b.Int(0))
+	b.Label("loop")
+	b.Command("set", b.Index("list", b.Ident("counter")), b.Binary(b.Ident("hp"), "*", b.Int(2)))
+	b.Command("set", counter, b.Binary(counter, "+", b.Int(1)))
+	b.Command("jumpIf", b.Binary(counter, "<", b.Ident("LIMIT")), b.LabelRef("loop"))
+	b.Command("call", b.LabelRef("done"))
+	b.Label("done")
+	b.Emit(CmdRet)
+
+	built, err := b.Build()
+
+	require.NoError(t, err)
+	require.Equal(t, parsed.Labels(), built.Labels())
+	require.Equal(t, parsed.Variables(), built.Variables())
+
+	printer := &Printer{Commands: cfg.CommandTypes, Identifiers: cfg.Identifiers}
+
+	var expected, actual strings.Builder
+
+	require.NoError(t, printer.Fprint(&expected, parsed))
+	require.NoError(t, printer.Fprint(&actual, built))
+	require.Equal(t, expected.String(), actual.String())
+
+	for pc, cmd := range parsed.Commands() {
+		require.Equal(t, cmd.Type, built.Commands()[pc].Type)
+	}
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	b := NewBuilder(printerTestConfig())
+
+	b.At(&SourceInfo{Filename: "level.json", Line: 3})
+	b.Command("spawn")
+	b.Command("set", b.Ident("missing"), b.Unary("~", b.Int(1)))
+	b.Command("jumpIf", b.Binary(b.Int(1), "<>", b.Int(2)), b.LabelRef("nowhere"))
+	b.Command("set", b.Unary("<<", b.Int(1)), b.Binary(b.Int(1), ",", b.Int(2)))
+
+	_, err := b.Build()
+
+	require.EqualError(t, err, `syntax error at level.json:3:0: unknown command: 'spawn'
+syntax error at level.json:3:0: unresolved symbol 'missing'
+syntax error at level.json:3:0: unknown operator: '~'
+syntax error at level.json:3:0: unknown operator: '<>'
+syntax error at level.json:3:0: unknown operator: '<<'
+syntax error at level.json:3:0: unknown operator: ','
+syntax error at level.json:3:0: unknown label: 'nowhere'`)
+}
+
+func TestBuilder_Declarations(t *testing.T) {
+	cfg := printerTestConfig()
+	cfg.CommandTypes["zeta"] = UserCommandOffset + 9
+	cfg.CommandTypes["beta"] = UserCommandOffset + 9
+	cfg.Identifiers = IdentifierTable{"hp": 1}
+
+	b := NewBuilder(cfg)
+
+	b.At(&SourceInfo{Filename: "level.json", Line: 1})
+	b.Var("count")
+	b.Define("LIMIT", b.Int(3))
+	b.Label("start")
+	list := b.Array("list", 3)
+
+	b.At(&SourceInfo{Filename: "level.json", Line: 2})
+	b.Var("count")
+	b.Var("LIMIT")
+	b.Label("start")
+	b.Define("hp", b.Int(1))
+	b.Array("empty", 0)
+	b.Emit(UserCommandOffset+9, list)
+
+	built, err := b.Build()
+
+	require.EqualError(t, err, `syntax error at level.json:2:0: duplicate var 'count', previously declared at level.json:1:0
+syntax error at level.json:2:0: var 'LIMIT' conflicts with def 'LIMIT' declared at level.json:1:0
+syntax error at level.json:2:0: duplicate label 'start', previously declared at level.json:1:0
+syntax error at level.json:2:0: def 'hp' conflicts with identifier 'hp'
+syntax error at level.json:2:0: length 0 of 'empty' is not positive`)
+
+	dimensions, _, ok := built.VariableShape("list")
+
+	require.True(t, ok)
+	require.Equal(t, []int{3}, dimensions)
+
+	_, _, ok = built.VariableShape("count")
+
+	require.False(t, ok)
+	require.Equal(t, "beta", built.commandNames[UserCommandOffset+9])
+}
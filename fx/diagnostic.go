@@ -0,0 +1,222 @@
+package fx
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+type DiagnosticExpansion struct {
+	Macro    string `json:"macro"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// Diagnostic is a renderable description of an error, e.g. a SyntaxError, ParseError or RuntimeError.
+type Diagnostic struct {
+	Severity   Severity               `json:"severity"`
+	Message    string                 `json:"message"`
+	Filename   string                 `json:"filename,omitempty"`
+	Line       int                    `json:"line,omitempty"`
+	Column     int                    `json:"column,omitempty"`
+	Expected   []string               `json:"expected,omitempty"`
+	Expansions []*DiagnosticExpansion `json:"expansions,omitempty"`
+	SourceLine string                 `json:"sourceLine,omitempty"`
+
+	Err error `json:"-"`
+}
+
+type sourceCache struct {
+	fs    *ParserFS
+	files map[string][]string
+}
+
+func (c *sourceCache) line(filename string, line int) (string, bool) {
+	if c.fs == nil || c.fs.FS == nil || filename == "" || line < 1 {
+		return "", false
+	}
+
+	lines, ok := c.files[filename]
+
+	if !ok {
+		if f, err := c.fs.Open(filename); err == nil {
+			if data, err := io.ReadAll(f); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+
+			_ = f.Close()
+		}
+
+		c.files[filename] = lines
+	}
+
+	if line > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// Diagnostics converts err into diagnostics. An ErrorList results in one diagnostic per error.
+// fsys is used to look up the offending source lines and may be nil.
+func Diagnostics(err error, fsys *ParserFS) (diags []*Diagnostic) {
+	cache := &sourceCache{fs: fsys, files: make(map[string][]string)}
+
+	var errs ErrorList
+
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			diags = append(diags, newDiagnostic(e, SeverityError, cache))
+		}
+
+		return
+	}
+
+	if err != nil {
+		diags = append(diags, newDiagnostic(err, SeverityError, cache))
+	}
+
+	return
+}
+
+// SortDiagnostics sorts diagnostics by file and position. Diagnostics without a position keep their
+// order at the start.
+func SortDiagnostics(diags []*Diagnostic) {
+	slices.SortStableFunc(diags, func(a, b *Diagnostic) int {
+		return cmp.Or(
+			cmp.Compare(a.Filename, b.Filename),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Column, b.Column),
+		)
+	})
+}
+
+func NewDiagnostic(err error, severity Severity, fsys *ParserFS) *Diagnostic {
+	return newDiagnostic(err, severity, &sourceCache{fs: fsys, files: make(map[string][]string)})
+}
+
+func newDiagnostic(err error, severity Severity, cache *sourceCache) *Diagnostic {
+	d := &Diagnostic{
+		Severity: severity,
+		Message:  err.Error(),
+		Err:      err,
+	}
+
+	var source *SourceInfo
+
+	switch e := err.(type) {
+	case *SyntaxError:
+		source, d.Message = e.SourceInfo, e.Err.Error()
+	case *ParseError:
+		source, d.Message = e.SourceInfo, e.Err.Error()
+	case *RuntimeError:
+		source, d.Message = e.SourceInfo, e.Err.Error()
+	case *LinkError:
+		source, d.Message = e.SourceInfo, e.Err.Error()
+	default:
+		source = errorSource(err)
+	}
+
+	var unexpected *UnexpectedTokenError
+
+	if errors.As(err, &unexpected) {
+		d.Expected = unexpected.ExpectedNames()
+	}
+
+	if source == nil {
+		return d
+	}
+
+	d.Filename = source.Filename
+	d.Line = source.Line
+	d.Column = source.Column
+
+	for _, e := range source.Expansions() {
+		expansion := &DiagnosticExpansion{Macro: e.Macro}
+
+		if e.CallSite != nil {
+			expansion.Filename = e.CallSite.Filename
+			expansion.Line = e.CallSite.Line
+			expansion.Column = e.CallSite.Column
+		}
+
+		d.Expansions = append(d.Expansions, expansion)
+	}
+
+	d.SourceLine, _ = cache.line(d.Filename, d.Line)
+
+	return d
+}
+
+func (d *Diagnostic) position() string {
+	return (&SourceInfo{Filename: d.Filename, Line: d.Line, Column: d.Column}).Position()
+}
+
+// caret returns a line with a caret under column, keeping tabs of the source line for alignment.
+func caret(sourceLine string, column int) string {
+	b := strings.Builder{}
+
+	for i := 0; i < column-1; i++ {
+		if i < len(sourceLine) && sourceLine[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	b.WriteByte('^')
+
+	return b.String()
+}
+
+func (d *Diagnostic) String() string {
+	buf := &bytes.Buffer{}
+
+	if d.Line > 0 {
+		_, _ = fmt.Fprintf(buf, "%s: %s: %s\n", d.position(), d.Severity, d.Message)
+	} else {
+		_, _ = fmt.Fprintf(buf, "%s: %s\n", d.Severity, d.Message)
+	}
+
+	if d.SourceLine != "" {
+		gutter := fmt.Sprintf("%d", d.Line)
+		padding := strings.Repeat(" ", len(gutter))
+
+		_, _ = fmt.Fprintf(buf, " %s | %s\n", gutter, d.SourceLine)
+		_, _ = fmt.Fprintf(buf, " %s | %s\n", padding, caret(d.SourceLine, d.Column))
+	}
+
+	for _, e := range d.Expansions {
+		if e.Line > 0 {
+			callSite := &SourceInfo{Filename: e.Filename, Line: e.Line, Column: e.Column}
+			_, _ = fmt.Fprintf(buf, "  in macro '%s' expanded at %s\n", e.Macro, callSite.Position())
+		} else {
+			_, _ = fmt.Fprintf(buf, "  in macro '%s'\n", e.Macro)
+		}
+	}
+
+	return buf.String()
+}
+
+// RenderDiagnostics writes all diagnostics for err to w, including the offending source lines.
+func RenderDiagnostics(w io.Writer, err error, fsys *ParserFS) error {
+	for _, d := range Diagnostics(err, fsys) {
+		if _, err := io.WriteString(w, d.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
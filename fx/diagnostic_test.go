@@ -0,0 +1,90 @@
+package fx
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnostics_Render(t *testing.T) {
+	source := "myCmd 1\n\tmyCmd (1 + 2\nunknownCmd\n"
+
+	fsys := NewParserFS(fstest.MapFS{
+		"main.fx": {Data: []byte(source)},
+	})
+
+	cfg := testParserConfig()
+	cfg.FS = fsys
+
+	_, err := LoadFile("main.fx", cfg)
+
+	require.Error(t, err)
+
+	buf := &bytes.Buffer{}
+
+	require.NoError(t, RenderDiagnostics(buf, err, fsys))
+
+	expected := "main.fx:2:14: error: unexpected end of line, expected ')'\n" +
+		" 2 | \tmyCmd (1 + 2\n" +
+		"   | \t            ^\n" +
+		"main.fx:3:1: error: unknown command: 'unknownCmd'\n" +
+		" 3 | unknownCmd\n" +
+		"   | ^\n"
+
+	require.Equal(t, expected, buf.String())
+}
+
+func TestDiagnostics_Caret(t *testing.T) {
+	d := &Diagnostic{
+		Severity:   SeverityError,
+		Message:    "oops",
+		Filename:   "main.fx",
+		Line:       12,
+		Column:     9,
+		SourceLine: "\tset A, B +",
+	}
+
+	require.Equal(t, "main.fx:12:9: error: oops\n 12 | \tset A, B +\n    | \t       ^\n", d.String())
+}
+
+func TestDiagnostics_JSON(t *testing.T) {
+	_, err := LoadScript([]byte("macro m\n\tmyCmd )\nendmacro\nm\n"), "", testParserConfig())
+
+	diags := Diagnostics(err, nil)
+
+	require.Len(t, diags, 1)
+
+	data, err := json.Marshal(diags[0])
+
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"severity": "error",
+		"message": "unexpected ')', expected one of end of line, ']', '+', '-', '*', '!', '^', '&', '(', number, string, identifier",
+		"line": 2,
+		"column": 8,
+		"expected": ["end of line", "']'", "'+'", "'-'", "'*'", "'!'", "'^'", "'&'", "'('", "number", "string", "identifier"],
+		"expansions": [{"macro": "m", "line": 4, "column": 1}]
+	}`, string(data))
+}
+
+func TestDiagnostics_Sort(t *testing.T) {
+	diags := []*Diagnostic{
+		{Message: "c", Filename: "main.fx", Line: 3, Column: 1},
+		{Message: "b", Filename: "main.fx", Line: 1, Column: 7},
+		{Message: "d", Filename: "util.fx", Line: 1, Column: 1},
+		{Message: "a", Filename: "main.fx", Line: 1, Column: 2},
+	}
+
+	SortDiagnostics(diags)
+
+	messages := make([]string, len(diags))
+
+	for i, d := range diags {
+		messages[i] = d.Message
+	}
+
+	require.Equal(t, []string{"a", "b", "c", "d"}, messages)
+}
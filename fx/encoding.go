@@ -0,0 +1,699 @@
+package fx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"slices"
+)
+
+// A compiled script starts with EncodingMagic, the format version and flags. The string table,
+// the source table and the script follow, and a CRC-32 checksum of everything before it ends the
+// file.
+const (
+	EncodingMagic   = "FXC\x00"
+	EncodingVersion = 5
+)
+
+const (
+	encodingFlagSourceInfo uint16 = 1 << iota
+)
+
+const (
+	encodingHeaderSize   = len(EncodingMagic) + 4
+	encodingChecksumSize = 4
+)
+
+// maxDecodeDepth limits the nesting of decoded expressions, so corrupted data can't exhaust the
+// stack.
+const maxDecodeDepth = 10000
+
+const (
+	nodeNil byte = iota
+	nodeInteger
+	nodeFloat
+	nodeString
+	nodeIdentifier
+	nodeAddress
+	nodeUnaryOp
+	nodeBinaryOp
+	nodeArrayAccess
+	nodeIndexCheck
+)
+
+type EncodeOptions struct {
+	// SourceInfo keeps filenames, positions and macro expansions, so errors of the decoded script
+	// point to the source.
+	SourceInfo bool
+}
+
+type encoder struct {
+	opts *EncodeOptions
+
+	strings     map[string]int
+	stringTable []string
+
+	sources     map[*SourceInfo]int
+	sourceTable []byte
+	sourceCount int
+
+	err error
+}
+
+func appendInt(buf []byte, v int) []byte {
+	return binary.AppendVarint(buf, int64(v))
+}
+
+func appendUint(buf []byte, v int) []byte {
+	return binary.AppendUvarint(buf, uint64(v))
+}
+
+func (e *encoder) appendString(buf []byte, s string) []byte {
+	index, ok := e.strings[s]
+
+	if !ok {
+		index = len(e.stringTable)
+
+		e.strings[s] = index
+		e.stringTable = append(e.stringTable, s)
+	}
+
+	return appendUint(buf, index)
+}
+
+// sourceIndex adds a source info to the source table. 0 stands for no source info, macro call
+// sites are added before the sources expanded from them.
+func (e *encoder) sourceIndex(s *SourceInfo) int {
+	if s == nil || !e.opts.SourceInfo {
+		return 0
+	}
+
+	if index, ok := e.sources[s]; ok {
+		return index
+	}
+
+	callSite := 0
+
+	if s.Expansion != nil {
+		callSite = e.sourceIndex(s.Expansion.CallSite)
+	}
+
+	e.sourceTable = e.appendString(e.sourceTable, s.Filename)
+	e.sourceTable = appendInt(e.sourceTable, s.Line)
+	e.sourceTable = appendInt(e.sourceTable, s.Column)
+
+	if s.Expansion == nil {
+		e.sourceTable = append(e.sourceTable, 0)
+	} else {
+		e.sourceTable = append(e.sourceTable, 1)
+		e.sourceTable = e.appendString(e.sourceTable, s.Expansion.Macro)
+		e.sourceTable = appendUint(e.sourceTable, callSite)
+	}
+
+	e.sourceCount++
+	e.sources[s] = e.sourceCount
+
+	return e.sourceCount
+}
+
+func (e *encoder) appendSource(buf []byte, s *SourceInfo) []byte {
+	return appendUint(buf, e.sourceIndex(s))
+}
+
+func (e *encoder) appendToken(buf []byte, tok *Token) []byte {
+	buf = appendUint(buf, int(tok.Type))
+	buf = e.appendString(buf, tok.Value)
+
+	return e.appendSource(buf, tok.SourceInfo)
+}
+
+func (e *encoder) appendExpression(buf []byte, expr ExpressionNode) []byte {
+	switch n := expr.(type) {
+	case nil:
+		return append(buf, nodeNil)
+	case *IntegerNode:
+		buf = e.appendSource(append(buf, nodeInteger), n.SourceInfo)
+		return appendInt(buf, n.Value)
+	case *FloatNode:
+		buf = e.appendSource(append(buf, nodeFloat), n.SourceInfo)
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(n.Value))
+	case *StringNode:
+		buf = e.appendSource(append(buf, nodeString), n.SourceInfo)
+		return e.appendString(buf, n.Value)
+	case *IdentifierNode:
+		buf = e.appendSource(append(buf, nodeIdentifier), n.SourceInfo)
+		return appendInt(buf, int(n.Identifier))
+	case *AddressNode:
+		buf = e.appendSource(append(buf, nodeAddress), n.SourceInfo)
+		return appendInt(buf, n.Address)
+	case *UnaryOpNode:
+		buf = e.appendSource(append(buf, nodeUnaryOp), n.SourceInfo)
+		buf = e.appendToken(buf, n.Operator)
+		return e.appendExpression(buf, n.Expr)
+	case *BinaryOpNode:
+		buf = e.appendSource(append(buf, nodeBinaryOp), n.SourceInfo)
+		buf = e.appendToken(buf, n.Operator)
+		buf = e.appendExpression(buf, n.Left)
+		return e.appendExpression(buf, n.Right)
+	case *ArrayAccessNode:
+		buf = e.appendSource(append(buf, nodeArrayAccess), n.SourceInfo)
+		buf = appendInt(buf, int(n.Variable))
+		return e.appendExpression(buf, n.Index)
+	case *IndexCheckNode:
+		buf = e.appendSource(append(buf, nodeIndexCheck), n.SourceInfo)
+		buf = e.appendString(buf, n.Variable)
+		buf = appendInt(buf, n.Length)
+		return e.appendExpression(buf, n.Index)
+	}
+
+	if e.err == nil {
+		e.err = &EncodingError{fmt.Sprintf("unsupported expression node %T", expr)}
+	}
+
+	return buf
+}
+
+// EncodeScript writes the compiled form of a script, including its structs and the dimensions of
+// its vars. Macros and the symbol information used by tools are not part of it. opts may be nil.
+func EncodeScript(w io.Writer, s *Script, opts *EncodeOptions) (err error) {
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+
+	e := &encoder{
+		opts:    opts,
+		strings: make(map[string]int),
+		sources: make(map[*SourceInfo]int),
+	}
+
+	var body []byte
+
+	body = appendUint(body, len(s.commandNames))
+
+	for _, typ := range slices.Sorted(maps.Keys(s.commandNames)) {
+		body = appendInt(body, int(typ))
+		body = e.appendString(body, s.commandNames[typ])
+	}
+
+	body = appendUint(body, len(s.commands))
+
+	for _, cmd := range s.commands {
+		if _, ok := s.commandNames[cmd.Type]; !ok && cmd.Type >= UserCommandOffset && e.err == nil {
+			e.err = &EncodingError{fmt.Sprintf("command type %d has no name", cmd.Type)}
+		}
+
+		body = appendInt(body, int(cmd.Type))
+		body = e.appendSource(body, cmd.SourceInfo)
+		body = appendUint(body, len(cmd.Args))
+
+		for _, arg := range cmd.Args {
+			body = e.appendExpression(body, arg)
+		}
+	}
+
+	body = appendUint(body, len(s.labels))
+
+	for _, name := range slices.Sorted(maps.Keys(s.labels)) {
+		body = e.appendString(body, name)
+		body = appendInt(body, s.labels[name])
+	}
+
+	body = appendUint(body, len(s.variableNames))
+
+	for _, offset := range slices.Sorted(maps.Keys(s.variableNames)) {
+		body = e.appendString(body, s.variableNames[offset])
+		body = appendInt(body, offset)
+		body = appendInt(body, s.variableSizes[offset])
+	}
+
+	body = appendUint(body, len(s.initialValues))
+
+	for _, addr := range slices.Sorted(maps.Keys(s.initialValues)) {
+		body = appendInt(body, addr)
+		body = appendInt(body, s.initialValues[addr])
+	}
+
+	body = appendUint(body, len(s.readOnly))
+
+	for _, addr := range slices.Sorted(maps.Keys(s.readOnly)) {
+		body = appendInt(body, addr)
+	}
+
+	body = appendUint(body, len(s.defines))
+
+	for _, name := range slices.Sorted(maps.Keys(s.defines)) {
+		body = e.appendString(body, name)
+		body = e.appendExpression(body, s.defines[name])
+	}
+
+	body = appendUint(body, len(s.structs))
+
+	for _, name := range slices.Sorted(maps.Keys(s.structs)) {
+		layout := s.structs[name]
+
+		body = e.appendString(body, name)
+		body = appendInt(body, layout.Size)
+		body = appendUint(body, len(layout.Fields))
+
+		for _, field := range layout.Fields {
+			body = e.appendString(body, field.Name)
+			body = appendInt(body, field.Offset)
+			body = appendInt(body, field.Length)
+		}
+	}
+
+	body = appendUint(body, len(s.shapes))
+
+	for _, name := range slices.Sorted(maps.Keys(s.shapes)) {
+		shape := s.shapes[name]
+
+		body = e.appendString(body, name)
+
+		if shape.layout != nil {
+			body = e.appendString(body, shape.layout.Name)
+		} else {
+			body = e.appendString(body, "")
+		}
+
+		body = appendUint(body, len(shape.dimensions))
+
+		for _, d := range shape.dimensions {
+			body = appendInt(body, d)
+		}
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+
+	var flags uint16
+
+	if opts.SourceInfo {
+		flags |= encodingFlagSourceInfo
+	}
+
+	data := []byte(EncodingMagic)
+	data = binary.LittleEndian.AppendUint16(data, EncodingVersion)
+	data = binary.LittleEndian.AppendUint16(data, flags)
+
+	data = appendUint(data, len(e.stringTable))
+
+	for _, str := range e.stringTable {
+		data = appendUint(data, len(str))
+		data = append(data, str...)
+	}
+
+	data = appendUint(data, e.sourceCount)
+	data = append(data, e.sourceTable...)
+	data = append(data, body...)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	_, err = w.Write(data)
+
+	return
+}
+
+// MarshalBinary encodes the script with source info, see EncodeScript.
+func (s *Script) MarshalBinary() (data []byte, err error) {
+	var buf bytes.Buffer
+
+	if err = EncodeScript(&buf, s, &EncodeOptions{SourceInfo: true}); err != nil {
+		return
+	}
+
+	return buf.Bytes(), nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+
+	strings []string
+	sources []*SourceInfo
+
+	// depth is the nesting of the expression that is decoded
+	depth int
+
+	err error
+}
+
+func (d *decoder) fail(reason string) {
+	if d.err == nil {
+		d.err = &EncodingError{reason}
+	}
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data[d.offset:])
+
+	if n <= 0 || v > math.MaxInt32 {
+		d.fail(fmt.Sprintf("malformed number at offset %d", d.offset))
+		return 0
+	}
+
+	d.offset += n
+
+	return int(v)
+}
+
+func (d *decoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data[d.offset:])
+
+	if n <= 0 {
+		d.fail(fmt.Sprintf("malformed number at offset %d", d.offset))
+		return 0
+	}
+
+	d.offset += n
+
+	return int(v)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	if d.offset >= len(d.data) {
+		d.fail("unexpected end of data")
+		return 0
+	}
+
+	d.offset++
+
+	return d.data[d.offset-1]
+}
+
+// count reads the length of a list. Every element takes at least one byte, which bounds the
+// allocations for corrupted lengths.
+func (d *decoder) count() int {
+	n := d.uint()
+
+	if n > len(d.data)-d.offset {
+		d.fail(fmt.Sprintf("list length %d exceeds the data", n))
+		return 0
+	}
+
+	return n
+}
+
+func (d *decoder) string() string {
+	index := d.uint()
+
+	if index >= len(d.strings) {
+		d.fail(fmt.Sprintf("unknown string %d", index))
+		return ""
+	}
+
+	return d.strings[index]
+}
+
+func (d *decoder) source() *SourceInfo {
+	index := d.uint()
+
+	if index > len(d.sources) {
+		d.fail(fmt.Sprintf("unknown source %d", index))
+		return nil
+	}
+
+	if index == 0 {
+		return nil
+	}
+
+	return d.sources[index-1]
+}
+
+func (d *decoder) token() *Token {
+	return &Token{
+		Type:       TokenType(d.uint()),
+		Value:      d.string(),
+		SourceInfo: d.source(),
+	}
+}
+
+func (d *decoder) expression() ExpressionNode {
+	tag := d.byte()
+
+	if tag == nodeNil || d.err != nil {
+		return nil
+	}
+
+	if d.depth >= maxDecodeDepth {
+		d.fail(fmt.Sprintf("expression nested deeper than %d", maxDecodeDepth))
+		return nil
+	}
+
+	d.depth++
+
+	defer func() {
+		d.depth--
+	}()
+
+	source := d.source()
+
+	switch tag {
+	case nodeInteger:
+		return &IntegerNode{source, d.int()}
+	case nodeFloat:
+		if d.offset+8 > len(d.data) {
+			d.fail("unexpected end of data")
+			return nil
+		}
+
+		d.offset += 8
+
+		return &FloatNode{source, math.Float64frombits(binary.LittleEndian.Uint64(d.data[d.offset-8:]))}
+	case nodeString:
+		return &StringNode{source, d.string()}
+	case nodeIdentifier:
+		return &IdentifierNode{source, Identifier(d.int())}
+	case nodeAddress:
+		return &AddressNode{source, d.int()}
+	case nodeUnaryOp:
+		n := &UnaryOpNode{SourceInfo: source, Operator: d.token()}
+		n.Expr = d.expression()
+
+		return n
+	case nodeBinaryOp:
+		n := &BinaryOpNode{SourceInfo: source, Operator: d.token()}
+		n.Left = d.expression()
+		n.Right = d.expression()
+
+		return n
+	case nodeArrayAccess:
+		n := &ArrayAccessNode{SourceInfo: source, Variable: Identifier(d.int())}
+		n.Index = d.expression()
+
+		return n
+	case nodeIndexCheck:
+		n := &IndexCheckNode{SourceInfo: source, Variable: d.string(), Length: d.int()}
+		n.Index = d.expression()
+
+		return n
+	}
+
+	d.fail(fmt.Sprintf("unknown expression node %d", tag))
+
+	return nil
+}
+
+// DecodeScript loads a script written by EncodeScript without lexing or parsing it. Only the
+// Operators and CommandTypes of cfg are used and cfg may be nil.
+//
+// User commands are stored by name. With CommandTypes, they get the types of the table and a
+// command that is not in it is an UnknownCommandError. Otherwise they keep the types they were
+// compiled with.
+func DecodeScript(data []byte, cfg *ParserConfig) (script *Script, err error) {
+	if len(data) < encodingHeaderSize+encodingChecksumSize || string(data[:len(EncodingMagic)]) != EncodingMagic {
+		return nil, &EncodingError{"missing header"}
+	}
+
+	payloadEnd := len(data) - encodingChecksumSize
+	expected := binary.LittleEndian.Uint32(data[payloadEnd:])
+
+	if got := crc32.ChecksumIEEE(data[:payloadEnd]); got != expected {
+		return nil, &ChecksumError{expected, got}
+	}
+
+	if version := binary.LittleEndian.Uint16(data[len(EncodingMagic):]); version != EncodingVersion {
+		return nil, &VersionError{version, EncodingVersion}
+	}
+
+	d := &decoder{
+		data:   data[:payloadEnd],
+		offset: encodingHeaderSize,
+	}
+
+	for range d.count() {
+		n := d.uint()
+
+		if d.err == nil && n > len(d.data)-d.offset {
+			d.fail("string exceeds the data")
+		}
+
+		if d.err != nil {
+			break
+		}
+
+		d.strings = append(d.strings, string(d.data[d.offset:d.offset+n]))
+		d.offset += n
+	}
+
+	for range d.count() {
+		s := &SourceInfo{
+			Filename: d.string(),
+			Line:     d.int(),
+			Column:   d.int(),
+		}
+
+		if d.byte() != 0 {
+			s.Expansion = &Expansion{Macro: d.string()}
+			s.Expansion.CallSite = d.source()
+		}
+
+		if d.err != nil {
+			break
+		}
+
+		d.sources = append(d.sources, s)
+	}
+
+	script = newScript()
+
+	if cfg != nil {
+		script.operators = cfg.Operators
+	}
+
+	types := make(map[CommandType]CommandType)
+
+	for range d.count() {
+		typ := CommandType(d.int())
+		name := d.string()
+
+		if d.err != nil {
+			break
+		}
+
+		if typ < UserCommandOffset {
+			d.fail(fmt.Sprintf("command table contains built-in type %d", typ))
+			break
+		}
+
+		types[typ] = typ
+
+		if cfg != nil && cfg.CommandTypes != nil {
+			var ok bool
+
+			if types[typ], ok = cfg.CommandTypes[name]; !ok {
+				return nil, &UnknownCommandError{name}
+			}
+		}
+
+		script.commandNames[types[typ]] = name
+	}
+
+	for range d.count() {
+		cmd := &CommandNode{
+			Type:       CommandType(d.int()),
+			SourceInfo: d.source(),
+		}
+
+		if typ, ok := types[cmd.Type]; ok {
+			cmd.Type = typ
+		} else if cmd.Type >= UserCommandOffset {
+			d.fail(fmt.Sprintf("command type %d is not in the command table", cmd.Type))
+		}
+
+		for range d.count() {
+			cmd.Args = append(cmd.Args, d.expression())
+		}
+
+		if d.err != nil {
+			break
+		}
+
+		script.commands = append(script.commands, cmd)
+	}
+
+	for range d.count() {
+		name := d.string()
+		script.labels[name] = d.int()
+	}
+
+	for range d.count() {
+		name := d.string()
+		script.addVariableWithOffset(name, d.int(), d.int())
+	}
+
+	for range d.count() {
+		addr := d.int()
+		script.initialValues[addr] = d.int()
+	}
+
+	for range d.count() {
+		script.readOnly[d.int()] = true
+	}
+
+	for range d.count() {
+		name := d.string()
+		script.defines[name] = d.expression()
+	}
+
+	for range d.count() {
+		layout := &Struct{Name: d.string(), Size: d.int()}
+
+		for range d.count() {
+			layout.Fields = append(layout.Fields, &StructField{Name: d.string(), Offset: d.int(), Length: d.int()})
+		}
+
+		if d.err != nil {
+			break
+		}
+
+		script.structs[layout.Name] = layout
+	}
+
+	for range d.count() {
+		name := d.string()
+		layoutName := d.string()
+		shape := &variableShape{}
+
+		if layoutName != "" {
+			if shape.layout = script.structs[layoutName]; shape.layout == nil {
+				d.fail(fmt.Sprintf("var '%s' has unknown struct '%s'", name, layoutName))
+			}
+		}
+
+		for range d.count() {
+			shape.dimensions = append(shape.dimensions, d.int())
+		}
+
+		if d.err != nil {
+			break
+		}
+
+		script.shapes[name] = shape
+	}
+
+	if d.err == nil && d.offset != len(d.data) {
+		d.fail(fmt.Sprintf("%d trailing bytes", len(d.data)-d.offset))
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return
+}
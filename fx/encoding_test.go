@@ -0,0 +1,173 @@
+package fx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeScript(t *testing.T) {
+	cfg := printerTestConfig()
+	s, err := LoadScript([]byte(printerTestScript+"def HALF 0.5\nset counter, \"text\"\n"), "test.fx", cfg)
+
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, EncodeScript(&buf, s, nil))
+
+	decoded, err := DecodeScript(buf.Bytes(), cfg)
+
+	require.NoError(t, err)
+	require.Len(t, decoded.Commands(), len(s.Commands()))
+	require.Nil(t, decoded.Commands()[0].SourceInfo)
+	require.Equal(t, s.Labels(), decoded.Labels())
+	require.Equal(t, s.Variables(), decoded.Variables())
+	require.Equal(t, &FloatNode{Value: 0.5}, decoded.Defines()["HALF"])
+
+	for i, cmd := range s.Commands() {
+		require.Equal(t, cmd.String(), (&CommandNode{cmd.SourceInfo, decoded.Commands()[i].Type, decoded.Commands()[i].Args}).String())
+	}
+
+	data, err := s.MarshalBinary()
+
+	require.NoError(t, err)
+
+	decoded, err = DecodeScript(data, cfg)
+
+	require.NoError(t, err)
+	require.Equal(t, s.Commands(), decoded.Commands())
+}
+
+func TestDecodeScript_Invalid(t *testing.T) {
+	s, err := LoadScript([]byte(printerTestScript), "test.fx", printerTestConfig())
+
+	require.NoError(t, err)
+
+	data, err := s.MarshalBinary()
+
+	require.NoError(t, err)
+
+	_, err = DecodeScript([]byte("var counter\n"), nil)
+
+	var encodingErr *EncodingError
+
+	require.ErrorAs(t, err, &encodingErr)
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	_, err = DecodeScript(corrupted, nil)
+
+	var checksumErr *ChecksumError
+
+	require.ErrorAs(t, err, &checksumErr)
+
+	future := bytes.Clone(data[:len(data)-4])
+	binary.LittleEndian.PutUint16(future[len(EncodingMagic):], EncodingVersion+1)
+	future = binary.LittleEndian.AppendUint32(future, crc32.ChecksumIEEE(future))
+
+	_, err = DecodeScript(future, nil)
+
+	require.EqualError(t, err, "compiled script has version 6, supported is version 5")
+
+	truncated := bytes.Clone(data[:len(data)/2])
+	truncated = binary.LittleEndian.AppendUint32(truncated, crc32.ChecksumIEEE(truncated))
+
+	_, err = DecodeScript(truncated, nil)
+
+	require.ErrorAs(t, err, &encodingErr)
+}
+
+func TestDecodeScript_CommandTypes(t *testing.T) {
+	cfg := &ParserConfig{CommandTypes: CommandTypeTable{
+		"set":  CmdSet,
+		"heal": UserCommandOffset,
+		"hit":  UserCommandOffset + 1,
+	}}
+
+	s, err := LoadScript([]byte("var hp\nheal hp, 5\nhit hp\nset hp, 1\n"), "test.fx", cfg)
+
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, EncodeScript(&buf, s, nil))
+
+	decoded, err := DecodeScript(buf.Bytes(), &ParserConfig{CommandTypes: CommandTypeTable{
+		"set":  CmdSet,
+		"hit":  UserCommandOffset + 3,
+		"heal": UserCommandOffset + 7,
+	}})
+
+	require.NoError(t, err)
+	require.Equal(t, UserCommandOffset+7, decoded.Commands()[0].Type)
+	require.Equal(t, UserCommandOffset+3, decoded.Commands()[1].Type)
+	require.Equal(t, CmdSet, decoded.Commands()[2].Type)
+
+	decoded, err = DecodeScript(buf.Bytes(), nil)
+
+	require.NoError(t, err)
+	require.Equal(t, s.Commands()[0].Type, decoded.Commands()[0].Type)
+
+	_, err = DecodeScript(buf.Bytes(), &ParserConfig{CommandTypes: CommandTypeTable{"set": CmdSet, "heal": UserCommandOffset}})
+
+	require.EqualError(t, err, "unknown command: 'hit'")
+
+	b := NewBuilder(&ParserConfig{})
+	b.Emit(UserCommandOffset)
+
+	_, err = b.Build()
+
+	require.EqualError(t, err, fmt.Sprintf("syntax error at <unknown>: unknown command: '%d'", UserCommandOffset))
+}
+
+func TestEncodeScript_Shapes(t *testing.T) {
+	s, err := LoadScript([]byte("struct Enemy hp, pos[2]\nendstruct\nvar grid[3][4]\nvar es: Enemy[2]\nvar boss: Enemy\nvar plain\n"), "test.fx", &ParserConfig{})
+
+	require.NoError(t, err)
+
+	data, err := s.MarshalBinary()
+
+	require.NoError(t, err)
+
+	decoded, err := DecodeScript(data, nil)
+
+	require.NoError(t, err)
+	require.Equal(t, s.Structs(), decoded.Structs())
+
+	dimensions, layout, ok := decoded.VariableShape("es")
+
+	require.True(t, ok)
+	require.Equal(t, []int{2}, dimensions)
+	require.Same(t, decoded.Structs()["Enemy"], layout)
+
+	dimensions, layout, ok = decoded.VariableShape("grid")
+
+	require.True(t, ok)
+	require.Equal(t, []int{3, 4}, dimensions)
+	require.Nil(t, layout)
+
+	_, _, ok = decoded.VariableShape("plain")
+
+	require.False(t, ok)
+}
+
+func TestDecodeScript_Depth(t *testing.T) {
+	s, err := LoadScript([]byte("def DEEP 1"+strings.Repeat(" + 1", maxDecodeDepth)+"\n"), "test.fx", &ParserConfig{})
+
+	require.NoError(t, err)
+
+	data, err := s.MarshalBinary()
+
+	require.NoError(t, err)
+
+	_, err = DecodeScript(data, nil)
+
+	require.EqualError(t, err, fmt.Sprintf("invalid compiled script: expression nested deeper than %d", maxDecodeDepth))
+}
@@ -248,6 +248,10 @@ func (s *Script) evalBinaryOp(n *BinaryOpNode, getValue IdentifierValueRetriever
 		return
 	}
 
+	if n.Operator.Type == IDENT {
+		return s.evalCustomBinaryOp(n, left, right)
+	}
+
 	var ok bool
 
 	var iRight *int
@@ -301,6 +305,21 @@ func (s *Script) evalBinaryOp(n *BinaryOpNode, getValue IdentifierValueRetriever
 	return
 }
 
+func (s *Script) evalCustomBinaryOp(n *BinaryOpNode, left, right any) (result any, err error) {
+	op, ok := s.operators[n.Operator.Value]
+
+	if !ok || op.Fn == nil {
+		err = &RuntimeError{n.Operator.SourceInfo, &UndefinedOperatorError{n.Operator.Value}}
+		return
+	}
+
+	if result, err = op.Fn(left, right); err != nil {
+		err = &RuntimeError{n.Operator.SourceInfo, err}
+	}
+
+	return
+}
+
 func (s *Script) EvalArrayAccessAddress(n *ArrayAccessNode, getValue IdentifierValueRetriever) (addr int, err error) {
 	index, err := s.Eval(n.Index, getValue)
 
@@ -315,24 +334,20 @@ func (s *Script) EvalArrayAccessAddress(n *ArrayAccessNode, getValue IdentifierV
 		return
 	}
 
-	baseVarName, ok := s.variableNames[int(n.Variable)]
+	size, ok := s.variableSizes[int(n.Variable)]
 
 	if !ok {
 		err = &RuntimeError{n.SourceInfo, &UnresolvedSymbolError{fmt.Sprintf("%d", n.Variable)}}
 		return
 	}
 
-	if indexInt > 0 {
-		addr, ok = s.variables[fmt.Sprintf("__%s_%d", baseVarName, indexInt)]
-
-		if !ok {
-			err = &RuntimeError{n.SourceInfo, &UnresolvedSymbolError{fmt.Sprintf("%d+%d", n.Variable, indexInt)}}
-			return
-		}
-	} else {
-		addr = int(n.Variable)
+	if indexInt < 0 || indexInt >= size {
+		err = &RuntimeError{n.SourceInfo, &IndexOutOfRangeError{n.SourceInfo, s.variableNames[int(n.Variable)], indexInt, size}}
+		return
 	}
 
+	addr = int(n.Variable) + indexInt
+
 	return
 }
 
@@ -348,6 +363,25 @@ func (s *Script) evalArrayAccess(n *ArrayAccessNode, getValue IdentifierValueRet
 	return
 }
 
+func (s *Script) evalIndexCheck(n *IndexCheckNode, getValue IdentifierValueRetriever) (v any, err error) {
+	if v, err = s.Eval(n.Index, getValue); err != nil {
+		return
+	}
+
+	index, ok := v.(int)
+
+	if !ok {
+		err = &RuntimeError{n.SourceInfo, &UnexpectedTypeError{fmt.Sprintf("%T", v)}}
+		return
+	}
+
+	if index < 0 || index >= n.Length {
+		err = &RuntimeError{n.SourceInfo, &IndexOutOfRangeError{n.SourceInfo, n.Variable, index, n.Length}}
+	}
+
+	return
+}
+
 func (s *Script) Eval(node ExpressionNode, getValue IdentifierValueRetriever) (v any, err error) {
 	switch n := node.(type) {
 	case *BinaryOpNode:
@@ -366,6 +400,12 @@ func (s *Script) Eval(node ExpressionNode, getValue IdentifierValueRetriever) (v
 		v = n.Address
 	case *ArrayAccessNode:
 		v, err = s.evalArrayAccess(n, getValue)
+	case *IndexCheckNode:
+		v, err = s.evalIndexCheck(n, getValue)
+	case *ImportNode:
+		err = &UnresolvedSymbolError{n.Module + "." + n.Name}
+	case EvaluableNode:
+		v, err = n.Eval(s, getValue)
 	}
 
 	return
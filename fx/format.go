@@ -0,0 +1,582 @@
+package fx
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const formatIndent = "  "
+
+// formatSegment is a physical line of a statement. Statements span multiple segments when
+// lines are continued with a trailing '\'.
+type formatSegment struct {
+	tokens  []*Token
+	comment string
+}
+
+type formatBlock struct {
+	indent   int
+	labelled bool
+}
+
+type formatter struct {
+	out bytes.Buffer
+
+	blocks []*formatBlock
+
+	// comment and blank lines are indented like the statement following them
+	pending  []string
+	hasBlank bool
+}
+
+// splitLine separates the code of a line from its comment and trailing continuation marker.
+// Directives run until the end of the line, so they never carry a comment.
+func splitLine(line string) (code string, comment string, continued bool) {
+	code = line
+	inString := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		if c == '"' {
+			inString = !inString
+		} else if !inString && c == '@' {
+			return
+		} else if !inString && c == '#' {
+			code, comment = line[:i], strings.TrimRight(line[i:], " \t")
+			break
+		}
+	}
+
+	trimmed := strings.TrimRight(code, " \t")
+
+	if strings.HasSuffix(trimmed, "\\") {
+		code, continued = trimmed[:len(trimmed)-1], true
+	}
+
+	return
+}
+
+func lexSegment(code string, filename string, line int) (tokens []*Token, err error) {
+	l := NewLexer([]byte(code), filename)
+	l.line = line
+
+	for {
+		tok := l.lexNextToken()
+
+		switch tok.Type {
+		case EOF:
+			return
+		case ILLEGAL:
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{Token: tok}}
+			return
+		}
+
+		tokens = append(tokens, tok)
+	}
+}
+
+func tokenText(tok *Token) string {
+	switch tok.Type {
+	case STRING:
+		return `"` + tok.Value + `"`
+	case PREPROCESSOR:
+		return "@" + strings.TrimRight(tok.Value, " \t")
+	case DEF:
+		return "def"
+	case VAR:
+		return "var"
+	case MACRO:
+		return "macro"
+	case ENDMACRO:
+		return "endmacro"
+	case IMPORT:
+		return "import"
+	case EXPORT:
+		return "export"
+	case NAMESPACE:
+		return "namespace"
+	case ENDNAMESPACE:
+		return "endnamespace"
+	case USING:
+		return "using"
+	case STRUCT:
+		return "struct"
+	case ENDSTRUCT:
+		return "endstruct"
+	case DATA:
+		return "data"
+	case ENDDATA:
+		return "enddata"
+	}
+
+	if tok.Value != "" {
+		return tok.Value
+	}
+
+	return tokenSymbols[tok.Type]
+}
+
+func isOperand(tok *Token) bool {
+	switch tok.Type {
+	case IDENT, NUMBER, STRING, RPAREN, RBRACKET:
+		return true
+	}
+
+	return false
+}
+
+func isPrefixOperator(tok *Token) bool {
+	switch tok.Type {
+	case ADD, SUB, MUL, AND, EXCL, INV, PERCENT:
+		return true
+	}
+
+	return false
+}
+
+// formatTokens renders the tokens of a statement with canonical spacing.
+func formatTokens(tokens []*Token) []string {
+	texts := make([]string, len(tokens))
+	unary := make([]bool, len(tokens))
+
+	// the first argument of a command and the value of a def start a new operand
+	operandStart := 1
+
+	if len(tokens) > 0 && tokens[0].Type == DEF {
+		operandStart = 2
+	}
+
+	for i, tok := range tokens {
+		var prev *Token
+
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+
+		unary[i] = isPrefixOperator(tok) && (prev == nil || i == operandStart || !isOperand(prev))
+
+		space := prev != nil
+
+		switch {
+		case prev == nil:
+		case tok.Type == COMMA, tok.Type == COLON, tok.Type == RPAREN, tok.Type == RBRACKET, tok.Type == RBRACE, tok.Type == ELLIPSIS, tok.Type == DOT:
+			space = false
+		case prev.Type == LPAREN, prev.Type == LBRACKET, prev.Type == LBRACE, prev.Type == DOLLAR, prev.Type == DOT, unary[i-1]:
+			space = false
+		case tok.Type == LBRACKET && isOperand(prev):
+			space = false
+		}
+
+		if space {
+			texts[i] = " " + tokenText(tok)
+		} else {
+			texts[i] = tokenText(tok)
+		}
+	}
+
+	return texts
+}
+
+func (f *formatter) block() *formatBlock {
+	return f.blocks[len(f.blocks)-1]
+}
+
+func (f *formatter) statementIndent() int {
+	b := f.block()
+
+	if b.labelled {
+		return b.indent + 1
+	}
+
+	return b.indent
+}
+
+func (f *formatter) open(indent int) {
+	f.blocks = append(f.blocks, &formatBlock{indent: indent + 1})
+}
+
+func (f *formatter) close() {
+	if len(f.blocks) > 1 {
+		f.blocks = f.blocks[:len(f.blocks)-1]
+	}
+}
+
+// indent returns the indentation of a statement and updates the block structure.
+func (f *formatter) indent(tokens []*Token) (indent int) {
+	first := tokens[0]
+
+	switch first.Type {
+	case MACRO, NAMESPACE:
+		indent = f.statementIndent()
+		f.open(indent)
+		return
+	case STRUCT, DATA:
+		indent = f.statementIndent()
+
+		// fields and values may follow on the same line, up to the end of the block
+		if last := tokens[len(tokens)-1].Type; last != ENDSTRUCT && last != ENDDATA {
+			f.open(indent)
+		}
+
+		return
+	case ENDMACRO, ENDNAMESPACE, ENDSTRUCT, ENDDATA:
+		f.close()
+		return f.statementIndent()
+	case PREPROCESSOR:
+		switch directiveName(first.Value) {
+		case "if", "ifdef", "ifndef", "for":
+			indent = f.statementIndent()
+			f.open(indent)
+			return
+		case "else":
+			f.close()
+			indent = f.statementIndent()
+			f.open(indent)
+			return
+		case "endif", "endfor":
+			f.close()
+			return f.statementIndent()
+		}
+	case IDENT, PERCENT:
+		label := (first.Type == IDENT && len(tokens) > 1 && tokens[1].Type == COLON) ||
+			(first.Type == PERCENT && len(tokens) > 2 && tokens[1].Type == IDENT && tokens[2].Type == COLON)
+
+		if label {
+			f.block().labelled = true
+			return f.block().indent
+		}
+	}
+
+	return f.statementIndent()
+}
+
+func (f *formatter) writeLine(indent int, line string) {
+	f.out.WriteString(strings.Repeat(formatIndent, indent))
+	f.out.WriteString(line)
+	f.out.WriteByte('\n')
+}
+
+func (f *formatter) flush(indent int) {
+	for _, line := range f.pending {
+		if line == "" {
+			f.out.WriteByte('\n')
+		} else {
+			f.writeLine(indent, line)
+		}
+	}
+
+	f.pending = f.pending[:0]
+}
+
+func (f *formatter) blank() {
+	if f.out.Len() == 0 && len(f.pending) == 0 {
+		return
+	}
+
+	if len(f.pending) > 0 && f.pending[len(f.pending)-1] == "" {
+		return
+	}
+
+	f.pending = append(f.pending, "")
+}
+
+func (f *formatter) statement(segments []*formatSegment) {
+	var tokens []*Token
+
+	for _, seg := range segments {
+		tokens = append(tokens, seg.tokens...)
+	}
+
+	if len(tokens) == 0 {
+		for _, seg := range segments {
+			if seg.comment != "" {
+				f.pending = append(f.pending, seg.comment)
+			}
+		}
+
+		return
+	}
+
+	indent := f.indent(tokens)
+
+	f.flush(indent)
+
+	texts := formatTokens(tokens)
+
+	var line strings.Builder
+
+	for i, seg := range segments {
+		for range seg.tokens {
+			text := texts[0]
+			texts = texts[1:]
+
+			if line.Len() == 0 {
+				text = strings.TrimLeft(text, " ")
+			}
+
+			line.WriteString(text)
+		}
+
+		if i < len(segments)-1 {
+			if line.Len() > 0 {
+				line.WriteString(" ")
+			}
+
+			line.WriteString("\\")
+		}
+
+		if seg.comment != "" {
+			if line.Len() > 0 {
+				line.WriteString(" ")
+			}
+
+			line.WriteString(seg.comment)
+		}
+
+		if i == 0 {
+			f.writeLine(indent, line.String())
+		} else {
+			f.writeLine(indent+1, line.String())
+		}
+
+		line.Reset()
+	}
+}
+
+// Format rewrites fx source canonically. Statements are indented by block and label, tokens are
+// spaced uniformly and comments, directives and line continuations are kept. With a cfg, both
+// sources must parse to the same commands, labels and vars, and a source that doesn't parse returns
+// its parse error. With a nil cfg, e.g. for included files that don't parse on their own, both
+// sources must lex to the same tokens.
+func Format(src []byte, filename string, cfg *ParserConfig) (formatted []byte, err error) {
+	f := &formatter{
+		blocks: []*formatBlock{{}},
+	}
+
+	var segments []*formatSegment
+
+	lines := strings.Split(string(src), "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for i, line := range lines {
+		code, comment, continued := splitLine(line)
+
+		seg := &formatSegment{comment: comment}
+
+		if seg.tokens, err = lexSegment(code, filename, i+1); err != nil {
+			return
+		}
+
+		if len(segments) == 0 && !continued && len(seg.tokens) == 0 && comment == "" {
+			f.blank()
+			continue
+		}
+
+		segments = append(segments, seg)
+
+		if continued {
+			continue
+		}
+
+		f.statement(segments)
+		segments = nil
+	}
+
+	if len(segments) > 0 {
+		f.statement(segments)
+	}
+
+	f.flush(0)
+
+	formatted = bytes.TrimRight(f.out.Bytes(), "\n")
+
+	if len(formatted) > 0 {
+		formatted = append(formatted, '\n')
+	}
+
+	if err = checkFormat(src, formatted, filename, cfg); err != nil {
+		formatted = nil
+	}
+
+	return
+}
+
+func formatTokenStream(src []byte, filename string) (tokens []*Token) {
+	for _, tok := range NewLexer(append(bytes.Clone(src), '\n'), filename).Lex() {
+		if tok.Type == NEWLINE && len(tokens) > 0 && tokens[len(tokens)-1].Type == NEWLINE {
+			continue
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	return
+}
+
+// checkFormat verifies that formatting did not change the meaning of the source.
+func checkFormat(src []byte, formatted []byte, filename string, cfg *ParserConfig) (err error) {
+	if cfg == nil {
+		return checkFormatTokens(src, formatted, filename)
+	}
+
+	var script *Script
+
+	if script, err = LoadScript(src, filename, cfg); err != nil {
+		return
+	}
+
+	return checkFormattedScript(script, formatted, filename, cfg)
+}
+
+// checkFormatTokens compares the tokens of both sources, for formatting without a config.
+func checkFormatTokens(src []byte, formatted []byte, filename string) error {
+	expected := formatTokenStream(src, filename)
+	got := formatTokenStream(formatted, filename)
+
+	for i, tok := range expected {
+		if i >= len(got) {
+			return &FormatError{tok.SourceInfo, tok, nil}
+		}
+
+		if tok.Type != got[i].Type || tokenText(tok) != tokenText(got[i]) {
+			return &FormatError{tok.SourceInfo, tok, got[i]}
+		}
+	}
+
+	if len(got) > len(expected) {
+		return &FormatError{got[len(expected)].SourceInfo, nil, got[len(expected)]}
+	}
+
+	return nil
+}
+
+// checkFormattedScript parses the formatted source and compares it with the script parsed from the
+// original source.
+func checkFormattedScript(expected *Script, formatted []byte, filename string, cfg *ParserConfig) (err error) {
+	var got *Script
+
+	if got, err = LoadScript(formatted, filename, cfg); err != nil {
+		return
+	}
+
+	for i, cmd := range expected.commands {
+		if i >= len(got.commands) {
+			return &FormatChangeError{cmd.SourceInfo, "the number of commands"}
+		}
+
+		if cmd.Type != got.commands[i].Type || !equalNodes(reflect.ValueOf(cmd.Args), reflect.ValueOf(got.commands[i].Args)) {
+			return &FormatChangeError{cmd.SourceInfo, "the command"}
+		}
+	}
+
+	if len(got.commands) > len(expected.commands) {
+		return &FormatChangeError{got.commands[len(expected.commands)].SourceInfo, "the number of commands"}
+	}
+
+	if name, ok := firstChange(expected.labels, got.labels); ok {
+		return &FormatChangeError{expected.declarationSource(SymbolLabel, name), fmt.Sprintf("label '%s'", name)}
+	}
+
+	if name, ok := firstChange(expected.variables, got.variables); ok {
+		return &FormatChangeError{expected.declarationSource(SymbolVariable, name), fmt.Sprintf("var '%s'", name)}
+	}
+
+	if addr, ok := firstChange(expected.initialValues, got.initialValues); ok {
+		name, _ := expected.VariableName(addr)
+
+		return &FormatChangeError{expected.declarationSource(SymbolVariable, name), fmt.Sprintf("the initial value of '%s'", name)}
+	}
+
+	return
+}
+
+// equalNodes compares two node trees deeply, ignoring their source positions.
+func equalNodes(a reflect.Value, b reflect.Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+
+	switch a.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+
+		if a.Kind() == reflect.Interface && a.Elem().Type() != b.Elem().Type() {
+			return false
+		}
+
+		return equalNodes(a.Elem(), b.Elem())
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+
+		for i := range a.Len() {
+			if !equalNodes(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+
+		return true
+	case reflect.Struct:
+		if a.Type() != b.Type() {
+			return false
+		}
+
+		for i := range a.NumField() {
+			if a.Type().Field(i).Type == reflect.TypeFor[*SourceInfo]() {
+				continue
+			}
+
+			if !equalNodes(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return a.Type() == b.Type() && a.Comparable() && a.Equal(b)
+	}
+}
+
+// firstChange returns the smallest key whose value differs between both maps.
+func firstChange[K cmp.Ordered](expected map[K]int, got map[K]int) (key K, ok bool) {
+	keys := slices.Collect(maps.Keys(expected))
+
+	for k := range got {
+		if _, found := expected[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		v, found := expected[k]
+		w, gotFound := got[k]
+
+		if found != gotFound || v != w {
+			return k, true
+		}
+	}
+
+	return
+}
+
+func (s *Script) declarationSource(kind SymbolKind, name string) *SourceInfo {
+	if decl, ok := s.Declaration(kind, name); ok {
+		return decl.SourceInfo
+	}
+
+	return &SourceInfo{Filename: s.filename}
+}
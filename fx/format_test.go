@@ -0,0 +1,113 @@
+package fx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testFormatConfig() *ParserConfig {
+	cfg := testParserConfig()
+
+	cfg.CommandTypes = CommandTypeTable{"set": CmdSet, "jumpIf": CmdJumpIf, "eval": cmdMyCmd}
+
+	return cfg
+}
+
+func TestFormat(t *testing.T) {
+	src := "\n\n# setup\nvar  counter\ndef LIMIT   2*(1+3)\n\n\n\nmacro  add $acc,$add=1\n\tset $acc,$acc+$add   # add it\n  %_skip :\n\t\tjumpIf !$acc , %_skip\nendmacro\nmain:\n\tset counter ,-LIMIT\n    add counter\n  set counter, \\\n  counter * 2 \\ # doubled\n      + 1\n   @ifdef DEBUG\n eval counter\n@endif\n\n\n"
+
+	expected := "# setup\nvar counter\ndef LIMIT 2 * (1 + 3)\n\nmacro add $acc, $add = 1\n  set $acc, $acc + $add # add it\n  %_skip:\n    jumpIf !$acc, %_skip\nendmacro\nmain:\n  set counter, -LIMIT\n  add counter\n  set counter, \\\n    counter * 2 \\ # doubled\n    + 1\n  @ifdef DEBUG\n    eval counter\n  @endif\n"
+
+	formatted, err := Format([]byte(src), "test.fx", testFormatConfig())
+
+	require.NoError(t, err)
+	require.Equal(t, expected, string(formatted))
+
+	formatted, err = Format(formatted, "test.fx", testFormatConfig())
+
+	require.NoError(t, err)
+	require.Equal(t, expected, string(formatted))
+}
+
+func TestFormat_Illegal(t *testing.T) {
+	_, err := Format([]byte("set A, 1\nset A, ?\n"), "test.fx", testFormatConfig())
+
+	var syntaxErr *SyntaxError
+
+	require.ErrorAs(t, err, &syntaxErr)
+	require.Equal(t, 2, syntaxErr.Line)
+}
+
+func TestFormat_Initializers(t *testing.T) {
+	src := "var list[3]={ 1,-2 ,3 }\ndata  table\n1,2\n\t-3\nenddata\ndata one 1 enddata\n"
+
+	expected := "var list[3] = {1, -2, 3}\ndata table\n  1, 2\n  -3\nenddata\ndata one 1 enddata\n"
+
+	formatted, err := Format([]byte(src), "test.fx", testFormatConfig())
+
+	require.NoError(t, err)
+	require.Equal(t, expected, string(formatted))
+}
+
+func TestFormat_Check(t *testing.T) {
+	tests := []struct {
+		src       string
+		formatted string
+		err       string
+	}{
+		{"set A, 1\n", "set A, 2\n", "format error at test.fx:1:1: formatting changed the command"},
+		{"set A, 1\nset A, 2\n", "set A, 1\n", "format error at test.fx:2:1: formatting changed the number of commands"},
+		{"a:\nset A, 1\n", "set A, 1\na:\n", "format error at test.fx:1:1: formatting changed label 'a'"},
+		{"var x\nvar y\n", "var y\nvar x\n", "format error at test.fx:1:5: formatting changed var 'x'"},
+		{"var x = 1\n", "var x = 2\n", "format error at test.fx:1:5: formatting changed the initial value of 'x'"},
+		{"set A, 1\n", "set A, 1\n", ""},
+	}
+
+	for _, test := range tests {
+		err := checkFormat([]byte(test.src), []byte(test.formatted), "test.fx", testFormatConfig())
+
+		if test.err == "" {
+			require.NoError(t, err, test.src)
+			continue
+		}
+
+		require.EqualError(t, err, test.err, test.src)
+	}
+
+	// without a config, the sources are compared by their tokens
+	err := checkFormat([]byte("unknown 1\n"), []byte("unknown 2\n"), "test.fx", nil)
+
+	require.EqualError(t, err, "format error at test.fx:1:9: formatting changed number '1' to number '2'")
+
+	// with a config, sources that don't parse return their parse error
+	err = checkFormat([]byte("unknown 1\n"), []byte("unknown 1\n"), "test.fx", testFormatConfig())
+
+	var syntaxErr *SyntaxError
+
+	require.ErrorAs(t, err, &syntaxErr)
+}
+
+func TestFormat_CheckNodes(t *testing.T) {
+	tests := []struct {
+		src       string
+		formatted string
+		err       string
+	}{
+		{"set A, 1 + 2\n", "set A, \\\n  1 + 2\n", ""},
+		{"set A, 1 + 2 * 3\n", "set A, (1 + 2) * 3\n", "format error at test.fx:1:1: formatting changed the command"},
+		{"set A, -1\n", "set A, !1\n", "format error at test.fx:1:1: formatting changed the command"},
+		{"set A, \"a\"\n", "set A, \"b\"\n", "format error at test.fx:1:1: formatting changed the command"},
+	}
+
+	for _, test := range tests {
+		err := checkFormat([]byte(test.src), []byte(test.formatted), "test.fx", testFormatConfig())
+
+		if test.err == "" {
+			require.NoError(t, err, test.src)
+			continue
+		}
+
+		require.EqualError(t, err, test.err, test.src)
+	}
+}
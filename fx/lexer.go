@@ -146,7 +146,7 @@ func (l *Lexer) skipWhitespace() (skipped bool) {
 func (l *Lexer) skipComment() *Token {
 	n := 1
 
-	for l.peekAhead(n) != '\n' {
+	for l.peekAhead(n) != '\n' && l.peekAhead(n) != 0 {
 		n += 1
 	}
 
@@ -165,7 +165,7 @@ func (l *Lexer) lexIdent() *Token {
 	ident := l.substr(n)
 
 	if tokTyp, ok := identKeywords[ident]; ok {
-		return l.newToken(tokTyp, "")
+		return l.newTokenWidth(tokTyp, "", n)
 	}
 
 	return l.newToken(IDENT, ident)
@@ -243,6 +243,8 @@ func (l *Lexer) lexOperator() *Token {
 		tokType = EQ
 	case SynExcl + SynEqual:
 		tokType = NEQ
+	case SynEqual:
+		tokType = ASSIGN
 	}
 
 	return l.newToken(tokType, opVal)
@@ -253,7 +255,7 @@ func (l *Lexer) lexString() (token *Token) {
 
 	n := 0
 
-	for l.peekAhead(n) != '"' {
+	for l.peekAhead(n) != '"' && l.peekAhead(n) != 0 {
 		n += 1
 	}
 
@@ -269,11 +271,12 @@ func (l *Lexer) lexPreprocessor() (token *Token) {
 
 	n := 0
 
-	for l.peekAhead(n) != '\n' {
+	for l.peekAhead(n) != '\n' && l.peekAhead(n) != 0 {
 		n += 1
 	}
 
-	token = l.newToken(PREPROCESSOR, l.substr(n))
+	// include the '@' in the token position
+	token = l.newTokenWidth(PREPROCESSOR, l.substr(n), n+1)
 
 	return
 }
@@ -306,28 +309,42 @@ lex:
 		return l.lexPreprocessor()
 	case ',':
 		l.advance()
-		return l.newToken(COMMA, "")
+		return l.newTokenWidth(COMMA, "", 1)
 	case '\n':
+		tok := l.newTokenWidth(NEWLINE, "", 0)
 		l.advance()
-		return l.newToken(NEWLINE, "")
+		return tok
 	case ':':
 		l.advance()
-		return l.newToken(COLON, "")
+		return l.newTokenWidth(COLON, "", 1)
 	case '(':
 		l.advance()
-		return l.newToken(LPAREN, "")
+		return l.newTokenWidth(LPAREN, "", 1)
 	case ')':
 		l.advance()
-		return l.newToken(RPAREN, "")
+		return l.newTokenWidth(RPAREN, "", 1)
 	case '[':
 		l.advance()
-		return l.newToken(LBRACKET, "")
+		return l.newTokenWidth(LBRACKET, "", 1)
 	case ']':
 		l.advance()
-		return l.newToken(RBRACKET, "")
+		return l.newTokenWidth(RBRACKET, "", 1)
+	case '{':
+		l.advance()
+		return l.newTokenWidth(LBRACE, "", 1)
+	case '}':
+		l.advance()
+		return l.newTokenWidth(RBRACE, "", 1)
 	case '$':
 		l.advance()
-		return l.newToken(DOLLAR, "")
+		return l.newTokenWidth(DOLLAR, "", 1)
+	case '.':
+		if l.peekAhead(1) == '.' && l.peekAhead(2) == '.' {
+			return l.newToken(ELLIPSIS, l.substr(3))
+		}
+
+		l.advance()
+		return l.newTokenWidth(DOT, "", 1)
 	case '"':
 		return l.lexString()
 	case '#':
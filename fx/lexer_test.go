@@ -27,7 +27,7 @@ func TestLexer_Comments(t *testing.T) {
 	expectedTokens := []*Token{
 		tok(3, 3, IDENT, "cmd1"),
 		tok(3, 8, IDENT, "arg1"),
-		tok(4, 1, NEWLINE, ""),
+		tok(3, 57, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -51,9 +51,9 @@ func TestLexer_Ident(t *testing.T) {
 	expectedTokens := []*Token{
 		tok(2, 3, IDENT, "cmd1"),
 		tok(2, 8, IDENT, "arg1"),
-		tok(3, 1, NEWLINE, ""),
+		tok(2, 12, NEWLINE, ""),
 		tok(3, 3, IDENT, "cmd2"),
-		tok(4, 1, NEWLINE, ""),
+		tok(3, 7, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -79,7 +79,7 @@ func TestLexer_Numbers(t *testing.T) {
 		tok(1, 9, NUMBER, "39.55"),
 		tok(1, 15, SUB, "-"),
 		tok(1, 16, NUMBER, "42.0"),
-		tok(2, 1, NEWLINE, ""),
+		tok(1, 20, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -109,7 +109,7 @@ func TestLexer_OperatorsAndNumbers(t *testing.T) {
 		tok(1, 18, NUMBER, "72"),
 		tok(1, 21, DIV, "/"),
 		tok(1, 23, NUMBER, "42"),
-		tok(2, 1, NEWLINE, ""),
+		tok(1, 25, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -128,24 +128,24 @@ func TestLexer_OperatorsWithParens(t *testing.T) {
 	script := "(+42 + 13) - (37 * (-72 / 42 ))\n"
 
 	expectedTokens := []*Token{
-		tok(1, 2, LPAREN, ""),
+		tok(1, 1, LPAREN, ""),
 		tok(1, 2, ADD, "+"),
 		tok(1, 3, NUMBER, "42"),
 		tok(1, 6, ADD, "+"),
 		tok(1, 8, NUMBER, "13"),
-		tok(1, 11, RPAREN, ""),
+		tok(1, 10, RPAREN, ""),
 		tok(1, 12, SUB, "-"),
-		tok(1, 15, LPAREN, ""),
+		tok(1, 14, LPAREN, ""),
 		tok(1, 15, NUMBER, "37"),
 		tok(1, 18, MUL, "*"),
-		tok(1, 21, LPAREN, ""),
+		tok(1, 20, LPAREN, ""),
 		tok(1, 21, SUB, "-"),
 		tok(1, 22, NUMBER, "72"),
 		tok(1, 25, DIV, "/"),
 		tok(1, 27, NUMBER, "42"),
+		tok(1, 30, RPAREN, ""),
 		tok(1, 31, RPAREN, ""),
-		tok(1, 32, RPAREN, ""),
-		tok(2, 1, NEWLINE, ""),
+		tok(1, 32, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -169,7 +169,7 @@ func TestLexer_InvOperator(t *testing.T) {
 		tok(1, 5, INV, "^"),
 		tok(1, 6, SUB, "-"),
 		tok(1, 7, NUMBER, "13"),
-		tok(2, 1, NEWLINE, ""),
+		tok(1, 9, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -192,7 +192,7 @@ func TestLexer_AddrOfOperator(t *testing.T) {
 		tok(1, 2, NUMBER, "42"),
 		tok(1, 5, AND, "&"),
 		tok(1, 6, NUMBER, "13"),
-		tok(2, 1, NEWLINE, ""),
+		tok(1, 8, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -214,7 +214,7 @@ func TestLexer_And(t *testing.T) {
 		tok(1, 1, NUMBER, "4"),
 		tok(1, 3, AND, "&"),
 		tok(1, 5, NUMBER, "16"),
-		tok(2, 1, NEWLINE, ""),
+		tok(1, 7, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -236,7 +236,7 @@ func TestLexer_Or(t *testing.T) {
 		tok(1, 1, NUMBER, "4"),
 		tok(1, 3, OR, "|"),
 		tok(1, 5, NUMBER, "16"),
-		tok(2, 1, NEWLINE, ""),
+		tok(1, 7, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -259,12 +259,12 @@ func TestLexer_Labels(t *testing.T) {
 
 	expectedTokens := []*Token{
 		tok(2, 3, IDENT, "some-label"),
-		tok(2, 14, COLON, ""),
-		tok(3, 1, NEWLINE, ""),
+		tok(2, 13, COLON, ""),
+		tok(2, 14, NEWLINE, ""),
 		tok(3, 3, PERCENT, "%"),
 		tok(3, 4, IDENT, "someLabel2"),
-		tok(3, 15, COLON, ""),
-		tok(4, 1, NEWLINE, ""),
+		tok(3, 14, COLON, ""),
+		tok(3, 15, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -287,14 +287,47 @@ func TestLexer_Macro(t *testing.T) {
 	`
 
 	expectedTokens := []*Token{
-		tok(2, 8, MACRO, ""),
+		tok(2, 3, MACRO, ""),
 		tok(2, 9, IDENT, "myMacro"),
-		tok(3, 1, NEWLINE, ""),
+		tok(2, 16, NEWLINE, ""),
 		tok(3, 4, IDENT, "hello"),
 		tok(3, 10, IDENT, "world"),
-		tok(4, 1, NEWLINE, ""),
-		tok(4, 11, ENDMACRO, ""),
-		tok(5, 1, NEWLINE, ""),
+		tok(3, 15, NEWLINE, ""),
+		tok(4, 3, ENDMACRO, ""),
+		tok(4, 11, NEWLINE, ""),
+		{
+			SourceInfo: nil,
+			Type:       EOF,
+			Value:      "",
+		},
+	}
+
+	l := NewLexer([]byte(script), "test.fx")
+
+	tokens := l.Lex()
+
+	require.Equal(t, expectedTokens, tokens)
+}
+
+func TestLexer_Modules(t *testing.T) {
+	script := `
+		import ui
+		export init
+		goto ui.init
+	`
+
+	expectedTokens := []*Token{
+		tok(2, 3, IMPORT, ""),
+		tok(2, 10, IDENT, "ui"),
+		tok(2, 12, NEWLINE, ""),
+		tok(3, 3, EXPORT, ""),
+		tok(3, 10, IDENT, "init"),
+		tok(3, 14, NEWLINE, ""),
+		tok(4, 3, IDENT, "goto"),
+		tok(4, 8, IDENT, "ui"),
+		tok(4, 10, DOT, ""),
+		tok(4, 11, IDENT, "init"),
+		tok(4, 15, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -316,14 +349,14 @@ func TestLexer_Defines(t *testing.T) {
 	`
 
 	expectedTokens := []*Token{
-		tok(2, 6, DEF, ""),
+		tok(2, 3, DEF, ""),
 		tok(2, 7, IDENT, "msgHello"),
 		tok(2, 17, STRING, "Hello World!"),
-		tok(3, 1, NEWLINE, ""),
-		tok(3, 6, DEF, ""),
+		tok(2, 30, NEWLINE, ""),
+		tok(3, 3, DEF, ""),
 		tok(3, 7, IDENT, "wordCount"),
 		tok(3, 17, NUMBER, "2"),
-		tok(4, 1, NEWLINE, ""),
+		tok(3, 18, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -344,9 +377,9 @@ func TestLexer_Variables(t *testing.T) {
 	`
 
 	expectedTokens := []*Token{
-		tok(2, 6, VAR, ""),
+		tok(2, 3, VAR, ""),
 		tok(2, 7, IDENT, "myVar"),
-		tok(3, 1, NEWLINE, ""),
+		tok(2, 12, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -368,17 +401,17 @@ func TestLexer_ArrayVariables(t *testing.T) {
 	`
 
 	expectedTokens := []*Token{
-		tok(2, 6, VAR, ""),
+		tok(2, 3, VAR, ""),
 		tok(2, 7, IDENT, "myArr"),
-		tok(2, 13, LBRACKET, ""),
+		tok(2, 12, LBRACKET, ""),
 		tok(2, 13, NUMBER, "10"),
-		tok(2, 16, RBRACKET, ""),
-		tok(3, 1, NEWLINE, ""),
+		tok(2, 15, RBRACKET, ""),
+		tok(2, 16, NEWLINE, ""),
 		tok(3, 3, IDENT, "myArr"),
-		tok(3, 9, LBRACKET, ""),
+		tok(3, 8, LBRACKET, ""),
 		tok(3, 9, NUMBER, "0"),
-		tok(3, 11, RBRACKET, ""),
-		tok(4, 1, NEWLINE, ""),
+		tok(3, 10, RBRACKET, ""),
+		tok(3, 11, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -401,9 +434,9 @@ func TestLexer_Strings(t *testing.T) {
 
 	expectedTokens := []*Token{
 		tok(2, 4, STRING, "Hello World!"),
-		tok(3, 1, NEWLINE, ""),
+		tok(2, 17, NEWLINE, ""),
 		tok(3, 4, STRING, "Strings can .contain all @sorts of -42.1337 # characters"),
-		tok(4, 1, NEWLINE, ""),
+		tok(3, 61, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -424,9 +457,9 @@ func TestLexer_EscapedNewlines(t *testing.T) {
 	expectedTokens := []*Token{
 		tok(1, 1, IDENT, "set"),
 		tok(2, 3, IDENT, "A"),
-		tok(2, 5, COMMA, ""),
+		tok(2, 4, COMMA, ""),
 		tok(3, 3, NUMBER, "42"),
-		tok(4, 1, NEWLINE, ""),
+		tok(3, 5, NEWLINE, ""),
 		{
 			SourceInfo: nil,
 			Type:       EOF,
@@ -442,7 +475,7 @@ func TestLexer_EscapedNewlines(t *testing.T) {
 	expectedTokensWithComments := []*Token{
 		tok(1, 1, IDENT, "set"),
 		tok(2, 2, IDENT, "A"),
-		tok(2, 4, COMMA, ""),
+		tok(2, 3, COMMA, ""),
 		tok(3, 2, NUMBER, "42"),
 		{
 			SourceInfo: nil,
@@ -491,3 +524,32 @@ func TestLexer_EOF(t *testing.T) {
 
 	require.Equal(t, tokens[0], tok, "expected same EOF token to be returned")
 }
+
+func TestLexer_MacroParams(t *testing.T) {
+	script := "macro m $a = 1, $rest...\n"
+
+	expectedTokens := []*Token{
+		tok(1, 1, MACRO, ""),
+		tok(1, 7, IDENT, "m"),
+		tok(1, 9, DOLLAR, ""),
+		tok(1, 10, IDENT, "a"),
+		tok(1, 12, ASSIGN, "="),
+		tok(1, 14, NUMBER, "1"),
+		tok(1, 15, COMMA, ""),
+		tok(1, 17, DOLLAR, ""),
+		tok(1, 18, IDENT, "rest"),
+		tok(1, 22, ELLIPSIS, "..."),
+		tok(1, 25, NEWLINE, ""),
+		{
+			SourceInfo: nil,
+			Type:       EOF,
+			Value:      "",
+		},
+	}
+
+	l := NewLexer([]byte(script), "test.fx")
+
+	tokens := l.Lex()
+
+	require.Equal(t, expectedTokens, tokens)
+}
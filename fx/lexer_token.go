@@ -3,15 +3,48 @@ package fx
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type SourceInfo struct {
 	Filename string
 	Line     int
 	Column   int
+
+	Expansion *Expansion
 }
 
-func (s *SourceInfo) String() string {
+// Expansion records the macro invocation a token was expanded from. The call site carries its
+// own expansion if the invocation itself is part of a macro body.
+type Expansion struct {
+	Macro    string
+	CallSite *SourceInfo
+}
+
+func (e *Expansion) token(tok *Token) *Token {
+	if tok.SourceInfo == nil {
+		return tok
+	}
+
+	sourceInfo := *tok.SourceInfo
+	sourceInfo.Expansion = e
+
+	return &Token{
+		SourceInfo: &sourceInfo,
+		Type:       tok.Type,
+		Value:      tok.Value,
+	}
+}
+
+func (s *SourceInfo) Source() *SourceInfo {
+	return s
+}
+
+func (s *SourceInfo) Position() string {
+	if s == nil {
+		return "<unknown>"
+	}
+
 	var fName string
 
 	if s.Filename == "" {
@@ -23,6 +56,58 @@ func (s *SourceInfo) String() string {
 	return fmt.Sprintf("%s:%d:%d", fName, s.Line, s.Column)
 }
 
+// Expansions returns the macro expansion chain, innermost expansion first.
+func (s *SourceInfo) Expansions() (expansions []*Expansion) {
+	if s == nil {
+		return
+	}
+
+	for e := s.Expansion; e != nil; {
+		expansions = append(expansions, e)
+
+		if e.CallSite == nil {
+			break
+		}
+
+		e = e.CallSite.Expansion
+	}
+
+	return
+}
+
+// Origin returns the position in user code that caused this source, i.e. the outermost macro call site.
+func (s *SourceInfo) Origin() *SourceInfo {
+	origin := s
+
+	for _, e := range s.Expansions() {
+		if e.CallSite != nil {
+			origin = e.CallSite
+		}
+	}
+
+	return origin
+}
+
+func (s *SourceInfo) String() string {
+	expansions := s.Expansions()
+
+	if len(expansions) == 0 {
+		return s.Position()
+	}
+
+	trace := make([]string, len(expansions))
+
+	for i, e := range expansions {
+		if e.CallSite == nil {
+			trace[i] = fmt.Sprintf("in macro '%s'", e.Macro)
+		} else {
+			trace[i] = fmt.Sprintf("in macro '%s' expanded at %s", e.Macro, e.CallSite.Position())
+		}
+	}
+
+	return fmt.Sprintf("%s (%s)", s.Position(), strings.Join(trace, ", "))
+}
+
 type TokenType uint
 
 func (t TokenType) String() string {
@@ -51,6 +136,28 @@ func (t TokenType) String() string {
 		return "MACRO"
 	case ENDMACRO:
 		return "ENDMACRO"
+	case IMPORT:
+		return "IMPORT"
+	case EXPORT:
+		return "EXPORT"
+	case NAMESPACE:
+		return "NAMESPACE"
+	case ENDNAMESPACE:
+		return "ENDNAMESPACE"
+	case USING:
+		return "USING"
+	case STRUCT:
+		return "STRUCT"
+	case ENDSTRUCT:
+		return "ENDSTRUCT"
+	case DATA:
+		return "DATA"
+	case ENDDATA:
+		return "ENDDATA"
+	case LBRACE:
+		return "LBRACE"
+	case RBRACE:
+		return "RBRACE"
 	case LPAREN:
 		return "LPAREN"
 	case RPAREN:
@@ -93,6 +200,14 @@ func (t TokenType) String() string {
 		return "OR"
 	case DOLLAR:
 		return "DOLLAR"
+	case PERCENT:
+		return "PERCENT"
+	case ASSIGN:
+		return "ASSIGN"
+	case ELLIPSIS:
+		return "ELLIPSIS"
+	case DOT:
+		return "DOT"
 	case PREPROCESSOR:
 		return "PREPROCESSOR"
 	default:
@@ -100,6 +215,90 @@ func (t TokenType) String() string {
 	}
 }
 
+// Describe returns a human-readable name of the token type, as used in diagnostics.
+func (t TokenType) Describe() string {
+	switch t {
+	case EOF:
+		return "end of file"
+	case ILLEGAL:
+		return "illegal character"
+	case NEWLINE:
+		return "end of line"
+	case STRING:
+		return "string"
+	case IDENT:
+		return "identifier"
+	case NUMBER:
+		return "number"
+	case PREPROCESSOR:
+		return "preprocessor directive"
+	case DEF:
+		return "'def'"
+	case VAR:
+		return "'var'"
+	case MACRO:
+		return "'macro'"
+	case ENDMACRO:
+		return "'endmacro'"
+	case IMPORT:
+		return "'import'"
+	case EXPORT:
+		return "'export'"
+	case NAMESPACE:
+		return "'namespace'"
+	case ENDNAMESPACE:
+		return "'endnamespace'"
+	case USING:
+		return "'using'"
+	case STRUCT:
+		return "'struct'"
+	case ENDSTRUCT:
+		return "'endstruct'"
+	case DATA:
+		return "'data'"
+	case ENDDATA:
+		return "'enddata'"
+	}
+
+	if sym, ok := tokenSymbols[t]; ok {
+		return "'" + sym + "'"
+	}
+
+	return t.String()
+}
+
+var tokenSymbols = map[TokenType]string{
+	COMMA:    ",",
+	COLON:    ":",
+	LPAREN:   "(",
+	RPAREN:   ")",
+	LBRACKET: "[",
+	RBRACKET: "]",
+	LBRACE:   "{",
+	RBRACE:   "}",
+	ADD:      SynPlus,
+	SUB:      SynMinus,
+	MUL:      SynAsterisk,
+	DIV:      SynSlash,
+	SHL:      SynLower + SynLower,
+	SHR:      SynGreater + SynGreater,
+	LT:       SynLower,
+	GT:       SynGreater,
+	LTE:      SynLower + SynEqual,
+	GTE:      SynGreater + SynEqual,
+	EQ:       SynEqual + SynEqual,
+	NEQ:      SynExcl + SynEqual,
+	EXCL:     SynExcl,
+	INV:      SynInv,
+	AND:      SynAmpersand,
+	OR:       SynPipe,
+	DOLLAR:   "$",
+	PERCENT:  SynPercent,
+	ASSIGN:   SynEqual,
+	ELLIPSIS: "...",
+	DOT:      ".",
+}
+
 const (
 	EOF TokenType = iota
 	ILLEGAL
@@ -149,6 +348,25 @@ const (
 	PERCENT
 
 	PREPROCESSOR
+
+	ASSIGN
+	ELLIPSIS
+
+	IMPORT
+	EXPORT
+	DOT
+
+	NAMESPACE
+	ENDNAMESPACE
+	USING
+
+	STRUCT
+	ENDSTRUCT
+
+	DATA
+	ENDDATA
+	LBRACE
+	RBRACE
 )
 
 const (
@@ -176,21 +394,49 @@ func (t *Token) String() string {
 	return fmt.Sprintf("%s(%s)", t.Type, t.Value)
 }
 
+// Describe returns a human-readable description of the token, as used in diagnostics.
+func (t *Token) Describe() string {
+	switch t.Type {
+	case IDENT, NUMBER, ILLEGAL:
+		return fmt.Sprintf("%s '%s'", t.Type.Describe(), t.Value)
+	case STRING:
+		return fmt.Sprintf("string \"%s\"", t.Value)
+	case PREPROCESSOR:
+		return fmt.Sprintf("directive '@%s'", directiveName(t.Value))
+	}
+
+	return t.Type.Describe()
+}
+
 var identKeywords = map[string]TokenType{
-	"var":      VAR,
-	"def":      DEF,
-	"macro":    MACRO,
-	"endmacro": ENDMACRO,
+	"var":          VAR,
+	"def":          DEF,
+	"macro":        MACRO,
+	"endmacro":     ENDMACRO,
+	"import":       IMPORT,
+	"export":       EXPORT,
+	"namespace":    NAMESPACE,
+	"endnamespace": ENDNAMESPACE,
+	"using":        USING,
+	"struct":       STRUCT,
+	"endstruct":    ENDSTRUCT,
+	"data":         DATA,
+	"enddata":      ENDDATA,
 }
 
 func (l *Lexer) newToken(typ TokenType, value string) *Token {
+	return l.newTokenWidth(typ, value, len(value))
+}
+
+// newTokenWidth creates a token that spans the last width characters read.
+func (l *Lexer) newTokenWidth(typ TokenType, value string, width int) *Token {
 	return &Token{
 		Type:  typ,
 		Value: value,
 		SourceInfo: &SourceInfo{
 			Filename: l.Filename(),
 			Line:     l.line,
-			Column:   l.col - len(value) + 1,
+			Column:   l.col - width + 1,
 		},
 	}
 }
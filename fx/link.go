@@ -0,0 +1,293 @@
+package fx
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// linkedModule is the place of a module in the linked script.
+type linkedModule struct {
+	*Script
+
+	entry    bool
+	pc       int
+	variable int
+}
+
+type linker struct {
+	script  *Script
+	modules map[string]*linkedModule
+	nodes   map[ExpressionNode]ExpressionNode
+	errs    ErrorList
+
+	// declared are the labels, vars and defs of the linked script by their linked names
+	declared map[string]*Declaration
+}
+
+// Link combines modules that were parsed separately into one script. The first module is the entry
+// point, its commands start at pc 0 and its labels and vars keep their names. Labels, vars and
+// defs of the other modules are named `module.name` in the linked script, and so are their
+// structs. A linked name that is taken by a symbol of an earlier module is a LinkError.
+//
+// References to other modules are resolved and all modules get their own vars. Link reuses the
+// nodes of the modules, which must not be used afterward.
+func Link(modules ...*Script) (script *Script, err error) {
+	script = newScript()
+
+	if len(modules) == 0 {
+		return
+	}
+
+	script.operators = modules[0].operators
+	script.module = modules[0].module
+
+	l := &linker{
+		script:  script,
+		modules: make(map[string]*linkedModule),
+		nodes:   make(map[ExpressionNode]ExpressionNode),
+
+		declared: make(map[string]*Declaration),
+	}
+
+	var linked []*linkedModule
+
+	for _, m := range modules {
+		if prev, ok := l.modules[m.module]; ok {
+			l.errs = append(l.errs, &LinkError{m.location(), &DuplicateSymbolError{SymbolModule, m.module, prev.location()}})
+			continue
+		}
+
+		lm := &linkedModule{m, len(linked) == 0, script.PC(), script.variableSpace}
+
+		// reserve the pcs and vars, so modules can reference modules that are linked later. Every
+		// module ends with an exit instead of running into the next module.
+		script.commands = append(script.commands, make([]*CommandNode, len(m.commands))...)
+		script.commands = append(script.commands, &CommandNode{Type: CmdExit})
+
+		maps.Copy(script.commandNames, m.commandNames)
+
+		l.declare(lm)
+
+		layouts := make(map[*Struct]*Struct)
+
+		for name, layout := range m.structs {
+			linkedLayout := *layout
+			linkedLayout.Name = lm.name(name)
+
+			layouts[layout] = &linkedLayout
+			script.structs[linkedLayout.Name] = &linkedLayout
+		}
+
+		for name, shape := range m.shapes {
+			linkedShape := *shape
+
+			if shape.layout != nil {
+				linkedShape.layout = layouts[shape.layout]
+			}
+
+			script.shapes[lm.name(name)] = &linkedShape
+		}
+
+		for name, offset := range m.variables {
+			script.addVariableWithOffset(lm.name(name), offset+lm.variable, m.variableSizes[offset])
+		}
+
+		for addr, v := range m.initialValues {
+			script.initialValues[addr+lm.variable] = v
+		}
+
+		for addr := range m.readOnly {
+			script.readOnly[addr+lm.variable] = true
+		}
+
+		l.modules[m.module] = lm
+		linked = append(linked, lm)
+	}
+
+	for _, lm := range linked {
+		l.link(lm)
+	}
+
+	l.errs.sort()
+
+	err = l.errs.Err()
+
+	return
+}
+
+// name returns the name of a label, var or def of the module in the linked script.
+func (lm *linkedModule) name(name string) string {
+	if lm.entry {
+		return name
+	}
+
+	return lm.module + "." + name
+}
+
+// declare records the linked names of the labels, vars and defs of a module and reports the names
+// that are taken by an earlier module, e.g. by a var in the namespace of the entry module that has
+// the name of the module.
+func (l *linker) declare(lm *linkedModule) {
+	for _, kind := range []SymbolKind{SymbolLabel, SymbolVariable, SymbolDefine} {
+		var names []string
+
+		switch kind {
+		case SymbolLabel:
+			names = slices.Sorted(maps.Keys(lm.labels))
+		case SymbolVariable:
+			names = slices.Sorted(maps.Keys(lm.variables))
+		case SymbolDefine:
+			names = slices.Sorted(maps.Keys(lm.defines))
+		}
+
+		for _, name := range names {
+			decl := &Declaration{lm.declarationSource(kind, name), kind, lm.name(name)}
+
+			prev, ok := l.declared[decl.Name]
+
+			switch {
+			case !ok:
+				l.declared[decl.Name] = decl
+			case prev.Kind == kind:
+				l.errs = append(l.errs, &LinkError{decl.SourceInfo, &DuplicateSymbolError{kind, decl.Name, prev.SourceInfo}})
+			default:
+				l.errs = append(l.errs, &LinkError{decl.SourceInfo, &SymbolConflictError{kind, decl.Name, prev.Kind, prev.Name, prev.SourceInfo}})
+			}
+		}
+	}
+}
+
+// location is the position that link errors about the whole module are reported at.
+func (s *Script) location() *SourceInfo {
+	return &SourceInfo{Filename: s.filename, Line: 1, Column: 1}
+}
+
+func (l *linker) link(lm *linkedModule) {
+	script := l.script
+
+	for _, name := range slices.Sorted(maps.Keys(lm.imports)) {
+		if _, ok := l.modules[name]; !ok {
+			l.errs = append(l.errs, &LinkError{lm.imports[name], &UnknownModuleError{name}})
+		}
+	}
+
+	for pc, cmd := range lm.commands {
+		for i, arg := range cmd.Args {
+			cmd.Args[i] = l.relocate(lm, arg)
+		}
+
+		script.commands[lm.pc+pc] = cmd
+	}
+
+	for name, pc := range lm.labels {
+		script.labels[lm.name(name)] = pc + lm.pc
+	}
+
+	for name, addrNodes := range lm.symbols {
+		for _, addr := range addrNodes {
+			l.relocate(lm, addr)
+		}
+
+		if _, ok := lm.labels[name]; ok {
+			script.symbols[lm.name(name)] = append(script.symbols[lm.name(name)], addrNodes...)
+		}
+	}
+
+	for name, expr := range lm.defines {
+		script.defines[lm.name(name)] = l.relocate(lm, expr)
+	}
+}
+
+// relocate moves the labels and vars referenced by expr to their place in the linked script and
+// resolves imports. Nodes shared by several expressions, e.g. defs, are relocated only once.
+func (l *linker) relocate(lm *linkedModule, expr ExpressionNode) ExpressionNode {
+	if expr == nil {
+		return nil
+	}
+
+	if relocated, ok := l.nodes[expr]; ok {
+		return relocated
+	}
+
+	relocated := expr
+
+	switch n := expr.(type) {
+	case *AddressNode:
+		n.Address += lm.pc
+	case *IdentifierNode:
+		if n.Identifier >= VariableOffset {
+			n.Identifier += Identifier(lm.variable)
+		}
+	case *ArrayAccessNode:
+		n.Variable += Identifier(lm.variable)
+		n.Index = l.relocate(lm, n.Index)
+	case *IndexCheckNode:
+		n.Index = l.relocate(lm, n.Index)
+	case *UnaryOpNode:
+		n.Expr = l.relocate(lm, n.Expr)
+	case *BinaryOpNode:
+		n.Left = l.relocate(lm, n.Left)
+		n.Right = l.relocate(lm, n.Right)
+	case *ImportNode:
+		relocated = l.resolve(lm, n)
+	}
+
+	l.nodes[expr] = relocated
+
+	return relocated
+}
+
+// resolve replaces a reference to another module by the exported label or var.
+func (l *linker) resolve(lm *linkedModule, n *ImportNode) ExpressionNode {
+	index := l.relocate(lm, n.Index)
+	unresolved := &IntegerNode{n.SourceInfo, 0}
+
+	target, ok := l.modules[n.Module]
+
+	if !ok {
+		// reported for the import
+		return unresolved
+	}
+
+	pc, isLabel := target.labels[n.Name]
+	offset, isVariable := target.variables[n.Name]
+
+	if !isLabel && !isVariable {
+		if base, _, field := strings.Cut(n.Name, "."); field {
+			if _, shaped := target.shapes[base]; shaped {
+				l.errs = append(l.errs, &LinkError{n.SourceInfo, &ImportedShapeError{n.Module, base}})
+				return unresolved
+			}
+		}
+
+		l.errs = append(l.errs, &LinkError{n.SourceInfo, &UnresolvedSymbolError{n.Module + "." + n.Name}})
+		return unresolved
+	}
+
+	if _, exported := target.exports[n.Name]; !exported {
+		l.errs = append(l.errs, &LinkError{n.SourceInfo, &NotExportedError{n.Module, n.Name}})
+		return unresolved
+	}
+
+	// an index of another module only selects an element of a plain array
+	if shape, shaped := target.shapes[n.Name]; index != nil && shaped && (len(shape.dimensions) > 1 || shape.layout != nil) {
+		l.errs = append(l.errs, &LinkError{n.SourceInfo, &ImportedShapeError{n.Module, n.Name}})
+		return unresolved
+	}
+
+	switch {
+	case isVariable && index != nil:
+		return &ArrayAccessNode{n.SourceInfo, Identifier(offset + target.variable), index}
+	case isVariable:
+		return &IdentifierNode{n.SourceInfo, Identifier(offset + target.variable)}
+	case index != nil:
+		l.errs = append(l.errs, &LinkError{n.SourceInfo, &UnexpectedTypeError{"label"}})
+		return unresolved
+	}
+
+	addr := &AddressNode{n.SourceInfo, pc + target.pc}
+	l.script.addSymbol(target.name(n.Name), addr)
+
+	return addr
+}
@@ -0,0 +1,184 @@
+package fx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func loadModule(t *testing.T, filename string, src string) *Script {
+	t.Helper()
+
+	s, err := LoadScript([]byte(src), filename, testParserConfig())
+
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestLink(t *testing.T) {
+	main := loadModule(t, "scripts/main.fx", `import ui
+var hp = 10
+
+main:
+  myCmd ui.init, ui.shown, ui.list[1], hp
+`)
+
+	require.Equal(t, "main", main.Module())
+	require.Contains(t, main.Imports(), "ui")
+
+	ui := loadModule(t, "scripts/ui.fx", `export init, shown, list
+var shown
+var list[2] = {4, 5}
+
+  myCmd 1
+init:
+  myCmd shown, end
+end:
+`)
+
+	script, err := Link(main, ui)
+
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]int{
+		"main":    0,
+		"ui.init": 3,
+		"ui.end":  4,
+	}, script.Labels())
+
+	require.Equal(t, map[string]int{
+		"hp":       VariableOffset,
+		"ui.shown": VariableOffset + 1,
+		"ui.list":  VariableOffset + 2,
+	}, script.Variables())
+
+	require.Equal(t, map[int]int{
+		VariableOffset:     10,
+		VariableOffset + 2: 4,
+		VariableOffset + 3: 5,
+	}, script.InitialValues())
+
+	require.Len(t, script.Commands(), 5)
+	require.Equal(t, CmdExit, script.Commands()[1].Type)
+
+	mainAt := func(line, col int) *SourceInfo {
+		return &SourceInfo{Filename: "scripts/main.fx", Line: line, Column: col}
+	}
+
+	uiAt := func(line, col int) *SourceInfo {
+		return &SourceInfo{Filename: "scripts/ui.fx", Line: line, Column: col}
+	}
+
+	require.Equal(t, []ExpressionNode{
+		&AddressNode{mainAt(5, 9), 3},
+		&IdentifierNode{mainAt(5, 18), VariableOffset + 1},
+		&ArrayAccessNode{mainAt(5, 28), VariableOffset + 2, &IntegerNode{mainAt(5, 36), 1}},
+		&IdentifierNode{mainAt(5, 40), VariableOffset},
+	}, script.Commands()[0].Args)
+
+	require.Equal(t, []ExpressionNode{
+		&IdentifierNode{uiAt(7, 9), VariableOffset + 1},
+		&AddressNode{uiAt(7, 16), 4},
+	}, script.Commands()[3].Args)
+
+	name, ok := script.VariableName(VariableOffset + 3)
+
+	require.True(t, ok)
+	require.Equal(t, "ui.list[1]", name)
+}
+
+func TestLink_Errors(t *testing.T) {
+	_, err := LoadScript([]byte("myCmd ui.init\n"), "main.fx", testParserConfig())
+
+	require.EqualError(t, err, "syntax error at main.fx:1:7: unknown label: 'ui.init'")
+
+	_, err = LoadScript([]byte("export init, hp\nvar hp\n"), "ui.fx", testParserConfig())
+
+	require.EqualError(t, err, "syntax error at ui.fx:1:8: unresolved symbol 'init'")
+
+	main := loadModule(t, "main.fx", `import ui, missing
+  myCmd ui.init
+  myCmd ui.hidden
+  myCmd ui.init[1]
+`)
+
+	ui := loadModule(t, "ui.fx", `export init
+init:
+hidden:
+`)
+
+	other := loadModule(t, "lib/ui.fx", "")
+
+	_, err = Link(main, ui, other)
+
+	require.EqualError(t, err, `link error at lib/ui.fx:1:1: duplicate module 'ui', previously declared at ui.fx:1:1
+link error at main.fx:1:12: unknown module: 'missing'
+link error at main.fx:3:9: 'hidden' is not exported by module 'ui'
+link error at main.fx:4:9: unexpected type 'label'`)
+}
+
+func TestLink_Shapes(t *testing.T) {
+	main := loadModule(t, "main.fx", `import ui
+struct Point x, y
+endstruct
+var p: Point
+myCmd ui.list[1]
+`)
+
+	ui := loadModule(t, "ui.fx", `export list, grid, e
+struct Point x, y, z
+endstruct
+var list[2]
+var grid[2][3]
+var e: Point
+`)
+
+	script, err := Link(main, ui)
+
+	require.NoError(t, err)
+	require.Equal(t, &Struct{Name: "Point", Fields: main.Structs()["Point"].Fields, Size: 2}, script.Structs()["Point"])
+	require.Equal(t, &Struct{Name: "ui.Point", Fields: ui.Structs()["Point"].Fields, Size: 3}, script.Structs()["ui.Point"])
+
+	dimensions, layout, ok := script.VariableShape("ui.grid")
+
+	require.True(t, ok)
+	require.Equal(t, []int{2, 3}, dimensions)
+	require.Nil(t, layout)
+
+	_, layout, ok = script.VariableShape("ui.e")
+
+	require.True(t, ok)
+	require.Same(t, script.Structs()["ui.Point"], layout)
+
+	_, err = LoadScript([]byte("import ui\nmyCmd ui.grid[1][2]\n"), "main.fx", testParserConfig())
+
+	require.EqualError(t, err, "syntax error at main.fx:2:17: 'ui.grid' can only be accessed with one index into a plain array")
+
+	main = loadModule(t, "main.fx", "import ui\nmyCmd ui.grid[1], ui.e[0], ui.e.x\n")
+
+	_, err = Link(main, loadModule(t, "ui.fx", "export grid, e\nstruct Point x, y\nendstruct\nvar grid[2][3]\nvar e: Point\n"))
+
+	require.EqualError(t, err, `link error at main.fx:2:7: 'ui.grid' can only be accessed with one index into a plain array
+link error at main.fx:2:19: 'ui.e' can only be accessed with one index into a plain array
+link error at main.fx:2:28: 'ui.e' can only be accessed with one index into a plain array`)
+}
+
+func TestLink_DuplicateSymbols(t *testing.T) {
+	main := loadModule(t, "main.fx", `import ui
+namespace ui
+  var count
+  start:
+endnamespace
+`)
+
+	ui := loadModule(t, "ui.fx", `export count
+var count
+def start 1
+`)
+
+	_, err := Link(main, ui)
+
+	require.EqualError(t, err, `link error at ui.fx:2:5: duplicate var 'ui.count', previously declared at main.fx:3:7
+link error at ui.fx:3:5: def 'ui.start' conflicts with label 'ui.start' declared at main.fx:4:3`)
+}
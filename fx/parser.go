@@ -1,5 +1,7 @@
 package fx
 
+import "errors"
+
 var eofToken = &Token{Type: EOF, Value: ""}
 
 var _ TokenSource = (*Lexer)(nil)
@@ -22,6 +24,19 @@ type ParserConfig struct {
 	CommandTypes CommandTypeTable
 	Identifiers  IdentifierTable
 	BufSize      int
+
+	Precedence PrecedenceTable
+	Operators  BinaryOperatorTable
+
+	Symbols SymbolTable
+
+	// Strict only resolves names to labels where a jump target is expected, which is the first
+	// argument of goto and call and the second argument of jumpIf. Elsewhere, unknown names are
+	// errors instead of references to labels.
+	Strict bool
+
+	// WarningFn receives conflicts between symbols of different kinds. Without it, they are errors.
+	WarningFn WarningFn
 }
 
 type Parser struct {
@@ -31,10 +46,29 @@ type Parser struct {
 	commandTypes CommandTypeTable
 	identifiers  IdentifierTable
 
+	precedence PrecedenceTable
+	operators  BinaryOperatorTable
+
+	symbols      SymbolTable
+	conditionals []*conditional
+	inDirective  bool
+
+	strict     bool
+	jumpTarget bool
+
+	namespaces      []*namespaceBlock
+	labelReferences []*labelReference
+
+	lastToken *Token
+
 	done bool
 
-	fs       *ParserFS
-	lookupFn LookupFn
+	// configErrs are the errors of the config, reported by Parse
+	configErrs ErrorList
+
+	fs        *ParserFS
+	lookupFn  LookupFn
+	warningFn WarningFn
 }
 
 func NewParser(src TokenSource, c *ParserConfig) *Parser {
@@ -44,6 +78,12 @@ func NewParser(src TokenSource, c *ParserConfig) *Parser {
 		bufSize = 32
 	}
 
+	precedence := c.Precedence
+
+	if precedence == nil {
+		precedence = DefaultPrecedence
+	}
+
 	p := Parser{
 		includedFiles: make(map[string]bool),
 		src:           NewTokenIterator("main", src, bufSize),
@@ -51,8 +91,20 @@ func NewParser(src TokenSource, c *ParserConfig) *Parser {
 		commandTypes: c.CommandTypes,
 		identifiers:  c.Identifiers,
 
-		fs:       c.FS,
-		lookupFn: c.LookupFn,
+		precedence: precedence,
+		operators:  c.Operators,
+
+		symbols: c.Symbols,
+
+		strict: c.Strict,
+
+		namespaces: []*namespaceBlock{{}},
+
+		fs:        c.FS,
+		lookupFn:  c.LookupFn,
+		warningFn: c.WarningFn,
+
+		configErrs: checkPrecedence(precedence, c.Operators),
 	}
 
 	return &p
@@ -71,7 +123,42 @@ func (p *Parser) advance() (tok *Token, err error) {
 		return
 	}
 
-	return p.src.NextToken()
+	if tok, err = p.src.NextToken(); err != nil {
+		return
+	}
+
+	p.lastToken = tok
+
+	return
+}
+
+// recover skips the remainder of the current line after a syntax error. start is the last token
+// consumed before the failing node, so an error that did not consume anything still makes progress.
+func (p *Parser) recover(start *Token) (err error) {
+	if p.lastToken != start && (p.lastToken.Type == NEWLINE || p.lastToken.Type == EOF) {
+		return
+	}
+
+	_, err = p.consumeUntil(NEWLINE)
+
+	return
+}
+
+// positioned makes sure every reported error carries a SourceInfo.
+func (p *Parser) positioned(err error) error {
+	var sourceErr SourceError
+
+	if errors.As(err, &sourceErr) && sourceErr.Source() != nil {
+		return err
+	}
+
+	sourceInfo := &SourceInfo{Filename: p.src.Filename()}
+
+	if p.lastToken != nil && p.lastToken.SourceInfo != nil {
+		sourceInfo = p.lastToken.SourceInfo
+	}
+
+	return &SyntaxError{sourceInfo, err}
 }
 
 func (p *Parser) consumeUntil(end TokenType) (tokens []*Token, err error) {
@@ -107,14 +194,7 @@ func (p *Parser) parseLabel(script *Script, tok *Token) (expr ExpressionNode, er
 		labelName = tok.Value
 	}
 
-	addressNode := &AddressNode{
-		Address:    0,
-		SourceInfo: tok.SourceInfo,
-	}
-
-	script.addSymbol(labelName, addressNode)
-
-	expr = addressNode
+	expr = p.referenceLabel(script, labelName, tok.SourceInfo)
 
 	return
 }
@@ -130,7 +210,13 @@ func (p *Parser) parseDefine(script *Script) (err error) {
 		return
 	}
 
-	script.defines[nameIdent.Value], err = p.parseExpression(script)
+	var name string
+
+	if name, err = p.declare(script, SymbolDefine, nameIdent, nameIdent.Value, script.isDefine); err != nil {
+		return
+	}
+
+	script.defines[name], err = p.parseExpression(script)
 
 	return
 }
@@ -140,9 +226,11 @@ func (p *Parser) parseCommand(script *Script) (err error) {
 		Type: CmdNone,
 	}
 
+	var cmdName string
 	var tok *Token
 
 	var macro *Macro
+	var macroTok *Token
 	var macroArgs [][]*Token
 
 	for {
@@ -154,11 +242,21 @@ func (p *Parser) parseCommand(script *Script) (err error) {
 			_, err = p.advance()
 
 			if cmd.Type != CmdNone {
-				script.commands = append(script.commands, &cmd)
+				script.addCommand(&cmd, cmdName)
 			} else if macro != nil {
 				var tokSrc TokenSource
 
-				if tokSrc, err = macro.Body(macroArgs); err != nil {
+				if err = macro.checkArgCount(len(macroArgs)); err != nil {
+					err = &SyntaxError{macroTok.SourceInfo, err}
+					return
+				}
+
+				if len(macroTok.SourceInfo.Expansions()) >= maxMacroDepth {
+					err = &SyntaxError{macroTok.SourceInfo, &MacroDepthError{macro.name, maxMacroDepth}}
+					return
+				}
+
+				if tokSrc, err = macro.Body(macroTok.SourceInfo, macroArgs); err != nil {
 					return
 				}
 
@@ -177,19 +275,31 @@ func (p *Parser) parseCommand(script *Script) (err error) {
 				return
 			}
 
-			cmdType, ok := p.getCommandType(tok.Value)
+			var name string
+
+			if name, err = p.parseQualifiedName(tok); err != nil {
+				return
+			}
+
+			cmdType, ok := p.getCommandType(name)
 
 			if !ok {
-				m, ok := script.macros[tok.Value]
+				if name, ok, err = p.lookup(tok, name, script.isMacro); err != nil {
+					return
+				}
 
 				if ok {
-					macro = m
+					macro = script.macros[name]
+					macroTok = tok
+
+					script.addReference(SymbolMacro, name, tok.SourceInfo)
 				} else {
-					err = &SyntaxError{tok.SourceInfo, &UnknownCommandError{tok.Value}}
+					err = &SyntaxError{tok.SourceInfo, &UnknownCommandError{name}}
 					return
 				}
 			} else {
 				cmd.Type = cmdType
+				cmdName = name
 			}
 		} else {
 			if macro != nil {
@@ -226,7 +336,13 @@ func (p *Parser) parseCommand(script *Script) (err error) {
 			} else {
 				var argNode ExpressionNode
 
-				if argNode, err = p.parseExpression(script); err != nil {
+				p.jumpTarget = isJumpTarget(cmd.Type, len(cmd.Args))
+
+				argNode, err = p.parseExpression(script)
+
+				p.jumpTarget = false
+
+				if err != nil {
 					return
 				}
 
@@ -257,17 +373,24 @@ func (p *Parser) parseLabelDeclaration(script *Script, prefixed bool) (err error
 		return
 	}
 
-	if _, err = p.advance(); err != nil {
+	var name string
+
+	if name, err = p.parseQualifiedName(nameIdent); err != nil {
 		return
 	}
 
-	var name string
+	if _, err = p.advance(); err != nil {
+		return
+	}
 
 	if prefixed {
-		name = p.src.Prefixed(nameIdent.Value)
+		name = p.src.Prefixed(name)
 	} else {
-		p.src.SetPrefix(nameIdent.Value)
-		name = nameIdent.Value
+		p.src.SetPrefix(name)
+	}
+
+	if name, err = p.declare(script, SymbolLabel, nameIdent, name, script.isLabel); err != nil {
+		return
 	}
 
 	script.labels[name] = script.PC()
@@ -297,9 +420,17 @@ func (p *Parser) dispatchFirstClassIdentParse(script *Script, tok *Token) (err e
 			err = p.parseLabelDeclaration(script, true)
 			return
 		}
-	} else if tok.Type == IDENT && next1.Type == COLON {
-		err = p.parseLabelDeclaration(script, false)
-		return
+	} else if tok.Type == IDENT {
+		var ok bool
+
+		if ok, err = p.labelDeclarationAhead(); err != nil {
+			return
+		}
+
+		if ok {
+			err = p.parseLabelDeclaration(script, false)
+			return
+		}
 	}
 
 	return p.parseCommand(script)
@@ -323,7 +454,7 @@ func (p *Parser) parseNextNode(script *Script, end TokenType) (ok bool, err erro
 			return
 		}
 	case PREPROCESSOR:
-		if err = p.parsePreprocessorDirective(); err != nil {
+		if err = p.parsePreprocessorDirective(script); err != nil {
 			return
 		}
 	case MACRO:
@@ -338,6 +469,34 @@ func (p *Parser) parseNextNode(script *Script, end TokenType) (ok bool, err erro
 		if err = p.parseVariableDeclaration(script); err != nil {
 			return
 		}
+	case IMPORT:
+		if err = p.parseImport(script); err != nil {
+			return
+		}
+	case EXPORT:
+		if err = p.parseExport(script); err != nil {
+			return
+		}
+	case NAMESPACE:
+		if err = p.parseNamespace(script); err != nil {
+			return
+		}
+	case ENDNAMESPACE:
+		if err = p.parseEndNamespace(); err != nil {
+			return
+		}
+	case USING:
+		if err = p.parseUsing(script); err != nil {
+			return
+		}
+	case STRUCT:
+		if err = p.parseStruct(script); err != nil {
+			return
+		}
+	case DATA:
+		if err = p.parseData(script); err != nil {
+			return
+		}
 	case PERCENT, IDENT:
 		if err = p.dispatchFirstClassIdentParse(script, tok); err != nil {
 			return
@@ -354,13 +513,14 @@ func (p *Parser) parseNextNode(script *Script, end TokenType) (ok bool, err erro
 	return
 }
 
-func augmentAddressNodes(script *Script) (err error) {
+func augmentAddressNodes(script *Script) (errs ErrorList) {
 	for label, addrNodes := range script.symbols {
 		if len(addrNodes) != 0 {
 			pc, ok := script.labels[label]
 
 			if !ok {
-				return &SyntaxError{addrNodes[0].SourceInfo, &UnknownLabelError{label}}
+				errs = append(errs, &SyntaxError{addrNodes[0].SourceInfo, &UnknownLabelError{label}})
+				continue
 			}
 
 			for _, addr := range addrNodes {
@@ -369,21 +529,60 @@ func augmentAddressNodes(script *Script) (err error) {
 		}
 	}
 
+	errs.sort()
+
 	return
 }
 
-func (p *Parser) Parse() (script *Script, err error) {
-	script = newScript()
+// parseNodes parses until the token source is exhausted and recovers from errors at the end of the
+// failing line.
+func (p *Parser) parseNodes(script *Script) (errs ErrorList) {
+	var err error
 
 	ok := true
 
 	for ok {
+		start := p.lastToken
+
+		errs = append(errs, p.closeConditionals()...)
+
 		if ok, err = p.parseNextNode(script, EOF); err != nil {
-			return
+			errs = append(errs, p.positioned(err))
+
+			if err = p.recover(start); err != nil {
+				errs = append(errs, p.positioned(err))
+				break
+			}
+
+			ok = p.lastToken == nil || p.lastToken.Type != EOF
 		}
 	}
 
-	err = augmentAddressNodes(script)
+	if len(p.conditionals) > 0 {
+		c := p.conditionals[len(p.conditionals)-1]
+		errs = append(errs, &SyntaxError{c.directive.SourceInfo, &UnbalancedConditionalError{directiveName(c.directive.Value)}})
+	}
+
+	errs = append(errs, p.checkNamespaces()...)
+	errs = append(errs, p.resolveLabelReferences(script)...)
+
+	return
+}
+
+func (p *Parser) Parse() (script *Script, err error) {
+	script = newScript()
+	script.operators = p.operators
+	script.filename = p.src.Filename()
+	script.module = moduleName(script.filename)
+
+	errs := append(ErrorList{}, p.configErrs...)
+	errs = append(errs, p.parseNodes(script)...)
+	errs = append(errs, augmentAddressNodes(script)...)
+	errs = append(errs, checkExports(script)...)
+
+	errs.sort()
+
+	err = errs.Err()
 
 	return
 }
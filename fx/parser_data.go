@@ -0,0 +1,202 @@
+package fx
+
+// parseInitializer parses the initial values of a var after its declaration, `= value` or
+// `= {value, …}`. The values fill the addresses of the var from its first one, the rest keeps the
+// value of the environment.
+func (p *Parser) parseInitializer(script *Script, nameTok *Token, name string, offset int, size int) (err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var next *Token
+
+	if next, err = p.peek(); err != nil {
+		return
+	}
+
+	var values []int
+
+	if next.Type == LBRACE {
+		if values, err = p.parseValueList(script); err != nil {
+			return
+		}
+	} else {
+		var v int
+
+		if v, err = p.parseStaticValue(script); err != nil {
+			return
+		}
+
+		values = []int{v}
+	}
+
+	if len(values) > size {
+		err = &SyntaxError{nameTok.SourceInfo, &InitializerSizeError{name, size, len(values)}}
+		return
+	}
+
+	for i, v := range values {
+		script.initialValues[offset+i] = v
+	}
+
+	return
+}
+
+// parseStaticValue parses an expression that is evaluated at parse time, e.g. an initial value.
+func (p *Parser) parseStaticValue(script *Script) (v int, err error) {
+	var tok *Token
+
+	if tok, err = p.peek(); err != nil {
+		return
+	}
+
+	var expr ExpressionNode
+
+	if expr, err = p.parseExpression(script); err != nil {
+		return
+	}
+
+	if expr == nil {
+		err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{NUMBER, IDENT}, tok}}
+		return
+	}
+
+	return p.evalStaticExpression(script, expr, tok)
+}
+
+// parseValueList parses the comma separated values of `{1, 2, 3}`.
+func (p *Parser) parseValueList(script *Script) (values []int, err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var tok *Token
+
+	if tok, err = p.peek(); err != nil {
+		return
+	}
+
+	if tok.Type == RBRACE {
+		_, err = p.advance()
+		return
+	}
+
+	for {
+		var v int
+
+		if v, err = p.parseStaticValue(script); err != nil {
+			return
+		}
+
+		values = append(values, v)
+
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		switch tok.Type {
+		case COMMA:
+		case RBRACE:
+			return
+		default:
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{COMMA, RBRACE}, tok}}
+			return
+		}
+	}
+}
+
+// parseData parses `data name 1, 2, 3 … enddata`, a read-only table with one element per value.
+// Values are separated by commas or newlines.
+func (p *Parser) parseData(script *Script) (err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var nameTok *Token
+
+	if nameTok, err = p.advance(); err != nil {
+		return
+	}
+
+	if nameTok.Type != IDENT {
+		err = &SyntaxError{nameTok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, nameTok}}
+		return
+	}
+
+	var name string
+
+	if name, err = p.parseQualifiedName(nameTok); err != nil {
+		return
+	}
+
+	if name, err = p.declare(script, SymbolVariable, nameTok, name, script.isVariable); err != nil {
+		return
+	}
+
+	var values []int
+	var tok *Token
+
+	for {
+		if tok, err = p.peek(); err != nil {
+			return
+		}
+
+		switch tok.Type {
+		case COMMA, NEWLINE:
+			if _, err = p.advance(); err != nil {
+				return
+			}
+
+			continue
+		case ENDDATA:
+			if _, err = p.advance(); err != nil {
+				return
+			}
+
+			if err = p.expectEndOfLine(); err != nil {
+				return
+			}
+		case EOF:
+			err = &SyntaxError{nameTok.SourceInfo, &UnclosedDataError{name}}
+			return
+		default:
+			var v int
+
+			if v, err = p.parseStaticValue(script); err != nil {
+				return
+			}
+
+			values = append(values, v)
+
+			continue
+		}
+
+		break
+	}
+
+	size := max(len(values), 1)
+	offset := script.addVariable(name, size)
+
+	script.shapes[name] = &variableShape{dimensions: []int{size}}
+
+	for i := range size {
+		script.readOnly[offset+i] = true
+	}
+
+	for i, v := range values {
+		script.initialValues[offset+i] = v
+	}
+
+	return
+}
+
+// InitialValues returns the values of var and data addresses that are written by
+// vm.Runtime.InitMemory before the script runs.
+func (s *Script) InitialValues() map[int]int {
+	return s.initialValues
+}
+
+// IsReadOnly reports whether addr belongs to a data table.
+func (s *Script) IsReadOnly(addr int) bool {
+	return s.readOnly[addr]
+}
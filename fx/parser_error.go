@@ -1,20 +1,104 @@
 package fx
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
+	"strings"
 )
 
+// SourceError is implemented by all errors that carry a SourceInfo.
+type SourceError interface {
+	error
+	Source() *SourceInfo
+}
+
+// ErrorList holds all errors reported while parsing a script.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (l ErrorList) Unwrap() []error {
+	return l
+}
+
+// Err returns nil for an empty list, so it can be returned as an error.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
+
+// sort orders the errors by position. Errors without a position come first, in the order they
+// were reported.
+func (l ErrorList) sort() {
+	slices.SortStableFunc(l, func(a, b error) int {
+		sa, sb := errorSource(a), errorSource(b)
+
+		if sa == nil || sb == nil {
+			return cmp.Compare(boolRank(sa != nil), boolRank(sb != nil))
+		}
+
+		return cmp.Or(
+			cmp.Compare(sa.Filename, sb.Filename),
+			cmp.Compare(sa.Line, sb.Line),
+			cmp.Compare(sa.Column, sb.Column),
+		)
+	})
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func errorSource(err error) *SourceInfo {
+	if sourceErr, ok := err.(SourceError); ok {
+		return sourceErr.Source()
+	}
+
+	return nil
+}
+
 type UnexpectedTokenError struct {
 	Expected []TokenType
 	Token    *Token
 }
 
 func (e *UnexpectedTokenError) Error() string {
-	if len(e.Expected) == 0 {
-		return fmt.Sprintf("unexpected token '%s'", e.Token)
+	expected := e.ExpectedNames()
+
+	switch len(expected) {
+	case 0:
+		return fmt.Sprintf("unexpected %s", e.Token.Describe())
+	case 1:
+		return fmt.Sprintf("unexpected %s, expected %s", e.Token.Describe(), expected[0])
+	default:
+		return fmt.Sprintf("unexpected %s, expected one of %s", e.Token.Describe(), strings.Join(expected, ", "))
+	}
+}
+
+func (e *UnexpectedTokenError) ExpectedNames() []string {
+	names := make([]string, len(e.Expected))
+
+	for i, typ := range e.Expected {
+		names[i] = typ.Describe()
 	}
 
-	return fmt.Sprintf("unexpected token '%s', expected %v", e.Token, e.Expected)
+	return names
 }
 
 type UnknownCommandError struct {
@@ -33,6 +117,19 @@ func (e *UnknownLabelError) Error() string {
 	return fmt.Sprintf("unknown label: '%s'", e.Label)
 }
 
+type UnknownIdentifierError struct {
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownIdentifierError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("unknown identifier: '%s'", e.Name)
+	}
+
+	return fmt.Sprintf("unknown identifier: '%s', did you mean '%s'?", e.Name, strings.Join(e.Suggestions, "' or '"))
+}
+
 type UnknownPreprocessorDirectiveError struct {
 	Directive string
 }
@@ -41,6 +138,14 @@ func (e *UnknownPreprocessorDirectiveError) Error() string {
 	return fmt.Sprintf("unknown preprocessor directive: '%s'", e.Directive)
 }
 
+type UnbalancedConditionalError struct {
+	Directive string
+}
+
+func (e *UnbalancedConditionalError) Error() string {
+	return fmt.Sprintf("unbalanced conditional directive: '@%s'", e.Directive)
+}
+
 type SyntaxError struct {
 	*SourceInfo
 	Err error
@@ -50,14 +155,42 @@ func (e *SyntaxError) Error() string {
 	return fmt.Sprintf("syntax error at %s: %s", e.SourceInfo, e.Err)
 }
 
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
 type UnknownOperatorError struct {
 	TokenType TokenType
+
+	// Operator is the operator as given to the Builder, it is reported instead of TokenType if set.
+	Operator string
 }
 
 func (e *UnknownOperatorError) Error() string {
+	if e.Operator != "" {
+		return fmt.Sprintf("unknown operator: '%s'", e.Operator)
+	}
+
 	return fmt.Sprintf("unknown operator: '%s'", e.TokenType)
 }
 
+type UndefinedOperatorError struct {
+	Operator string
+}
+
+func (e *UndefinedOperatorError) Error() string {
+	return fmt.Sprintf("undefined operator: '%s'", e.Operator)
+}
+
+type NegativePrecedenceError struct {
+	Operator   string
+	Precedence int
+}
+
+func (e *NegativePrecedenceError) Error() string {
+	return fmt.Sprintf("precedence %d of operator '%s' is negative", e.Precedence, e.Operator)
+}
+
 type RuntimeError struct {
 	*SourceInfo
 	Err error
@@ -67,6 +200,42 @@ func (e *RuntimeError) Error() string {
 	return fmt.Sprintf("runtime error at %s: %s", e.SourceInfo, e.Err)
 }
 
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// IndexOutOfRangeError is an access of an array element outside the array, at the position of the
+// access.
+type IndexOutOfRangeError struct {
+	*SourceInfo
+	Variable string
+	Index    int
+	Size     int
+}
+
+func (e *IndexOutOfRangeError) Error() string {
+	return fmt.Sprintf("index %d out of range for '%s' with %d elements", e.Index, e.Variable, e.Size)
+}
+
+// ReadOnlyError is a write to an element of a data table.
+type ReadOnlyError struct {
+	Variable string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("'%s' is read-only", e.Variable)
+}
+
+// StackOverflowError is a push onto a full call or operand stack.
+type StackOverflowError struct {
+	Stack string
+	Size  int
+}
+
+func (e *StackOverflowError) Error() string {
+	return fmt.Sprintf("%s stack overflow, it holds %d values", e.Stack, e.Size)
+}
+
 type UnexpectedBinaryOpError struct {
 	Left  any
 	Right any
@@ -100,6 +269,47 @@ func (e *MissingMacroArgumentError) Error() string {
 	return fmt.Sprintf("missing macro argument '%s'", e.Name)
 }
 
+type RequiredMacroParamError struct {
+	Name string
+}
+
+func (e *RequiredMacroParamError) Error() string {
+	return fmt.Sprintf("macro parameter '$%s' without default follows a parameter with default", e.Name)
+}
+
+type MacroDepthError struct {
+	Macro string
+	Depth int
+}
+
+func (e *MacroDepthError) Error() string {
+	return fmt.Sprintf("macro '%s' is nested more than %d levels deep", e.Macro, e.Depth)
+}
+
+type MacroArgumentCountError struct {
+	Macro string
+	Min   int
+	Max   int
+	Got   int
+}
+
+func (e *MacroArgumentCountError) Error() string {
+	switch {
+	case e.Max < 0:
+		return fmt.Sprintf("macro '%s' expects at least %d argument(s), got %d", e.Macro, e.Min, e.Got)
+	case e.Min == e.Max:
+		return fmt.Sprintf("macro '%s' expects %d argument(s), got %d", e.Macro, e.Min, e.Got)
+	default:
+		return fmt.Sprintf("macro '%s' expects %d to %d arguments, got %d", e.Macro, e.Min, e.Max, e.Got)
+	}
+}
+
+type UnbalancedMacroLoopError struct{}
+
+func (e *UnbalancedMacroLoopError) Error() string {
+	return "unbalanced '@for' and '@endfor' in macro body"
+}
+
 type UnresolvedSymbolError struct {
 	Symbol string
 }
@@ -133,6 +343,170 @@ func (e *InvalidPreprocessorValueError) Error() string {
 	return fmt.Sprintf("invalid preprocessor value for directive %s: %s", e.Directive, e.Value)
 }
 
+type UnknownModuleError struct {
+	Module string
+}
+
+func (e *UnknownModuleError) Error() string {
+	return fmt.Sprintf("unknown module: '%s'", e.Module)
+}
+
+type NotExportedError struct {
+	Module string
+	Name   string
+}
+
+func (e *NotExportedError) Error() string {
+	return fmt.Sprintf("'%s' is not exported by module '%s'", e.Name, e.Module)
+}
+
+// ImportedShapeError is an access of a var of another module with several indices or a field, or
+// one index into a var with several dimensions or a struct. Only plain arrays can be indexed
+// across modules.
+type ImportedShapeError struct {
+	Module string
+	Name   string
+}
+
+func (e *ImportedShapeError) Error() string {
+	return fmt.Sprintf("'%s.%s' can only be accessed with one index into a plain array", e.Module, e.Name)
+}
+
+type DuplicateSymbolError struct {
+	Kind     SymbolKind
+	Name     string
+	Previous *SourceInfo
+}
+
+func (e *DuplicateSymbolError) Error() string {
+	return fmt.Sprintf("duplicate %s '%s', previously declared at %s", e.Kind, e.Name, e.Previous.Position())
+}
+
+type AmbiguousSymbolError struct {
+	Name       string
+	Candidates []string
+}
+
+func (e *AmbiguousSymbolError) Error() string {
+	return fmt.Sprintf("ambiguous symbol '%s', could be '%s'", e.Name, strings.Join(e.Candidates, "' or '"))
+}
+
+type UnknownNamespaceError struct {
+	Namespace string
+}
+
+func (e *UnknownNamespaceError) Error() string {
+	return fmt.Sprintf("unknown namespace: '%s'", e.Namespace)
+}
+
+type UnclosedNamespaceError struct {
+	Namespace string
+}
+
+func (e *UnclosedNamespaceError) Error() string {
+	return fmt.Sprintf("namespace '%s' is not closed", e.Namespace)
+}
+
+type UnknownStructError struct {
+	Struct string
+}
+
+func (e *UnknownStructError) Error() string {
+	return fmt.Sprintf("unknown struct: '%s'", e.Struct)
+}
+
+type UnknownFieldError struct {
+	Struct string
+	Field  string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("struct '%s' has no field '%s'", e.Struct, e.Field)
+}
+
+type UnclosedStructError struct {
+	Struct string
+}
+
+func (e *UnclosedStructError) Error() string {
+	return fmt.Sprintf("struct '%s' is not closed", e.Struct)
+}
+
+type DuplicateFieldError struct {
+	Struct string
+	Field  string
+}
+
+func (e *DuplicateFieldError) Error() string {
+	return fmt.Sprintf("duplicate field '%s' in struct '%s'", e.Field, e.Struct)
+}
+
+type InvalidLengthError struct {
+	Name   string
+	Length int
+}
+
+func (e *InvalidLengthError) Error() string {
+	return fmt.Sprintf("length %d of '%s' is not positive", e.Length, e.Name)
+}
+
+type EmptyStructError struct {
+	Struct string
+}
+
+func (e *EmptyStructError) Error() string {
+	return fmt.Sprintf("struct '%s' has no fields", e.Struct)
+}
+
+type UnclosedDataError struct {
+	Variable string
+}
+
+func (e *UnclosedDataError) Error() string {
+	return fmt.Sprintf("data '%s' is not closed", e.Variable)
+}
+
+type InitializerSizeError struct {
+	Variable string
+	Size     int
+	Count    int
+}
+
+func (e *InitializerSizeError) Error() string {
+	return fmt.Sprintf("%d values for '%s' with %d elements", e.Count, e.Variable, e.Size)
+}
+
+type SymbolConflictError struct {
+	Kind      SymbolKind
+	Name      string
+	OtherKind SymbolKind
+	OtherName string
+
+	// Previous is the declaration of the other symbol, nil for identifiers and commands.
+	Previous *SourceInfo
+}
+
+func (e *SymbolConflictError) Error() string {
+	if e.Previous == nil {
+		return fmt.Sprintf("%s '%s' conflicts with %s '%s'", e.Kind, e.Name, e.OtherKind, e.OtherName)
+	}
+
+	return fmt.Sprintf("%s '%s' conflicts with %s '%s' declared at %s", e.Kind, e.Name, e.OtherKind, e.OtherName, e.Previous.Position())
+}
+
+type LinkError struct {
+	*SourceInfo
+	Err error
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("link error at %s: %s", e.SourceInfo, e.Err)
+}
+
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
+
 type ParseError struct {
 	*SourceInfo
 	Err error
@@ -142,6 +516,10 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("parse error at %s: %s", e.SourceInfo, e.Err)
 }
 
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 type UnexpectedTypeError struct {
 	TypeName string
 }
@@ -149,3 +527,56 @@ type UnexpectedTypeError struct {
 func (e *UnexpectedTypeError) Error() string {
 	return fmt.Sprintf("unexpected type '%s'", e.TypeName)
 }
+
+type FormatError struct {
+	*SourceInfo
+	Expected *Token
+	Got      *Token
+}
+
+func (e *FormatError) Error() string {
+	describe := func(tok *Token) string {
+		if tok == nil {
+			return "end of file"
+		}
+
+		return tok.Describe()
+	}
+
+	return fmt.Sprintf("format error at %s: formatting changed %s to %s", e.SourceInfo, describe(e.Expected), describe(e.Got))
+}
+
+type FormatChangeError struct {
+	*SourceInfo
+	Change string
+}
+
+func (e *FormatChangeError) Error() string {
+	return fmt.Sprintf("format error at %s: formatting changed %s", e.SourceInfo, e.Change)
+}
+
+type EncodingError struct {
+	Reason string
+}
+
+func (e *EncodingError) Error() string {
+	return "invalid compiled script: " + e.Reason
+}
+
+type ChecksumError struct {
+	Expected uint32
+	Got      uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("compiled script is corrupted: checksum is %08x, expected %08x", e.Got, e.Expected)
+}
+
+type VersionError struct {
+	Version   uint16
+	Supported uint16
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("compiled script has version %d, supported is version %d", e.Version, e.Supported)
+}
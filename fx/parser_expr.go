@@ -34,31 +34,11 @@ func (p *Parser) parsePrimary(script *Script) (expr ExpressionNode, err error) {
 }
 
 func (p *Parser) parseExpression(script *Script) (ExpressionNode, error) {
-	return p.parseEquality(script)
+	return p.parseBinary(script, 0)
 }
 
-func (p *Parser) parseMultiplicative(script *Script) (expr ExpressionNode, err error) {
-	return p.parseBinary(script, p.parsePrimary, MUL, DIV, PERCENT)
-}
-
-func (p *Parser) parseAdditive(script *Script) (expr ExpressionNode, err error) {
-	return p.parseBinary(script, p.parseMultiplicative, ADD, SUB, AND, OR, INV)
-}
-
-func (p *Parser) parseEquality(script *Script) (ExpressionNode, error) {
-	return p.parseBinary(script, p.parseComparison, EQ, NEQ)
-}
-
-func (p *Parser) parseComparison(script *Script) (expr ExpressionNode, err error) {
-	return p.parseBinary(script, p.parseShift, LT, GT, LTE, GTE)
-}
-
-func (p *Parser) parseShift(script *Script) (expr ExpressionNode, err error) {
-	return p.parseBinary(script, p.parseAdditive, SHL, SHR)
-}
-
-func (p *Parser) parseBinary(script *Script, next func(script *Script) (ExpressionNode, error), ops ...TokenType) (expr ExpressionNode, err error) {
-	if expr, err = next(script); err != nil {
+func (p *Parser) parseBinary(script *Script, minPrecedence int) (expr ExpressionNode, err error) {
+	if expr, err = p.parsePrimary(script); err != nil {
 		return
 	}
 
@@ -69,7 +49,9 @@ func (p *Parser) parseBinary(script *Script, next func(script *Script) (Expressi
 			return
 		}
 
-		if !contains(ops, current.Type) {
+		precedence, ok := p.binaryPrecedence(current)
+
+		if !ok || precedence < minPrecedence {
 			break
 		}
 
@@ -81,7 +63,7 @@ func (p *Parser) parseBinary(script *Script, next func(script *Script) (Expressi
 
 		var right ExpressionNode
 
-		if right, err = next(script); err != nil {
+		if right, err = p.parseBinary(script, precedence+1); err != nil {
 			return
 		}
 
@@ -96,26 +78,89 @@ func (p *Parser) parseBinary(script *Script, next func(script *Script) (Expressi
 	return
 }
 
-func contains(ops []TokenType, tokType TokenType) bool {
-	for _, op := range ops {
-		if op == tokType {
-			return true
+func (p *Parser) parseExpressionIdent(script *Script, tok *Token) (expr ExpressionNode, err error) {
+	var ok bool
+
+	name := tok.Value
+
+	if name == "len" || name == "sizeof" {
+		var next *Token
+
+		if next, err = p.peek(); err != nil {
+			return
+		}
+
+		if next.Type == LPAREN {
+			return p.parseBuiltin(script, tok)
 		}
 	}
 
-	return false
-}
+	if !p.inDirective {
+		if name, err = p.parseQualifiedName(tok); err != nil {
+			return
+		}
+	}
 
-func (p *Parser) parseExpressionIdent(script *Script, tok *Token) (expr ExpressionNode, err error) {
-	var ok bool
+	if module, rest, qualified := strings.Cut(name, "."); qualified {
+		if _, ok = script.imports[module]; ok {
+			return p.parseImportedSymbol(script, tok, rest)
+		}
+	}
 
-	if expr, ok = script.defines[tok.Value]; ok {
+	var defineName string
+
+	if defineName, ok, err = p.lookup(tok, name, script.isDefine); err != nil {
 		return
 	}
 
-	var varIdent int
+	if ok {
+		script.addReference(SymbolDefine, defineName, tok.SourceInfo)
+		expr = script.defines[defineName]
+		return
+	}
+
+	if p.inDirective {
+		var v int
+
+		if v, ok = p.symbols[tok.Value]; !ok {
+			err = &SyntaxError{tok.SourceInfo, &UnresolvedSymbolError{tok.Value}}
+			return
+		}
+
+		expr = &IntegerNode{
+			Value:      v,
+			SourceInfo: tok.SourceInfo,
+		}
+		return
+	}
+
+	var varName string
+
+	if varName, ok, err = p.lookup(tok, name, script.isVariable); err != nil {
+		return
+	}
+
+	var field string
+
+	if i := strings.LastIndex(name, "."); !ok && i >= 0 {
+		// a field like `e.hp` of a struct var
+		if varName, ok, err = p.lookup(tok, name[:i], script.isStructVariable); err != nil {
+			return
+		}
+
+		field = name[i+1:]
+	}
+
+	if ok {
+		varIdent := script.variables[varName]
+
+		script.addReference(SymbolVariable, varName, tok.SourceInfo)
+
+		if v, shaped := script.shapes[varName]; shaped {
+			expr, err = p.parseShapedAccess(script, tok, varIdent, v, field)
+			return
+		}
 
-	if varIdent, ok = script.variables[tok.Value]; ok {
 		var nextToken *Token
 
 		if nextToken, err = p.peek(); err != nil {
@@ -136,7 +181,9 @@ func (p *Parser) parseExpressionIdent(script *Script, tok *Token) (expr Expressi
 
 	var identifier Identifier
 
-	if identifier, ok = p.getIdentifier(tok.Value); ok {
+	if identifier, ok = p.getIdentifier(name); ok {
+		script.addReference(SymbolIdentifier, name, tok.SourceInfo)
+
 		expr = &IdentifierNode{
 			Identifier: identifier,
 			SourceInfo: tok.SourceInfo,
@@ -144,7 +191,108 @@ func (p *Parser) parseExpressionIdent(script *Script, tok *Token) (expr Expressi
 		return
 	}
 
-	return p.parseLabel(script, tok)
+	if p.strict && !p.jumpTarget {
+		err = &SyntaxError{tok.SourceInfo, &UnknownIdentifierError{name, p.suggest(script, name)}}
+		return
+	}
+
+	expr = p.referenceLabel(script, name, tok.SourceInfo)
+
+	return
+}
+
+// parseBuiltin parses `len(name)`, the number of elements of the first dimension of a var, and
+// `sizeof(name)`, the number of addresses taken by a var or a var of a struct. Both are evaluated
+// at parse time. Indices like in `len(grid[0])` select the next dimension, their values are not
+// used.
+func (p *Parser) parseBuiltin(script *Script, tok *Token) (expr ExpressionNode, err error) {
+	var next *Token
+
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var nameTok *Token
+
+	if nameTok, err = p.advance(); err != nil {
+		return
+	}
+
+	if nameTok.Type != IDENT {
+		err = &SyntaxError{nameTok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, nameTok}}
+		return
+	}
+
+	var name string
+
+	if name, err = p.parseQualifiedName(nameTok); err != nil {
+		return
+	}
+
+	depth := 0
+
+	for {
+		if next, err = p.peek(); err != nil {
+			return
+		}
+
+		if next.Type != LBRACKET {
+			break
+		}
+
+		if _, _, err = p.parseVariableBracketExpression(script); err != nil {
+			return
+		}
+
+		depth++
+	}
+
+	if next, err = p.advance(); err != nil {
+		return
+	}
+
+	if next.Type != RPAREN {
+		err = &SyntaxError{next.SourceInfo, &UnexpectedTokenError{[]TokenType{RPAREN}, next}}
+		return
+	}
+
+	var qualified string
+	var ok bool
+
+	if tok.Value == "sizeof" {
+		if qualified, ok, err = p.lookup(nameTok, name, script.isStruct); err != nil {
+			return
+		}
+
+		if ok && depth == 0 {
+			script.addReference(SymbolStruct, qualified, nameTok.SourceInfo)
+			expr = &IntegerNode{tok.SourceInfo, script.structs[qualified].Size}
+			return
+		}
+	}
+
+	if qualified, ok, err = p.lookup(nameTok, name, script.isVariable); err != nil {
+		return
+	}
+
+	if !ok {
+		err = &SyntaxError{nameTok.SourceInfo, &UnresolvedSymbolError{name}}
+		return
+	}
+
+	script.addReference(SymbolVariable, qualified, nameTok.SourceInfo)
+
+	n := 1
+
+	if v, shaped := script.shapes[qualified]; shaped && tok.Value == "sizeof" {
+		n = v.size(depth)
+	} else if shaped {
+		n = v.length(depth)
+	}
+
+	expr = &IntegerNode{tok.SourceInfo, n}
+
+	return
 }
 
 func (p *Parser) parseUnary(script *Script, tok *Token) (expr *UnaryOpNode, err error) {
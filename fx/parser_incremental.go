@@ -0,0 +1,194 @@
+package fx
+
+import "maps"
+
+// snapshot records the size and the declarations of a script, so everything a failed Feed added
+// can be discarded.
+type snapshot struct {
+	commands     int
+	declarations int
+	references   int
+
+	commandNames map[CommandType]string
+
+	labels  map[string]int
+	symbols map[string]int
+	defines map[string]ExpressionNode
+	macros  map[string]*Macro
+
+	variables     map[string]int
+	variableNames map[int]string
+	variableSizes map[int]int
+	variableSpace int
+
+	initialValues map[int]int
+	readOnly      map[int]bool
+
+	structs map[string]*Struct
+	shapes  map[string]*variableShape
+
+	imports    map[string]*SourceInfo
+	exports    map[string]*SourceInfo
+	namespaces map[string]*SourceInfo
+}
+
+func (s *Script) snapshot() *snapshot {
+	symbols := make(map[string]int, len(s.symbols))
+
+	for label, addrNodes := range s.symbols {
+		symbols[label] = len(addrNodes)
+	}
+
+	return &snapshot{
+		commands:     len(s.commands),
+		declarations: len(s.declarations),
+		references:   len(s.references),
+
+		commandNames: maps.Clone(s.commandNames),
+
+		labels:  maps.Clone(s.labels),
+		symbols: symbols,
+		defines: maps.Clone(s.defines),
+		macros:  maps.Clone(s.macros),
+
+		variables:     maps.Clone(s.variables),
+		variableNames: maps.Clone(s.variableNames),
+		variableSizes: maps.Clone(s.variableSizes),
+		variableSpace: s.variableSpace,
+
+		initialValues: maps.Clone(s.initialValues),
+		readOnly:      maps.Clone(s.readOnly),
+
+		structs: maps.Clone(s.structs),
+		shapes:  maps.Clone(s.shapes),
+
+		imports:    maps.Clone(s.imports),
+		exports:    maps.Clone(s.exports),
+		namespaces: maps.Clone(s.namespaces),
+	}
+}
+
+func (s *Script) restore(snap *snapshot) {
+	s.commands = s.commands[:snap.commands]
+	s.declarations = s.declarations[:snap.declarations]
+	s.references = s.references[:snap.references]
+
+	s.commandNames = snap.commandNames
+
+	s.labels = snap.labels
+	s.defines = snap.defines
+	s.macros = snap.macros
+
+	s.variables = snap.variables
+	s.variableNames = snap.variableNames
+	s.variableSizes = snap.variableSizes
+	s.variableSpace = snap.variableSpace
+
+	s.initialValues = snap.initialValues
+	s.readOnly = snap.readOnly
+
+	s.structs = snap.structs
+	s.shapes = snap.shapes
+
+	s.imports = snap.imports
+	s.exports = snap.exports
+	s.namespaces = snap.namespaces
+
+	for label, addrNodes := range s.symbols {
+		if n, ok := snap.symbols[label]; ok {
+			s.symbols[label] = addrNodes[:n]
+		} else {
+			delete(s.symbols, label)
+		}
+	}
+}
+
+// resolveAddressNodes resolves the label references added since snap. Unlike augmentAddressNodes
+// it ignores older references to unknown labels, they were reported when they were added.
+func (s *Script) resolveAddressNodes(snap *snapshot) (errs ErrorList) {
+	for label, addrNodes := range s.symbols {
+		pc, ok := s.labels[label]
+
+		for i, addr := range addrNodes {
+			if ok {
+				addr.Address = pc
+			} else if i >= snap.symbols[label] {
+				errs = append(errs, &SyntaxError{addr.SourceInfo, &UnknownLabelError{label}})
+				break
+			}
+		}
+	}
+
+	errs.sort()
+
+	return
+}
+
+// Feed parses src as a continuation of script, which is the result of an earlier Parse with the
+// same parser. Defines, macros, vars and labels of earlier calls stay visible, so a script can be
+// built one line at a time. If src has errors, everything it declared is discarded.
+func (p *Parser) Feed(script *Script, src []byte, filename string) (err error) {
+	snap := script.snapshot()
+
+	p.src.Insert("", NewLexer(src, filename))
+	p.lastToken = nil
+
+	errs := p.parseNodes(script)
+
+	if len(errs) == 0 {
+		errs = script.resolveAddressNodes(snap)
+	}
+
+	if len(errs) > 0 {
+		p.conditionals = nil
+		p.namespaces = p.namespaces[:1]
+		script.restore(snap)
+	}
+
+	return errs.Err()
+}
+
+// FeedExpression parses src as a single expression in the context of script, e.g. to evaluate it
+// with Script.Eval. The script itself is not changed.
+func (p *Parser) FeedExpression(script *Script, src []byte, filename string) (expr ExpressionNode, err error) {
+	snap := script.snapshot()
+
+	defer script.restore(snap)
+
+	defer func() {
+		p.labelReferences = nil
+	}()
+
+	p.src.Insert("", NewLexer(src, filename))
+	p.lastToken = nil
+
+	defer func() {
+		if _, drainErr := p.consumeUntil(EOF); err == nil {
+			err = drainErr
+		}
+	}()
+
+	if expr, err = p.parseExpression(script); err != nil {
+		err = p.positioned(err)
+		return
+	}
+
+	var tok *Token
+
+	if tok, err = p.peek(); err != nil {
+		return
+	}
+
+	if tok.Type != NEWLINE && tok.Type != EOF {
+		err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{NEWLINE, EOF}, tok}}
+		return
+	}
+
+	if err = p.resolveLabelReferences(script).Err(); err != nil {
+		return
+	}
+
+	err = script.resolveAddressNodes(snap).Err()
+
+	return
+}
@@ -1,5 +1,7 @@
 package fx
 
+import "strings"
+
 func (p *Parser) parseMacro(script *Script) (err error) {
 	if _, err = p.advance(); err != nil {
 		return
@@ -17,7 +19,37 @@ func (p *Parser) parseMacro(script *Script) (err error) {
 		return
 	}
 
-	args := make([]string, 0)
+	var macroTokens []*Token
+
+	if macroTokens, err = p.consumeUntil(ENDMACRO); err != nil {
+		return
+	}
+
+	// the body is consumed first, so an error in the parameters skips the whole macro
+	var params []*macroParam
+	var variadic string
+
+	if params, variadic, err = parseMacroParams(argTokens); err != nil {
+		return
+	}
+
+	var name string
+
+	if name, err = p.declare(script, SymbolMacro, ident, ident.Value, script.isMacro); err != nil {
+		return
+	}
+
+	script.macros[name] = newMacro(ident.Value, params, variadic, macroTokens)
+
+	return
+}
+
+// maxMacroDepth limits nested macro invocations, which only grow without bound if a macro invokes
+// itself.
+const maxMacroDepth = 64
+
+func parseMacroParams(argTokens []*Token) (params []*macroParam, variadic string, err error) {
+	params = make([]*macroParam, 0)
 
 	var argName string
 	var ok bool
@@ -25,18 +57,48 @@ func (p *Parser) parseMacro(script *Script) (err error) {
 	for i := 0; i < len(argTokens); i++ {
 		argName, ok, i = macroArgToken(argTokens, i)
 
-		if ok {
-			args = append(args, argName)
+		if !ok {
+			continue
 		}
-	}
 
-	var macroTokens []*Token
+		if variadic != "" {
+			err = &SyntaxError{argTokens[i].SourceInfo, &UnexpectedTokenError{[]TokenType{NEWLINE}, argTokens[i]}}
+			return
+		}
 
-	if macroTokens, err = p.consumeUntil(ENDMACRO); err != nil {
-		return
-	}
+		if i+1 < len(argTokens) {
+			switch argTokens[i+1].Type {
+			case ELLIPSIS:
+				variadic = argName
+				i++
+
+				continue
+			case ASSIGN:
+				param := &macroParam{name: argName, hasDefault: true}
+
+				for i += 2; i < len(argTokens) && argTokens[i].Type != COMMA; i++ {
+					param.defaultValue = append(param.defaultValue, argTokens[i])
+				}
+
+				if len(param.defaultValue) == 0 {
+					err = &SyntaxError{argTokens[i-1].SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT, NUMBER, STRING}, argTokens[i-1]}}
+					return
+				}
+
+				params = append(params, param)
+
+				continue
+			}
+		}
+
+		// arguments are matched by position, so a default can only be left out at the end
+		if len(params) > 0 && params[len(params)-1].hasDefault {
+			err = &SyntaxError{argTokens[i-1].SourceInfo, &RequiredMacroParamError{argName}}
+			return
+		}
 
-	script.macros[ident.Value] = newMacro(ident.Value, args, macroTokens)
+		params = append(params, &macroParam{name: argName})
+	}
 
 	return
 }
@@ -56,51 +118,234 @@ func macroArgToken(argTokens []*Token, offset int) (argName string, ok bool, nex
 	return
 }
 
+type macroParam struct {
+	name         string
+	hasDefault   bool
+	defaultValue []*Token
+}
+
 type Macro struct {
-	name string
-	args map[string]int
-	body *TokenSlice
+	name     string
+	params   []*macroParam
+	args     map[string]int
+	variadic string
+	body     *TokenSlice
 }
 
-func newMacro(name string, argumentNames []string, body []*Token) *Macro {
+func newMacro(name string, params []*macroParam, variadic string, body []*Token) *Macro {
 	args := make(map[string]int)
 
-	for i, arg := range argumentNames {
-		args[arg] = i
+	for i, param := range params {
+		args[param.name] = i
 	}
 
 	return &Macro{
-		name: name,
-		args: args,
-		body: newTokenSlice(body),
+		name:     name,
+		params:   params,
+		args:     args,
+		variadic: variadic,
+		body:     newTokenSlice(body),
+	}
+}
+
+func (m *Macro) Name() string {
+	return m.name
+}
+
+// ArgCount returns how many arguments the macro accepts. max is -1 for variadic macros.
+func (m *Macro) ArgCount() (minArgs int, maxArgs int) {
+	for i, param := range m.params {
+		if !param.hasDefault {
+			minArgs = i + 1
+		}
+	}
+
+	maxArgs = len(m.params)
+
+	if m.variadic != "" {
+		maxArgs = -1
 	}
+
+	return
+}
+
+func (m *Macro) defaultParam(name string) (param *macroParam, ok bool) {
+	var idx int
+
+	if idx, ok = m.args[name]; !ok {
+		return
+	}
+
+	param = m.params[idx]
+	ok = param.hasDefault
+
+	return
+}
+
+func (m *Macro) checkArgCount(n int) error {
+	minArgs, maxArgs := m.ArgCount()
+
+	if n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+		return &MacroArgumentCountError{m.name, minArgs, maxArgs, n}
+	}
+
+	return nil
 }
 
-func (m *Macro) Body(args [][]*Token) (*TokenSlice, error) {
-	tokens := make([]*Token, 0, len(m.body.tokens))
+func (m *Macro) Body(callSite *SourceInfo, args [][]*Token) (*TokenSlice, error) {
+	bindings := make(map[string][]*Token, len(m.params))
 
+	for i, param := range m.params {
+		if i < len(args) {
+			bindings[param.name] = args[i]
+		}
+	}
+
+	var variadicArgs [][]*Token
+
+	if m.variadic != "" && len(args) > len(m.params) {
+		variadicArgs = args[len(m.params):]
+	}
+
+	expansion := &Expansion{
+		Macro:    m.name,
+		CallSite: callSite,
+	}
+
+	tokens, err := m.expand(expansion, m.body.tokens, bindings, variadicArgs, make([]*Token, 0, len(m.body.tokens)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newTokenSlice(tokens), nil
+}
+
+func (m *Macro) expand(expansion *Expansion, body []*Token, bindings map[string][]*Token, variadicArgs [][]*Token, tokens []*Token) ([]*Token, error) {
 	var argName string
 	var ok bool
 
-	for i := 0; i < len(m.body.tokens); i++ {
-		argName, ok, i = macroArgToken(m.body.tokens, i)
+	for i := 0; i < len(body); i++ {
+		if body[i].Type == PREPROCESSOR {
+			switch directiveName(body[i].Value) {
+			case "for":
+				end, err := m.expandFor(expansion, body, i, bindings, variadicArgs, &tokens)
 
-		if ok {
-			argIdx, ok := m.args[argName]
+				if err != nil {
+					return nil, err
+				}
 
-			if !ok {
-				return nil, &SyntaxError{m.body.tokens[i].SourceInfo, &UnknownMacroArgumentError{argName}}
+				i = end
+
+				continue
+			case "endfor":
+				return nil, &SyntaxError{body[i].SourceInfo, &UnbalancedMacroLoopError{}}
 			}
+		}
 
-			if len(args) <= argIdx {
-				return nil, &SyntaxError{m.body.tokens[i].SourceInfo, &MissingMacroArgumentError{argName}}
+		argName, ok, i = macroArgToken(body, i)
+
+		if !ok {
+			tokens = append(tokens, expansion.token(body[i]))
+			continue
+		}
+
+		if argName == m.variadic && m.variadic != "" {
+			for j, arg := range variadicArgs {
+				if j > 0 {
+					tokens = append(tokens, expansion.token(&Token{Type: COMMA, SourceInfo: body[i].SourceInfo}))
+				}
+
+				tokens = append(tokens, arg...)
 			}
 
-			tokens = append(tokens, args[argIdx]...)
-		} else {
-			tokens = append(tokens, m.body.tokens[i])
+			continue
 		}
+
+		if value, ok := bindings[argName]; ok {
+			tokens = append(tokens, value...)
+			continue
+		}
+
+		if param, ok := m.defaultParam(argName); ok {
+			for _, tok := range param.defaultValue {
+				tokens = append(tokens, expansion.token(tok))
+			}
+
+			continue
+		}
+
+		if _, ok := m.args[argName]; ok {
+			return nil, &SyntaxError{body[i].SourceInfo, &MissingMacroArgumentError{argName}}
+		}
+
+		return nil, &SyntaxError{body[i].SourceInfo, &UnknownMacroArgumentError{argName}}
 	}
 
-	return newTokenSlice(tokens), nil
+	return tokens, nil
+}
+
+// expandFor expands `@for $item in $variadic` ... `@endfor` once for every variadic argument and
+// returns the offset of the last token belonging to the loop.
+func (m *Macro) expandFor(expansion *Expansion, body []*Token, start int, bindings map[string][]*Token, variadicArgs [][]*Token, tokens *[]*Token) (end int, err error) {
+	directive := body[start]
+	fields := strings.Fields(directive.Value)
+
+	if len(fields) != 4 || fields[2] != "in" || !strings.HasPrefix(fields[1], "$") || fields[3] != "$"+m.variadic || m.variadic == "" {
+		err = &SyntaxError{directive.SourceInfo, &InvalidPreprocessorValueError{"for", directive.Value}}
+		return
+	}
+
+	loopVar := strings.TrimPrefix(fields[1], "$")
+
+	depth := 0
+	end = -1
+
+	for i := start + 1; i < len(body) && end < 0; i++ {
+		if body[i].Type != PREPROCESSOR {
+			continue
+		}
+
+		switch directiveName(body[i].Value) {
+		case "for":
+			depth++
+		case "endfor":
+			if depth == 0 {
+				end = i
+			}
+
+			depth--
+		}
+	}
+
+	if end < 0 {
+		err = &SyntaxError{directive.SourceInfo, &UnbalancedMacroLoopError{}}
+		return
+	}
+
+	loopBody := body[start+1 : end]
+
+	if len(loopBody) > 0 && loopBody[0].Type == NEWLINE {
+		loopBody = loopBody[1:]
+	}
+
+	if end+1 < len(body) && body[end+1].Type == NEWLINE {
+		end++
+	}
+
+	loopBindings := make(map[string][]*Token, len(bindings)+1)
+
+	for k, v := range bindings {
+		loopBindings[k] = v
+	}
+
+	for _, arg := range variadicArgs {
+		loopBindings[loopVar] = arg
+
+		if *tokens, err = m.expand(expansion, loopBody, loopBindings, variadicArgs, *tokens); err != nil {
+			return
+		}
+	}
+
+	return
 }
@@ -0,0 +1,150 @@
+package fx
+
+import (
+	"path"
+	"strings"
+)
+
+// moduleName returns the name of the module in filename, e.g. `ui` for `scripts/ui.fx`.
+func moduleName(filename string) string {
+	base := path.Base(filename)
+
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// parseNameList parses the comma separated names after a keyword, e.g. of `export init, hp`.
+func (p *Parser) parseNameList() (names []*Token, err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var tok *Token
+
+	for {
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		if tok.Type != IDENT {
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, tok}}
+			return
+		}
+
+		names = append(names, tok)
+
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		switch tok.Type {
+		case COMMA:
+		case NEWLINE, EOF:
+			return
+		default:
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{COMMA, NEWLINE}, tok}}
+			return
+		}
+	}
+}
+
+func (p *Parser) parseImport(script *Script) (err error) {
+	var names []*Token
+
+	if names, err = p.parseNameList(); err != nil {
+		return
+	}
+
+	for _, name := range names {
+		if _, ok := script.imports[name.Value]; !ok {
+			script.imports[name.Value] = name.SourceInfo
+		}
+	}
+
+	return
+}
+
+func (p *Parser) parseExport(script *Script) (err error) {
+	var names []*Token
+
+	if names, err = p.parseNameList(); err != nil {
+		return
+	}
+
+	for _, name := range names {
+		if _, ok := script.exports[p.qualified(name.Value)]; !ok {
+			script.exports[p.qualified(name.Value)] = name.SourceInfo
+		}
+	}
+
+	return
+}
+
+// parseImportedSymbol parses the rest of `module.name` after the module name, with an optional
+// index.
+func (p *Parser) parseImportedSymbol(script *Script, moduleTok *Token, name string) (expr ExpressionNode, err error) {
+	script.addReference(SymbolModule, moduleTok.Value, moduleTok.SourceInfo)
+
+	node := &ImportNode{
+		SourceInfo: moduleTok.SourceInfo,
+		Module:     moduleTok.Value,
+		Name:       name,
+	}
+
+	var next *Token
+
+	if next, err = p.peek(); err != nil {
+		return
+	}
+
+	if next.Type == LBRACKET {
+		if node.Index, _, err = p.parseVariableBracketExpression(script); err != nil {
+			return
+		}
+
+		if next, err = p.peek(); err != nil {
+			return
+		}
+
+		// the shape of a var of another module is not known before linking
+		if next.Type == LBRACKET {
+			err = &SyntaxError{next.SourceInfo, &ImportedShapeError{moduleTok.Value, name}}
+			return
+		}
+	}
+
+	expr = node
+
+	return
+}
+
+// checkExports reports exports that are neither a label nor a var of the script.
+func checkExports(script *Script) (errs ErrorList) {
+	for name, sourceInfo := range script.exports {
+		_, isLabel := script.labels[name]
+		_, isVariable := script.variables[name]
+
+		if !isLabel && !isVariable {
+			errs = append(errs, &SyntaxError{sourceInfo, &UnresolvedSymbolError{name}})
+		}
+	}
+
+	errs.sort()
+
+	return
+}
+
+// Module returns the name of the module, which is the base name of the file it was parsed from
+// without the extension.
+func (s *Script) Module() string {
+	return s.module
+}
+
+// Imports returns the imported modules with the position of their import.
+func (s *Script) Imports() map[string]*SourceInfo {
+	return s.imports
+}
+
+// Exports returns the exported labels and vars with the position of their export.
+func (s *Script) Exports() map[string]*SourceInfo {
+	return s.exports
+}
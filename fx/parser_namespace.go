@@ -0,0 +1,378 @@
+package fx
+
+import (
+	"slices"
+	"strings"
+)
+
+// namespaceBlock is a `namespace … endnamespace` block. The global namespace is the outermost
+// block and has no name.
+type namespaceBlock struct {
+	name   string
+	tok    *Token
+	usings []string
+}
+
+// scope is where a name is resolved: the namespace of the reference and the namespaces of `using`.
+type scope struct {
+	namespace string
+	usings    []string
+}
+
+// labelReference is a label reference that is resolved at the end of parsing, when all labels are
+// known.
+type labelReference struct {
+	*Reference
+	addr  *AddressNode
+	scope *scope
+}
+
+func qualify(namespace string, name string) string {
+	if namespace == "" {
+		return name
+	}
+
+	return namespace + "." + name
+}
+
+func parentNamespace(namespace string) string {
+	if i := strings.LastIndex(namespace, "."); i >= 0 {
+		return namespace[:i]
+	}
+
+	return ""
+}
+
+// resolve returns the qualified name of name. It is looked up in the namespace and its parents,
+// innermost first, and then in the namespaces of `using`, which must not declare it more than once.
+func (s *scope) resolve(name string, declared func(string) bool) (qualified string, ok bool, err error) {
+	for namespace := s.namespace; ; namespace = parentNamespace(namespace) {
+		if qualified = qualify(namespace, name); declared(qualified) {
+			return qualified, true, nil
+		}
+
+		if namespace == "" {
+			break
+		}
+	}
+
+	var found []string
+
+	for _, using := range s.usings {
+		if qualified = qualify(using, name); declared(qualified) && !slices.Contains(found, qualified) {
+			found = append(found, qualified)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return name, false, nil
+	case 1:
+		return found[0], true, nil
+	}
+
+	return name, false, &AmbiguousSymbolError{name, found}
+}
+
+func (p *Parser) namespace() *namespaceBlock {
+	return p.namespaces[len(p.namespaces)-1]
+}
+
+func (p *Parser) scope() *scope {
+	s := &scope{namespace: p.namespace().name}
+
+	for i := len(p.namespaces) - 1; i >= 0; i-- {
+		s.usings = append(s.usings, p.namespaces[i].usings...)
+	}
+
+	return s
+}
+
+// qualified returns the name of a symbol declared in the current namespace.
+func (p *Parser) qualified(name string) string {
+	return qualify(p.namespace().name, name)
+}
+
+// lookup resolves a name in the current scope, see scope.resolve.
+func (p *Parser) lookup(tok *Token, name string, declared func(string) bool) (qualified string, ok bool, err error) {
+	if qualified, ok, err = p.scope().resolve(name, declared); err != nil {
+		err = &SyntaxError{tok.SourceInfo, err}
+	}
+
+	return
+}
+
+// parseQualifiedName parses the rest of a name like `ui.menu.open` after its first part.
+func (p *Parser) parseQualifiedName(first *Token) (name string, err error) {
+	name = first.Value
+
+	var tok *Token
+
+	for {
+		if tok, err = p.peek(); err != nil || tok.Type != DOT {
+			return
+		}
+
+		if _, err = p.advance(); err != nil {
+			return
+		}
+
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		if tok.Type != IDENT {
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, tok}}
+			return
+		}
+
+		name += "." + tok.Value
+	}
+}
+
+// labelDeclarationAhead reports whether the next tokens are a label declaration like `init:` or
+// `ui.init:`, which declares the label in the namespace ui.
+func (p *Parser) labelDeclarationAhead() (ok bool, err error) {
+	var tok *Token
+
+	for n := 1; ; n += 2 {
+		if tok, err = p.peekAhead(n); err != nil || tok.Type != DOT {
+			return err == nil && tok.Type == COLON, err
+		}
+
+		if tok, err = p.peekAhead(n + 1); err != nil || tok.Type != IDENT {
+			return
+		}
+	}
+}
+
+func (p *Parser) expectEndOfLine() (err error) {
+	var tok *Token
+
+	if tok, err = p.advance(); err != nil {
+		return
+	}
+
+	if tok.Type != NEWLINE && tok.Type != EOF {
+		err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{NEWLINE}, tok}}
+	}
+
+	return
+}
+
+func (p *Parser) parseNamespace(script *Script) (err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var nameTok *Token
+
+	if nameTok, err = p.advance(); err != nil {
+		return
+	}
+
+	if nameTok.Type != IDENT {
+		err = &SyntaxError{nameTok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, nameTok}}
+		return
+	}
+
+	if err = p.expectEndOfLine(); err != nil {
+		return
+	}
+
+	name := p.qualified(nameTok.Value)
+
+	if _, ok := script.namespaces[name]; !ok {
+		script.namespaces[name] = nameTok.SourceInfo
+	}
+
+	p.namespaces = append(p.namespaces, &namespaceBlock{name: name, tok: nameTok})
+
+	return
+}
+
+func (p *Parser) parseEndNamespace() (err error) {
+	var tok *Token
+
+	if tok, err = p.advance(); err != nil {
+		return
+	}
+
+	if len(p.namespaces) == 1 {
+		err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{Token: tok}}
+		return
+	}
+
+	p.namespaces = p.namespaces[:len(p.namespaces)-1]
+
+	return p.expectEndOfLine()
+}
+
+// parseUsing parses `using name, …`. The namespaces are used until the end of the enclosing
+// namespace block and must be declared before.
+func (p *Parser) parseUsing(script *Script) (err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var tok *Token
+
+	for {
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		if tok.Type != IDENT {
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, tok}}
+			return
+		}
+
+		var name string
+
+		if name, err = p.parseQualifiedName(tok); err != nil {
+			return
+		}
+
+		if _, ok := script.namespaces[name]; !ok {
+			err = &SyntaxError{tok.SourceInfo, &UnknownNamespaceError{name}}
+			return
+		}
+
+		block := p.namespace()
+		block.usings = append(block.usings, name)
+
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		switch tok.Type {
+		case COMMA:
+		case NEWLINE, EOF:
+			return
+		default:
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{COMMA, NEWLINE}, tok}}
+			return
+		}
+	}
+}
+
+// declare records the declaration of a symbol in the current namespace and returns its qualified
+// name. A symbol of the same kind must not be declared twice. The name itself may be qualified,
+// e.g. `ui.init`, which also declares the namespace ui.
+func (p *Parser) declare(script *Script, kind SymbolKind, tok *Token, name string, declared func(string) bool) (qualified string, err error) {
+	qualified = p.qualified(name)
+
+	for namespace := parentNamespace(qualified); namespace != ""; namespace = parentNamespace(namespace) {
+		if _, ok := script.namespaces[namespace]; !ok {
+			script.namespaces[namespace] = tok.SourceInfo
+		}
+	}
+
+	if declared(qualified) {
+		if prev, ok := script.Declaration(kind, qualified); ok {
+			err = &SyntaxError{tok.SourceInfo, &DuplicateSymbolError{kind, qualified, prev.SourceInfo}}
+			return
+		}
+	}
+
+	if err = p.checkConflicts(script, kind, tok, qualified); err != nil {
+		return
+	}
+
+	script.addDeclaration(kind, qualified, tok.SourceInfo)
+
+	return
+}
+
+// checkConflicts reports a symbol with the name of a symbol of another kind, which hides one of
+// them. Identifiers and commands are global, so they conflict with symbols in every namespace. A def
+// or var called len or sizeof is hidden by the built-in in calls like `len(x)`. The conflict is
+// passed to the WarningFn of the parser, or returned as error without one.
+func (p *Parser) checkConflicts(script *Script, kind SymbolKind, tok *Token, qualified string) (err error) {
+	conflict := &SymbolConflictError{Kind: kind, Name: qualified}
+	base := qualified[strings.LastIndex(qualified, ".")+1:]
+
+	for _, other := range []SymbolKind{SymbolLabel, SymbolMacro, SymbolDefine, SymbolVariable, SymbolStruct} {
+		if other == kind {
+			continue
+		}
+
+		if decl, ok := script.Declaration(other, qualified); ok {
+			conflict.OtherKind, conflict.OtherName, conflict.Previous = other, qualified, decl.SourceInfo
+			break
+		}
+	}
+
+	if conflict.OtherName == "" {
+		if _, ok := p.identifiers[base]; ok {
+			conflict.OtherKind, conflict.OtherName = SymbolIdentifier, base
+		} else if _, ok := p.commandTypes[base]; ok {
+			conflict.OtherKind, conflict.OtherName = SymbolCommand, base
+		} else if (kind == SymbolDefine || kind == SymbolVariable) && (base == "len" || base == "sizeof") {
+			conflict.OtherKind, conflict.OtherName = SymbolBuiltin, base
+		} else {
+			return
+		}
+	}
+
+	err = &SyntaxError{tok.SourceInfo, conflict}
+
+	if p.warningFn != nil {
+		p.warningFn(err)
+		err = nil
+	}
+
+	return
+}
+
+// referenceLabel adds a reference to a label that is resolved by resolveLabelReferences.
+func (p *Parser) referenceLabel(script *Script, name string, sourceInfo *SourceInfo) *AddressNode {
+	addr := &AddressNode{
+		Address:    0,
+		SourceInfo: sourceInfo,
+	}
+
+	p.labelReferences = append(p.labelReferences, &labelReference{
+		Reference: script.addReference(SymbolLabel, name, sourceInfo),
+		addr:      addr,
+		scope:     p.scope(),
+	})
+
+	return addr
+}
+
+// resolveLabelReferences resolves the label references parsed so far in the scope they were
+// parsed in. Unknown labels keep their name and are reported by augmentAddressNodes.
+func (p *Parser) resolveLabelReferences(script *Script) (errs ErrorList) {
+	for _, ref := range p.labelReferences {
+		name, _, err := ref.scope.resolve(ref.Name, script.isLabel)
+
+		if err != nil {
+			errs = append(errs, &SyntaxError{ref.SourceInfo, err})
+			continue
+		}
+
+		ref.Name = name
+		script.addSymbol(name, ref.addr)
+	}
+
+	p.labelReferences = nil
+
+	return
+}
+
+// checkNamespaces reports namespace blocks that are not closed.
+func (p *Parser) checkNamespaces() (errs ErrorList) {
+	for _, block := range p.namespaces[1:] {
+		errs = append(errs, &SyntaxError{block.tok.SourceInfo, &UnclosedNamespaceError{block.name}})
+	}
+
+	p.namespaces = p.namespaces[:1]
+
+	return
+}
+
+// Namespaces returns the declared namespaces with the position of their first declaration.
+func (s *Script) Namespaces() map[string]*SourceInfo {
+	return s.namespaces
+}
@@ -5,8 +5,18 @@ import (
 	"strings"
 )
 
+// ExpressionNode is implemented by all expression nodes. Nodes outside of this package embed
+// *SourceInfo and implement ExprNode to mark them as expressions.
 type ExpressionNode interface {
-	exprNode()
+	ExprNode()
+	Source() *SourceInfo
+}
+
+// EvaluableNode is an expression node that evaluates itself. Script.Eval uses it for node kinds
+// that are not defined in this package.
+type EvaluableNode interface {
+	ExpressionNode
+	Eval(s *Script, getValue IdentifierValueRetriever) (v any, err error)
 }
 
 type CommandNode struct {
@@ -59,14 +69,35 @@ type ArrayAccessNode struct {
 	Index    ExpressionNode
 }
 
-func (n *FloatNode) exprNode()       {}
-func (n *IntegerNode) exprNode()     {}
-func (n *IdentifierNode) exprNode()  {}
-func (n *StringNode) exprNode()      {}
-func (n *AddressNode) exprNode()     {}
-func (n *BinaryOpNode) exprNode()    {}
-func (n *UnaryOpNode) exprNode()     {}
-func (n *ArrayAccessNode) exprNode() {}
+// IndexCheckNode is the index of a dimension or a field array in the access of a shaped var, e.g.
+// `y` in `grid[x][y]`. It evaluates to Index, which must be one of the Length elements of the
+// dimension or field called Variable.
+type IndexCheckNode struct {
+	*SourceInfo
+	Variable string
+	Index    ExpressionNode
+	Length   int
+}
+
+// ImportNode references a label or var exported by another module as `module.name`. Link replaces
+// it with an AddressNode, IdentifierNode or, with an index, an ArrayAccessNode.
+type ImportNode struct {
+	*SourceInfo
+	Module string
+	Name   string
+	Index  ExpressionNode
+}
+
+func (n *FloatNode) ExprNode()       {}
+func (n *IntegerNode) ExprNode()     {}
+func (n *IdentifierNode) ExprNode()  {}
+func (n *StringNode) ExprNode()      {}
+func (n *AddressNode) ExprNode()     {}
+func (n *BinaryOpNode) ExprNode()    {}
+func (n *UnaryOpNode) ExprNode()     {}
+func (n *ArrayAccessNode) ExprNode() {}
+func (n *IndexCheckNode) ExprNode()  {}
+func (n *ImportNode) ExprNode()      {}
 
 func (n *CommandNode) String() string {
 	prefix := n.SourceInfo.String()
@@ -117,3 +148,15 @@ func (n *UnaryOpNode) String() string {
 func (n *ArrayAccessNode) String() string {
 	return fmt.Sprintf("AT(%d, %s)", n.Variable, n.Index)
 }
+
+func (n *IndexCheckNode) String() string {
+	return fmt.Sprintf("CHECK(%s, %d)", n.Index, n.Length)
+}
+
+func (n *ImportNode) String() string {
+	if n.Index != nil {
+		return fmt.Sprintf("IMPORT(%s.%s, %s)", n.Module, n.Name, n.Index)
+	}
+
+	return fmt.Sprintf("IMPORT(%s.%s)", n.Module, n.Name)
+}
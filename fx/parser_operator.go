@@ -0,0 +1,110 @@
+package fx
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// PrecedenceTable maps binary operator tokens to their binding power. Operators with a higher
+// precedence bind tighter, operators on the same level are left-associative.
+type PrecedenceTable map[TokenType]int
+
+// DefaultPrecedence is the classic fx precedence, where the bitwise operators share a level with
+// addition and subtraction.
+var DefaultPrecedence = PrecedenceTable{
+	EQ:  10,
+	NEQ: 10,
+
+	LT:  20,
+	GT:  20,
+	LTE: 20,
+	GTE: 20,
+
+	SHL: 30,
+	SHR: 30,
+
+	ADD: 40,
+	SUB: 40,
+	AND: 40,
+	OR:  40,
+	INV: 40,
+
+	MUL:     50,
+	DIV:     50,
+	PERCENT: 50,
+}
+
+// CPrecedence orders the operators the same way C does.
+var CPrecedence = PrecedenceTable{
+	OR: 10,
+
+	INV: 20,
+
+	AND: 30,
+
+	EQ:  40,
+	NEQ: 40,
+
+	LT:  50,
+	GT:  50,
+	LTE: 50,
+	GTE: 50,
+
+	SHL: 60,
+	SHR: 60,
+
+	ADD: 70,
+	SUB: 70,
+
+	MUL:     80,
+	DIV:     80,
+	PERCENT: 80,
+}
+
+type BinaryOperatorFn func(left, right any) (any, error)
+
+// BinaryOperator is a host-provided binary operator. It is written as a word between its operands,
+// e.g. `set A, B max 10`.
+type BinaryOperator struct {
+	Precedence int
+	Fn         BinaryOperatorFn
+}
+
+type BinaryOperatorTable map[string]*BinaryOperator
+
+// checkPrecedence reports negative precedences of the built-in and custom operators, which
+// would never be parsed.
+func checkPrecedence(precedence PrecedenceTable, operators BinaryOperatorTable) (errs ErrorList) {
+	for _, typ := range slices.Sorted(maps.Keys(precedence)) {
+		if precedence[typ] < 0 {
+			errs = append(errs, &NegativePrecedenceError{strings.Trim(typ.Describe(), "'"), precedence[typ]})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(operators)) {
+		if operators[name].Precedence < 0 {
+			errs = append(errs, &NegativePrecedenceError{name, operators[name].Precedence})
+		}
+	}
+
+	return
+}
+
+// binaryPrecedence returns the precedence of a binary operator. A custom operator on the level of
+// a built-in one is left-associative with it.
+func (p *Parser) binaryPrecedence(tok *Token) (precedence int, ok bool) {
+	if tok.Type == IDENT {
+		var op *BinaryOperator
+
+		if op, ok = p.operators[tok.Value]; ok {
+			precedence = op.Precedence
+		}
+
+		return
+	}
+
+	precedence, ok = p.precedence[tok.Type]
+
+	return
+}
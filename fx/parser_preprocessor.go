@@ -2,11 +2,16 @@ package fx
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"strings"
 )
 
 type LookupFn func(value string) ([]byte, error)
 
+// WarningFn receives problems that don't prevent parsing, e.g. a def that hides an identifier.
+type WarningFn func(err error)
+
 func (p *Parser) prepInclude(fileName string) error {
 	return p.parseFile(fileName)
 }
@@ -38,7 +43,218 @@ func (p *Parser) prepDefLookup(value string) (err error) {
 	return
 }
 
-func (p *Parser) parsePreprocessorDirective() (err error) {
+type SymbolTable map[string]int
+
+// conditional is an @if block. It must be closed in the source it was opened in, depth is the depth
+// of that source in the token iterator.
+type conditional struct {
+	directive *Token
+	depth     int
+	taken     bool
+	inElse    bool
+}
+
+// closeConditionals reports and drops the conditionals of sources that ended, e.g. an @if without
+// @endif in an included file.
+func (p *Parser) closeConditionals() (errs ErrorList) {
+	depth := p.src.nextDepth()
+
+	for len(p.conditionals) > 0 {
+		c := p.conditionals[len(p.conditionals)-1]
+
+		if c.depth <= depth {
+			break
+		}
+
+		errs = append(errs, &SyntaxError{c.directive.SourceInfo, &UnbalancedConditionalError{directiveName(c.directive.Value)}})
+		p.conditionals = p.conditionals[:len(p.conditionals)-1]
+	}
+
+	return
+}
+
+func directiveName(value string) string {
+	name, _, _ := strings.Cut(value, " ")
+	return name
+}
+
+// parseDirectiveExpression parses the condition of an @if directive. Its errors are reported at the
+// directive.
+func (p *Parser) parseDirectiveExpression(script *Script, tok *Token, name string, value string) (expr ExpressionNode, err error) {
+	l := NewLexer([]byte(value), tok.Filename)
+
+	// keep positions relative to the directive
+	l.line = tok.Line
+	l.col = tok.Column + len(name) + 1
+
+	src, lastToken := p.src, p.lastToken
+
+	p.src = NewTokenIterator("", l, src.bufSize)
+	p.inDirective = true
+
+	defer func() {
+		p.src, p.lastToken = src, lastToken
+		p.inDirective = false
+
+		var syntaxErr *SyntaxError
+
+		if errors.As(err, &syntaxErr) {
+			err = &SyntaxError{tok.SourceInfo, syntaxErr.Err}
+		}
+	}()
+
+	var next *Token
+
+	if next, err = p.peek(); err != nil {
+		return
+	}
+
+	if expr, err = p.parseExpression(script); err != nil {
+		return
+	}
+
+	if expr == nil {
+		err = &SyntaxError{next.SourceInfo, &UnexpectedTokenError{[]TokenType{NUMBER, IDENT}, next}}
+		return
+	}
+
+	if next, err = p.peek(); err != nil {
+		return
+	}
+
+	if next.Type != EOF && next.Type != NEWLINE {
+		err = &SyntaxError{next.SourceInfo, &UnexpectedTokenError{[]TokenType{NEWLINE}, next}}
+	}
+
+	return
+}
+
+func (p *Parser) evalCondition(script *Script, tok *Token, name string, value string) (ok bool, err error) {
+	switch name {
+	case "ifdef", "ifndef":
+		fields := strings.Fields(value)
+
+		if len(fields) != 1 {
+			err = &SyntaxError{tok.SourceInfo, &InvalidPreprocessorValueError{name, value}}
+			return
+		}
+
+		symbol := fields[0]
+
+		var isDefine bool
+
+		if symbol, isDefine, err = p.lookup(tok, symbol, script.isDefine); err != nil {
+			return
+		}
+
+		_, isSymbol := p.symbols[symbol]
+
+		if isDefine {
+			script.addReference(SymbolDefine, symbol, tok.SourceInfo)
+		}
+
+		ok = isDefine || isSymbol
+
+		if name == "ifndef" {
+			ok = !ok
+		}
+
+		return
+	}
+
+	var expr ExpressionNode
+
+	if expr, err = p.parseDirectiveExpression(script, tok, name, value); err != nil {
+		return
+	}
+
+	var v any
+
+	if v, err = p.evalStatic(script, expr, tok); err != nil {
+		return
+	}
+
+	switch cond := v.(type) {
+	case int:
+		ok = cond != 0
+	case float64:
+		ok = cond != 0
+	default:
+		err = &ParseError{tok.SourceInfo, &UnexpectedTypeError{fmt.Sprintf("%T", v)}}
+	}
+
+	return
+}
+
+// currentConditional returns the innermost conditional, which must be opened in the same source
+// as tok.
+func (p *Parser) currentConditional(tok *Token, name string) (c *conditional, err error) {
+	if len(p.conditionals) == 0 || p.conditionals[len(p.conditionals)-1].depth != p.src.depth {
+		err = &SyntaxError{tok.SourceInfo, &UnbalancedConditionalError{name}}
+		return
+	}
+
+	c = p.conditionals[len(p.conditionals)-1]
+
+	return
+}
+
+// skipConditionalBlock drops tokens until the @else or @endif matching the innermost conditional.
+func (p *Parser) skipConditionalBlock() (err error) {
+	c := p.conditionals[len(p.conditionals)-1]
+	depth := 0
+
+	var tok *Token
+
+	for {
+		if p.src.nextDepth() < c.depth {
+			// the source of the conditional ended, reported by closeConditionals
+			return
+		}
+
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		if tok.Type == EOF {
+			err = &SyntaxError{c.directive.SourceInfo, &UnbalancedConditionalError{directiveName(c.directive.Value)}}
+			return
+		}
+
+		if tok.Type != PREPROCESSOR {
+			continue
+		}
+
+		switch name := directiveName(tok.Value); name {
+		case "if", "ifdef", "ifndef":
+			depth++
+		case "else":
+			if depth > 0 {
+				continue
+			}
+
+			if c.inElse {
+				err = &SyntaxError{tok.SourceInfo, &UnbalancedConditionalError{name}}
+				return
+			}
+
+			c.inElse = true
+
+			return
+		case "endif":
+			if depth > 0 {
+				depth--
+				continue
+			}
+
+			p.conditionals = p.conditionals[:len(p.conditionals)-1]
+
+			return
+		}
+	}
+}
+
+func (p *Parser) parsePreprocessorDirective(script *Script) (err error) {
 	tok, err := p.advance()
 
 	if err != nil {
@@ -70,6 +286,59 @@ func (p *Parser) parsePreprocessorDirective() (err error) {
 
 		err = p.prepDefLookup(segments[1])
 
+		return
+	case "if", "ifdef", "ifndef":
+		if len(segments) != 2 {
+			err = &SyntaxError{tok.SourceInfo, &InvalidPreprocessorValueError{segments[0], tok.Value}}
+			return
+		}
+
+		var ok bool
+
+		ok, err = p.evalCondition(script, tok, segments[0], segments[1])
+
+		// a condition with errors takes the first block, so its @else and @endif still match
+		p.conditionals = append(p.conditionals, &conditional{
+			directive: tok,
+			depth:     p.src.depth,
+			taken:     ok || err != nil,
+		})
+
+		if err != nil {
+			return
+		}
+
+		if !ok {
+			err = p.skipConditionalBlock()
+		}
+
+		return
+	case "else":
+		var c *conditional
+
+		if c, err = p.currentConditional(tok, segments[0]); err != nil {
+			return
+		}
+
+		if c.inElse {
+			err = &SyntaxError{tok.SourceInfo, &UnbalancedConditionalError{segments[0]}}
+			return
+		}
+
+		c.inElse = true
+
+		if c.taken {
+			err = p.skipConditionalBlock()
+		}
+
+		return
+	case "endif":
+		if _, err = p.currentConditional(tok, segments[0]); err != nil {
+			return
+		}
+
+		p.conditionals = p.conditionals[:len(p.conditionals)-1]
+
 		return
 	}
 
@@ -0,0 +1,91 @@
+package fx
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// maxSuggestions is the maximum number of similar names reported for an unknown identifier.
+const maxSuggestions = 3
+
+// isJumpTarget reports whether the argument at index of a command is a jump target, which is the
+// only place where strict mode resolves names to labels.
+func isJumpTarget(typ CommandType, index int) bool {
+	switch typ {
+	case CmdGoto, CmdCall:
+		return index == 0
+	case CmdJumpIf:
+		return index == 1
+	}
+
+	return false
+}
+
+// editDistance returns the Levenshtein distance of a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := range len(a) {
+		curr[0] = i + 1
+
+		for j := range len(b) {
+			cost := 1
+
+			if a[i] == b[j] {
+				cost = 0
+			}
+
+			curr[j+1] = min(prev[j+1]+1, curr[j]+1, prev[j]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// suggest returns the defs, vars and identifiers with a name similar to name, closest first. Names
+// in namespaces are compared by their last part, so `hp` suggests `player.hp`.
+func (p *Parser) suggest(script *Script, name string) (suggestions []string) {
+	maxDistance := max(1, len(name)/3)
+	distances := make(map[string]int)
+
+	candidates := slices.Concat(
+		slices.Collect(maps.Keys(script.defines)),
+		slices.Collect(maps.Keys(script.variables)),
+		slices.Collect(maps.Keys(p.identifiers)),
+	)
+
+	for _, candidate := range candidates {
+		base := candidate[strings.LastIndex(candidate, ".")+1:]
+		distance := min(editDistance(name, candidate), editDistance(name, base))
+
+		if distance > maxDistance {
+			continue
+		}
+
+		if prev, ok := distances[candidate]; !ok || distance < prev {
+			distances[candidate] = distance
+		}
+	}
+
+	suggestions = slices.SortedFunc(maps.Keys(distances), func(a string, b string) int {
+		if distances[a] != distances[b] {
+			return distances[a] - distances[b]
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+
+	return
+}
@@ -0,0 +1,181 @@
+package fx
+
+import "errors"
+
+// Struct is the layout of a struct declared with `struct Name … endstruct`. A var of the struct
+// takes Size consecutive addresses, its fields are at the address of the var plus their offset.
+type Struct struct {
+	Name   string
+	Fields []*StructField
+	Size   int
+}
+
+// StructField is a field of a struct with Length elements, which is 1 for scalar fields.
+type StructField struct {
+	Name   string
+	Offset int
+	Length int
+}
+
+// Field returns the field with the name.
+func (s *Struct) Field(name string) (field *StructField, ok bool) {
+	for _, field = range s.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+
+	return nil, false
+}
+
+// parseStruct parses `struct Name field, field[4] … endstruct`. Fields are separated by commas or
+// newlines. A duplicate field, an invalid field length and a struct without fields are reported
+// after the whole struct is parsed.
+func (p *Parser) parseStruct(script *Script) (err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var nameTok *Token
+
+	if nameTok, err = p.advance(); err != nil {
+		return
+	}
+
+	if nameTok.Type != IDENT {
+		err = &SyntaxError{nameTok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, nameTok}}
+		return
+	}
+
+	var name string
+
+	if name, err = p.declare(script, SymbolStruct, nameTok, nameTok.Value, script.isStruct); err != nil {
+		return
+	}
+
+	layout := &Struct{Name: name}
+	script.structs[name] = layout
+
+	var tok *Token
+	var fieldErr error
+
+	for {
+		if tok, err = p.advance(); err != nil {
+			return
+		}
+
+		switch tok.Type {
+		case COMMA, NEWLINE:
+			continue
+		case ENDSTRUCT:
+			if len(layout.Fields) == 0 && fieldErr == nil {
+				fieldErr = &SyntaxError{nameTok.SourceInfo, &EmptyStructError{name}}
+			}
+
+			if err = p.expectEndOfLine(); err == nil {
+				err = fieldErr
+			}
+
+			return
+		case EOF:
+			err = &SyntaxError{nameTok.SourceInfo, &UnclosedStructError{name}}
+			return
+		case IDENT:
+		default:
+			err = &SyntaxError{tok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT, ENDSTRUCT}, tok}}
+			return
+		}
+
+		if _, ok := layout.Field(tok.Value); ok && fieldErr == nil {
+			fieldErr = &SyntaxError{tok.SourceInfo, &DuplicateFieldError{name, tok.Value}}
+		}
+
+		field := &StructField{Name: tok.Value, Offset: layout.Size, Length: 1}
+
+		var next *Token
+
+		if next, err = p.peek(); err != nil {
+			return
+		}
+
+		if next.Type == LBRACKET {
+			var length int
+			var parseErr *ParseError
+
+			// a length that can't be used is reported after the whole struct is parsed, only
+			// syntax errors stop it
+			if length, err = p.parseLength(script, name+"."+tok.Value); err == nil {
+				field.Length = length
+			} else if errors.As(err, &parseErr) {
+				if fieldErr == nil {
+					fieldErr = err
+				}
+
+				err = nil
+			} else {
+				return
+			}
+		}
+
+		layout.Fields = append(layout.Fields, field)
+		layout.Size += field.Length
+	}
+}
+
+// parseStructType parses the struct of `var e: Name` after the name.
+func (p *Parser) parseStructType(script *Script) (layout *Struct, err error) {
+	if _, err = p.advance(); err != nil {
+		return
+	}
+
+	var typeTok *Token
+
+	if typeTok, err = p.advance(); err != nil {
+		return
+	}
+
+	if typeTok.Type != IDENT {
+		err = &SyntaxError{typeTok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, typeTok}}
+		return
+	}
+
+	var typeName string
+
+	if typeName, err = p.parseQualifiedName(typeTok); err != nil {
+		return
+	}
+
+	var ok bool
+
+	if typeName, ok, err = p.lookup(typeTok, typeName, script.isStruct); err != nil {
+		return
+	}
+
+	if !ok {
+		err = &SyntaxError{typeTok.SourceInfo, &UnknownStructError{typeName}}
+		return
+	}
+
+	script.addReference(SymbolStruct, typeName, typeTok.SourceInfo)
+
+	layout = script.structs[typeName]
+
+	return
+}
+
+// Structs returns the declared structs.
+func (s *Script) Structs() map[string]*Struct {
+	return s.structs
+}
+
+// VariableShape returns the dimensions and the struct of a var, ok is false for vars declared
+// without them.
+func (s *Script) VariableShape(name string) (dimensions []int, layout *Struct, ok bool) {
+	shape, ok := s.shapes[name]
+
+	if !ok {
+		return
+	}
+
+	return shape.dimensions, shape.layout, true
+}
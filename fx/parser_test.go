@@ -1,7 +1,10 @@
 package fx
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/require"
 )
@@ -14,16 +17,20 @@ const (
 	cmdMyCmd = UserCommandOffset + iota
 )
 
-func parse(script string) (commands []*CommandNode, defines map[string]ExpressionNode, labels map[string]int, macros map[string]*Macro, err error) {
-	l := NewLexer([]byte(script), "")
-	p := NewParser(l, &ParserConfig{
+func testParserConfig() *ParserConfig {
+	return &ParserConfig{
 		CommandTypes: CommandTypeTable{
 			"myCmd": cmdMyCmd,
 		},
 		Identifiers: IdentifierTable{
 			"A": identA,
 		},
-	})
+	}
+}
+
+func parse(script string) (commands []*CommandNode, defines map[string]ExpressionNode, labels map[string]int, macros map[string]*Macro, err error) {
+	l := NewLexer([]byte(script), "")
+	p := NewParser(l, testParserConfig())
 
 	s, err := p.Parse()
 
@@ -38,6 +45,11 @@ func sourceInfo(line, col int) *SourceInfo {
 	return &SourceInfo{Line: line, Column: col, Filename: ""}
 }
 
+func expanded(s *SourceInfo, macro string, callSite *SourceInfo) *SourceInfo {
+	s.Expansion = &Expansion{Macro: macro, CallSite: callSite}
+	return s
+}
+
 func TestParser_Ident(t *testing.T) {
 	script := "myCmd A\n"
 
@@ -600,27 +612,27 @@ func TestParser_Macros(t *testing.T) {
 
 	expectedCommands := []*CommandNode{
 		{
-			SourceInfo: sourceInfo(3, 4),
+			SourceInfo: expanded(sourceInfo(3, 4), "m1", sourceInfo(11, 3)),
 			Type:       cmdMyCmd,
 			Args: []ExpressionNode{
 				&IntegerNode{
-					SourceInfo: sourceInfo(3, 10),
+					SourceInfo: expanded(sourceInfo(3, 10), "m1", sourceInfo(11, 3)),
 					Value:      1,
 				},
 			},
 		},
 		{
-			SourceInfo: sourceInfo(3, 4),
+			SourceInfo: expanded(sourceInfo(3, 4), "m1", expanded(sourceInfo(7, 4), "m2", sourceInfo(12, 3))),
 			Type:       cmdMyCmd,
 			Args: []ExpressionNode{
 				&IntegerNode{
-					SourceInfo: sourceInfo(3, 10),
+					SourceInfo: expanded(sourceInfo(3, 10), "m1", expanded(sourceInfo(7, 4), "m2", sourceInfo(12, 3))),
 					Value:      1,
 				},
 			},
 		},
 		{
-			SourceInfo: sourceInfo(8, 4),
+			SourceInfo: expanded(sourceInfo(8, 4), "m2", sourceInfo(12, 3)),
 			Type:       cmdMyCmd,
 			Args: []ExpressionNode{
 				&IntegerNode{
@@ -667,41 +679,41 @@ func TestParser_MacrosWithLocalLabels(t *testing.T) {
 
 	expectedCommands := []*CommandNode{
 		{
-			SourceInfo: sourceInfo(4, 4),
+			SourceInfo: expanded(sourceInfo(4, 4), "mLoop", sourceInfo(8, 3)),
 			Type:       cmdMyCmd,
 			Args: []ExpressionNode{
 				&IdentifierNode{
-					SourceInfo: sourceInfo(4, 10),
+					SourceInfo: expanded(sourceInfo(4, 10), "mLoop", sourceInfo(8, 3)),
 					Identifier: identA,
 				},
 			},
 		},
 		{
-			SourceInfo: sourceInfo(5, 4),
+			SourceInfo: expanded(sourceInfo(5, 4), "mLoop", sourceInfo(8, 3)),
 			Type:       cmdMyCmd,
 			Args: []ExpressionNode{
 				&AddressNode{
-					SourceInfo: sourceInfo(5, 11),
+					SourceInfo: expanded(sourceInfo(5, 11), "mLoop", sourceInfo(8, 3)),
 					Address:    0,
 				},
 			},
 		},
 		{
-			SourceInfo: sourceInfo(4, 4),
+			SourceInfo: expanded(sourceInfo(4, 4), "mLoop", sourceInfo(9, 3)),
 			Type:       cmdMyCmd,
 			Args: []ExpressionNode{
 				&IdentifierNode{
-					SourceInfo: sourceInfo(4, 10),
+					SourceInfo: expanded(sourceInfo(4, 10), "mLoop", sourceInfo(9, 3)),
 					Identifier: identA,
 				},
 			},
 		},
 		{
-			SourceInfo: sourceInfo(5, 4),
+			SourceInfo: expanded(sourceInfo(5, 4), "mLoop", sourceInfo(9, 3)),
 			Type:       cmdMyCmd,
 			Args: []ExpressionNode{
 				&AddressNode{
-					SourceInfo: sourceInfo(5, 11),
+					SourceInfo: expanded(sourceInfo(5, 11), "mLoop", sourceInfo(9, 3)),
 					Address:    2,
 				},
 			},
@@ -884,3 +896,732 @@ func TestParser_Strings(t *testing.T) {
 	require.Empty(t, labels)
 	require.Empty(t, macros)
 }
+
+func evalFirstArg(t *testing.T, script string, cfg *ParserConfig) any {
+	s, err := NewParser(NewLexer([]byte(script), ""), cfg).Parse()
+
+	require.NoError(t, err)
+	require.NotEmpty(t, s.Commands())
+
+	v, err := s.Eval(s.Commands()[0].Args[0], func(Identifier) any { return 0 })
+
+	require.NoError(t, err)
+
+	return v
+}
+
+func TestParser_CPrecedence(t *testing.T) {
+	cfg := testParserConfig()
+
+	require.Equal(t, 0, evalFirstArg(t, "myCmd 1 | 2 == 2\n", cfg))
+	require.Equal(t, 6, evalFirstArg(t, "myCmd 2 + 4 & 7\n", cfg))
+
+	cfg.Precedence = CPrecedence
+
+	require.Equal(t, 1, evalFirstArg(t, "myCmd 1 | 2 == 2\n", cfg))
+	require.Equal(t, 6, evalFirstArg(t, "myCmd 2 + 4 & 7\n", cfg))
+	require.Equal(t, 1, evalFirstArg(t, "myCmd 3 ^ 2 & 2\n", cfg))
+	require.Equal(t, 16, evalFirstArg(t, "myCmd 1 << 2 + 2\n", cfg))
+}
+
+func TestParser_CustomOperator(t *testing.T) {
+	cfg := testParserConfig()
+
+	cfg.Operators = BinaryOperatorTable{
+		"max": {
+			Precedence: 45,
+			Fn: func(left, right any) (any, error) {
+				return max(left.(int), right.(int)), nil
+			},
+		},
+	}
+
+	require.Equal(t, 9, evalFirstArg(t, "myCmd 1 + 2 max 4 * 2\n", cfg))
+	require.Equal(t, 14, evalFirstArg(t, "myCmd (1 max 5) + 9\n", cfg))
+}
+
+func TestParser_CustomOperatorSharedPrecedence(t *testing.T) {
+	cfg := testParserConfig()
+
+	cfg.Operators = BinaryOperatorTable{
+		"min": {
+			Precedence: 40,
+			Fn: func(left, right any) (any, error) {
+				return min(left.(int), right.(int)), nil
+			},
+		},
+	}
+
+	require.Equal(t, 2, evalFirstArg(t, "myCmd 1 + 5 min 2\n", cfg))
+	require.Equal(t, 4, evalFirstArg(t, "myCmd 1 min 2 + 3\n", cfg))
+
+	cfg.Operators["min"].Precedence = -1
+	cfg.Precedence = PrecedenceTable{ADD: -2, MUL: 10}
+
+	_, err := LoadScript([]byte("myCmd 1 + 2\n"), "test.fx", cfg)
+
+	require.EqualError(t, err, `precedence -2 of operator '+' is negative
+precedence -1 of operator 'min' is negative`)
+
+	_, err = NewBuilder(cfg).Build()
+
+	require.EqualError(t, err, `precedence -2 of operator '+' is negative
+precedence -1 of operator 'min' is negative`)
+}
+
+func TestParser_UnbalancedConditionals(t *testing.T) {
+	tests := []struct {
+		script string
+		line   int
+	}{
+		{"@if 1\nmyCmd 1\n", 1},
+		{"myCmd 1\n@ifdef X\nmyCmd 2\n", 2},
+		{"@if 1\n@else\n@else\n@endif\n", 3},
+		{"myCmd 1\n@endif\n", 2},
+		{"@else\n", 1},
+	}
+
+	for _, test := range tests {
+		_, _, _, _, err := parse(test.script)
+
+		var syntaxErr *SyntaxError
+
+		require.ErrorAs(t, err, &syntaxErr, test.script)
+		require.IsType(t, &UnbalancedConditionalError{}, syntaxErr.Err, test.script)
+		require.Equal(t, test.line, syntaxErr.Line, test.script)
+	}
+}
+
+func TestParser_ConditionErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		err    string
+	}{
+		{"myCmd 1\n@if DEBGU\nmyCmd 2\n@endif\n", "syntax error at test.fx:2:1: unresolved symbol 'DEBGU'"},
+		{"@if 1 +\nmyCmd 1\n@else\nmyCmd 2\n@endif\n", "syntax error at test.fx:1:1: unexpected end of file, expected one of end of line, ']', '+', '-', '*', '!', '^', '&', '(', number, string, identifier"},
+		{"@if 1 2\nmyCmd 1\n@endif\n", "syntax error at test.fx:1:1: unexpected number '2', expected end of line"},
+		{"@ifdef X junk\nmyCmd 1\n@endif\n", "syntax error at test.fx:1:1: invalid preprocessor value for directive ifdef: X junk"},
+	}
+
+	for _, test := range tests {
+		_, err := LoadScript([]byte(test.script), "test.fx", testParserConfig())
+
+		require.EqualError(t, err, test.err, test.script)
+	}
+}
+
+func TestParser_IncludeConditionals(t *testing.T) {
+	tests := []struct {
+		main string
+		lib  string
+		err  string
+	}{
+		{"@if 1\n@include lib.fx\nmyCmd 1\n", "@endif\n", `syntax error at lib.fx:1:1: unbalanced conditional directive: '@endif'
+syntax error at main.fx:1:1: unbalanced conditional directive: '@if'`},
+		{"@include lib.fx\nmyCmd 1\n@endif\n", "@if 1\nmyCmd 2\n", `syntax error at lib.fx:1:1: unbalanced conditional directive: '@if'
+syntax error at main.fx:3:1: unbalanced conditional directive: '@endif'`},
+		{"@include lib.fx\nmyCmd 1\n", "@if 0\nmyCmd 2\n", "syntax error at lib.fx:1:1: unbalanced conditional directive: '@if'"},
+		{"@if 1\n@include lib.fx\n@endif\nmyCmd 1\n", "@ifdef X\nmyCmd 2\n@endif\n", ""},
+	}
+
+	for _, test := range tests {
+		cfg := testParserConfig()
+		cfg.FS = NewParserFS(fstest.MapFS{
+			"main.fx": {Data: []byte(test.main)},
+			"lib.fx":  {Data: []byte(test.lib)},
+		})
+
+		s, err := LoadFile("main.fx", cfg)
+
+		if test.err == "" {
+			require.NoError(t, err)
+			require.Len(t, s.Commands(), 1)
+			continue
+		}
+
+		require.EqualError(t, err, test.err, test.main)
+	}
+
+	cfg := testParserConfig()
+	cfg.FS = NewParserFS(fstest.MapFS{
+		"main.fx": {Data: []byte("@include lib.fx\nmyCmd 1\n")},
+		"lib.fx":  {Data: []byte("@if 0\nmyCmd 2\n")},
+	})
+
+	s, _ := NewParser(NewLexer([]byte("@include lib.fx\nmyCmd 1\n"), "main.fx"), cfg).Parse()
+
+	require.Len(t, s.Commands(), 1, "the command after the include is not skipped")
+}
+
+func TestParser_MacroRequiredParamAfterDefault(t *testing.T) {
+	_, err := LoadScript([]byte("macro m $a = 1, $b\n  myCmd $a, $b\nendmacro\n"), "test.fx", testParserConfig())
+
+	require.EqualError(t, err, "syntax error at test.fx:1:17: macro parameter '$b' without default follows a parameter with default")
+}
+
+func TestParser_MacroDepth(t *testing.T) {
+	_, err := LoadScript([]byte("macro m\n  m\nendmacro\nm\n"), "test.fx", testParserConfig())
+
+	var syntaxErr *SyntaxError
+
+	require.ErrorAs(t, err, &syntaxErr)
+	require.Equal(t, &MacroDepthError{"m", maxMacroDepth}, syntaxErr.Err)
+}
+
+func TestParser_MacroArgumentCount(t *testing.T) {
+	macros := `
+		macro none
+			myCmd 0
+		endmacro
+
+		macro two $a, $b
+			myCmd $a, $b
+		endmacro
+
+		macro defaults $a, $b = 2, $c = 3
+			myCmd $a, $b, $c
+		endmacro
+
+		macro variadic $a, $rest...
+			myCmd $a, $rest
+		endmacro
+	`
+
+	tests := []struct {
+		call string
+		ok   bool
+	}{
+		{"none", true},
+		{"none 1", false},
+		{"two 1, 2", true},
+		{"two 1", false},
+		{"two 1, 2, 3", false},
+		{"defaults 1", true},
+		{"defaults 1, 2, 3", true},
+		{"defaults", false},
+		{"defaults 1, 2, 3, 4", false},
+		{"variadic 1", true},
+		{"variadic 1, 2, 3, 4", true},
+		{"variadic", false},
+	}
+
+	for _, test := range tests {
+		commands, _, _, _, err := parse(macros + "\n" + test.call + "\n")
+
+		if test.ok {
+			require.NoError(t, err, test.call)
+			require.Len(t, commands, 1, test.call)
+			continue
+		}
+
+		var syntaxErr *SyntaxError
+
+		require.ErrorAs(t, err, &syntaxErr, test.call)
+		require.IsType(t, &MacroArgumentCountError{}, syntaxErr.Err, test.call)
+		require.Equal(t, 18, syntaxErr.Line, test.call)
+		require.Equal(t, 1, syntaxErr.Column, test.call)
+	}
+}
+
+func TestParser_MacroExpansionTrace(t *testing.T) {
+	script := `
+		macro inner
+			unknownCmd
+		endmacro
+
+		macro outer
+			inner
+		endmacro
+
+		outer
+	`
+
+	_, _, _, _, err := parse(script)
+
+	var syntaxErr *SyntaxError
+
+	require.ErrorAs(t, err, &syntaxErr)
+	require.Equal(t, 3, syntaxErr.Line)
+
+	expansions := syntaxErr.Expansions()
+
+	require.Len(t, expansions, 2)
+	require.Equal(t, "inner", expansions[0].Macro)
+	require.Equal(t, "outer", expansions[1].Macro)
+	require.Equal(t, sourceInfo(10, 3), syntaxErr.Origin())
+
+	require.EqualError(t, err, "syntax error at <script>:3:4 (in macro 'inner' expanded at <script>:7:4, in macro 'outer' expanded at <script>:10:3): unknown command: 'unknownCmd'")
+}
+
+func TestParser_ErrorRecovery(t *testing.T) {
+	script := `
+		myCmd 1
+		unknownCmd 2
+		myCmd (3
+		)
+		myCmd 4
+		myCmd missing
+		myCmd 5
+	`
+
+	s, err := NewParser(NewLexer([]byte(script), ""), testParserConfig()).Parse()
+
+	var errs ErrorList
+
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 4)
+
+	lines := make([]int, len(errs))
+
+	for i, e := range errs {
+		var sourceErr SourceError
+
+		require.ErrorAs(t, e, &sourceErr)
+		require.NotNil(t, sourceErr.Source())
+
+		lines[i] = sourceErr.Source().Line
+	}
+
+	require.Equal(t, []int{3, 4, 5, 7}, lines)
+
+	var unknownCmd *UnknownCommandError
+
+	require.ErrorAs(t, err, &unknownCmd)
+	require.Equal(t, "unknownCmd", unknownCmd.Command)
+
+	require.NotNil(t, s)
+	require.Len(t, s.Commands(), 4)
+}
+
+func TestParser_Namespaces(t *testing.T) {
+	script := `
+		var hp
+		def MAX 1
+
+		namespace ui
+			var hp
+			def MAX 2
+
+			macro show $v
+				myCmd $v
+			endmacro
+
+			init:
+				myCmd hp, MAX
+			namespace menu
+				open:
+					myCmd hp, init
+			endnamespace
+		endnamespace
+
+		ui.close:
+		main:
+			myCmd hp, ui.hp, MAX, ui.MAX, ui.menu.open
+			ui.show 3
+
+		using ui
+			myCmd init, MAX
+	`
+
+	s, err := LoadScript([]byte(script), "", testParserConfig())
+
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]int{
+		"ui.init":      0,
+		"ui.menu.open": 1,
+		"ui.close":     2,
+		"main":         2,
+	}, s.Labels())
+
+	require.Equal(t, map[string]int{
+		"hp":    VariableOffset,
+		"ui.hp": VariableOffset + 1,
+	}, s.Variables())
+
+	require.Contains(t, s.Macros(), "ui.show")
+	require.Contains(t, s.Namespaces(), "ui.menu")
+
+	require.Equal(t, []ExpressionNode{
+		&IdentifierNode{sourceInfo(14, 11), VariableOffset + 1},
+		&IntegerNode{sourceInfo(7, 12), 2},
+	}, s.Commands()[0].Args)
+
+	require.Equal(t, []ExpressionNode{
+		&IdentifierNode{sourceInfo(17, 12), VariableOffset + 1},
+		&AddressNode{sourceInfo(17, 16), 0},
+	}, s.Commands()[1].Args)
+
+	require.Equal(t, []ExpressionNode{
+		&IdentifierNode{sourceInfo(23, 10), VariableOffset},
+		&IdentifierNode{sourceInfo(23, 14), VariableOffset + 1},
+		&IntegerNode{sourceInfo(3, 11), 1},
+		&IntegerNode{sourceInfo(7, 12), 2},
+		&AddressNode{sourceInfo(23, 34), 1},
+	}, s.Commands()[2].Args)
+
+	require.Equal(t, []ExpressionNode{
+		&IntegerNode{sourceInfo(24, 12), 3},
+	}, s.Commands()[3].Args)
+
+	// global names come before the namespaces of using
+	require.Equal(t, []ExpressionNode{
+		&AddressNode{sourceInfo(27, 10), 0},
+		&IntegerNode{sourceInfo(3, 11), 1},
+	}, s.Commands()[4].Args)
+}
+
+func TestParser_NamespaceErrors(t *testing.T) {
+	script := `namespace a
+  x:
+  var v
+endnamespace
+namespace b
+  x:
+  var v
+  var v
+endnamespace
+using a, b
+  myCmd x, v
+using c
+endnamespace
+namespace open
+`
+
+	_, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.EqualError(t, err, `syntax error at test.fx:8:7: duplicate var 'b.v', previously declared at test.fx:7:7
+syntax error at test.fx:11:9: ambiguous symbol 'x', could be 'a.x' or 'b.x'
+syntax error at test.fx:11:12: ambiguous symbol 'v', could be 'a.v' or 'b.v'
+syntax error at test.fx:12:7: unknown namespace: 'c'
+syntax error at test.fx:13:1: unexpected 'endnamespace'
+syntax error at test.fx:14:11: namespace 'open' is not closed`)
+}
+
+func TestParser_SymbolConflicts(t *testing.T) {
+	script := `def A 1
+x:
+var x
+macro myCmd
+endmacro
+namespace ui
+  def x 2
+endnamespace
+`
+
+	_, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.EqualError(t, err, `syntax error at test.fx:1:5: def 'A' conflicts with identifier 'A'
+syntax error at test.fx:3:5: var 'x' conflicts with label 'x' declared at test.fx:2:1
+syntax error at test.fx:4:7: macro 'myCmd' conflicts with command 'myCmd'`)
+
+	var warnings ErrorList
+
+	cfg := testParserConfig()
+	cfg.WarningFn = func(err error) {
+		warnings = append(warnings, err)
+	}
+
+	_, err = LoadScript([]byte(script), "test.fx", cfg)
+
+	require.NoError(t, err)
+	require.EqualError(t, warnings, `syntax error at test.fx:1:5: def 'A' conflicts with identifier 'A'
+syntax error at test.fx:3:5: var 'x' conflicts with label 'x' declared at test.fx:2:1
+syntax error at test.fx:4:7: macro 'myCmd' conflicts with command 'myCmd'`)
+}
+
+func TestParser_Strict(t *testing.T) {
+	script := `var health
+namespace player
+  var hp
+endnamespace
+loop:
+  jumpIf health, loop
+  call loop
+  myCmd helth
+  myCmd hp
+  myCmd loop
+  goto lop
+`
+
+	cfg := testParserConfig()
+	cfg.CommandTypes["call"] = CmdCall
+	cfg.CommandTypes["goto"] = CmdGoto
+	cfg.CommandTypes["jumpIf"] = CmdJumpIf
+	cfg.Strict = true
+
+	_, err := LoadScript([]byte(script), "test.fx", cfg)
+
+	require.EqualError(t, err, `syntax error at test.fx:8:9: unknown identifier: 'helth', did you mean 'health'?
+syntax error at test.fx:9:9: unknown identifier: 'hp', did you mean 'player.hp'?
+syntax error at test.fx:10:9: unknown identifier: 'loop'
+syntax error at test.fx:11:8: unknown label: 'lop'`)
+
+	cfg.Strict = false
+
+	_, err = LoadScript([]byte(script), "test.fx", cfg)
+
+	require.EqualError(t, err, `syntax error at test.fx:8:9: unknown label: 'helth'
+syntax error at test.fx:9:9: unknown label: 'hp'
+syntax error at test.fx:11:8: unknown label: 'lop'`)
+}
+
+func TestParser_Structs(t *testing.T) {
+	script := `struct Enemy hp, pos[2]
+  flags
+endstruct
+var e: Enemy
+var es: Enemy[4]
+myCmd e.pos[1]
+myCmd es[A].flags
+myCmd sizeof(Enemy)
+`
+
+	s, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.NoError(t, err)
+	require.Equal(t, map[string]*Struct{
+		"Enemy": {
+			Name: "Enemy",
+			Fields: []*StructField{
+				{Name: "hp", Offset: 0, Length: 1},
+				{Name: "pos", Offset: 1, Length: 2},
+				{Name: "flags", Offset: 3, Length: 1},
+			},
+			Size: 4,
+		},
+	}, s.Structs())
+
+	e := Identifier(s.Variables()["e"])
+	es := Identifier(s.Variables()["es"])
+
+	require.Equal(t, e+4, es)
+	require.Equal(t, 16, s.VariableSize("es"))
+	require.Equal(t, 20, s.VariableSpace())
+
+	require.Equal(t, "[AT(16777216, INT(2))]", fmt.Sprint(s.Commands()[0].Args))
+	require.Equal(t, "[AT(16777220, BINARY(BINARY(CHECK(IDENT(0), 4), MUL(*), INT(4)), ADD(+), INT(3)))]", fmt.Sprint(s.Commands()[1].Args))
+	require.Equal(t, "[INT(4)]", fmt.Sprint(s.Commands()[2].Args))
+}
+
+func TestParser_StructErrors(t *testing.T) {
+	script := `struct Point x, y, x
+endstruct
+struct Vec x, y
+endstruct
+var p: Pointt
+var v: Vec
+myCmd v.z
+myCmd sizeof(Vector)
+struct Bad a[0], b
+endstruct
+struct Empty
+endstruct
+struct Open a
+`
+
+	_, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.EqualError(t, err, `syntax error at test.fx:1:20: duplicate field 'x' in struct 'Point'
+syntax error at test.fx:5:8: unknown struct: 'Pointt'
+syntax error at test.fx:7:7: struct 'Vec' has no field 'z'
+syntax error at test.fx:8:14: unresolved symbol 'Vector'
+parse error at test.fx:9:13: length 0 of 'Bad.a' is not positive
+syntax error at test.fx:11:8: struct 'Empty' has no fields
+syntax error at test.fx:13:8: struct 'Open' is not closed`)
+}
+
+func TestParser_MultiDimensionalArrays(t *testing.T) {
+	script := `struct Cell a, b
+endstruct
+var grid[3][4]
+var cells: Cell[2][5]
+myCmd grid[A][1]
+myCmd grid[2]
+myCmd cells[1][A].b
+myCmd len(grid), len(grid[0]), sizeof(grid), sizeof(grid[0])
+myCmd len(cells[0]), sizeof(cells), sizeof(Cell), len(A), sizeof(A)
+`
+
+	s, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.ErrorContains(t, err, "test.fx:9:55: unresolved symbol 'A'")
+
+	script = script[:strings.LastIndex(script, ", len(A)")] + "\n"
+
+	s, err = LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.NoError(t, err)
+	require.Equal(t, 12, s.VariableSize("grid"))
+	require.Equal(t, 20, s.VariableSize("cells"))
+
+	require.Equal(t, "[AT(16777216, BINARY(BINARY(CHECK(IDENT(0), 3), MUL(*), INT(4)), ADD(+), INT(1)))]", fmt.Sprint(s.Commands()[0].Args))
+	require.Equal(t, "[AT(16777216, INT(8))]", fmt.Sprint(s.Commands()[1].Args))
+	require.Equal(t, "[AT(16777228, BINARY(BINARY(BINARY(INT(5), ADD(+), CHECK(IDENT(0), 5)), MUL(*), INT(2)), ADD(+), INT(1)))]", fmt.Sprint(s.Commands()[2].Args))
+	require.Equal(t, "[INT(3) INT(4) INT(12) INT(4)]", fmt.Sprint(s.Commands()[3].Args))
+	require.Equal(t, "[INT(5) INT(20) INT(2)]", fmt.Sprint(s.Commands()[4].Args))
+}
+
+func TestParser_ArrayErrors(t *testing.T) {
+	script := `var grid[2][0]
+var list[-1]
+def len 3
+var sizeof
+myCmd len(grid)
+`
+
+	_, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.EqualError(t, err, `parse error at test.fx:1:12: length 0 of 'grid' is not positive
+parse error at test.fx:2:9: length -1 of 'list' is not positive
+syntax error at test.fx:3:5: def 'len' conflicts with built-in 'len'
+syntax error at test.fx:4:5: var 'sizeof' conflicts with built-in 'sizeof'
+syntax error at test.fx:5:11: unresolved symbol 'grid'`)
+}
+
+func TestScript_EvalArrayAccessAddress(t *testing.T) {
+	s, err := LoadScript([]byte("var a\nvar list[3]\nmyCmd list[A]\n"), "test.fx", testParserConfig())
+
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"a": VariableOffset, "list": VariableOffset + 1}, s.Variables())
+
+	access := s.Commands()[0].Args[0].(*ArrayAccessNode)
+
+	addr, err := s.EvalArrayAccessAddress(access, func(Identifier) any { return 2 })
+
+	require.NoError(t, err)
+	require.Equal(t, VariableOffset+3, addr)
+
+	for _, index := range []int{-1, 3} {
+		_, err = s.EvalArrayAccessAddress(access, func(Identifier) any { return index })
+
+		var rangeErr *IndexOutOfRangeError
+
+		require.ErrorAs(t, err, &rangeErr)
+		require.Equal(t, &IndexOutOfRangeError{&SourceInfo{Filename: "test.fx", Line: 3, Column: 7}, "list", index, 3}, rangeErr)
+	}
+}
+
+func TestScript_EvalShapedAccessAddress(t *testing.T) {
+	script := `struct Enemy hp, pos[2]
+endstruct
+var grid[3][4]
+var es: Enemy[2]
+myCmd grid[A][0], grid[0][A]
+myCmd es[A].hp, es[0].pos[A]
+myCmd grid[0][4]
+`
+
+	s, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.NoError(t, err)
+
+	grid := s.Variables()["grid"]
+	es := s.Variables()["es"]
+
+	tests := []struct {
+		access   ExpressionNode
+		index    int
+		addr     int
+		variable string
+		length   int
+	}{
+		{s.Commands()[0].Args[0], 2, grid + 8, "grid", 3},
+		{s.Commands()[0].Args[0], 3, 0, "grid", 3},
+		{s.Commands()[0].Args[0], -1, 0, "grid", 3},
+		{s.Commands()[0].Args[1], 3, grid + 3, "grid[]", 4},
+		{s.Commands()[0].Args[1], 4, 0, "grid[]", 4},
+		{s.Commands()[0].Args[1], -1, 0, "grid[]", 4},
+		{s.Commands()[1].Args[0], 1, es + 3, "es", 2},
+		{s.Commands()[1].Args[0], 2, 0, "es", 2},
+		{s.Commands()[1].Args[1], 1, es + 2, "es[].pos", 2},
+		{s.Commands()[1].Args[1], 2, 0, "es[].pos", 2},
+		{s.Commands()[1].Args[1], -1, 0, "es[].pos", 2},
+	}
+
+	for _, test := range tests {
+		addr, err := s.EvalArrayAccessAddress(test.access.(*ArrayAccessNode), func(Identifier) any { return test.index })
+
+		if test.addr != 0 {
+			require.NoError(t, err)
+			require.Equal(t, test.addr, addr)
+			continue
+		}
+
+		var rangeErr *IndexOutOfRangeError
+
+		require.ErrorAs(t, err, &rangeErr)
+		require.Equal(t, &IndexOutOfRangeError{test.access.Source(), test.variable, test.index, test.length}, rangeErr)
+	}
+
+	_, err = s.EvalArrayAccessAddress(s.Commands()[2].Args[0].(*ArrayAccessNode), nil)
+
+	require.EqualError(t, err, "runtime error at test.fx:7:7: index 4 out of range for 'grid[]' with 4 elements")
+}
+
+func TestParser_Initializers(t *testing.T) {
+	script := `def BASE 10
+struct Point x, y
+endstruct
+var hp = BASE * 2
+var list[4] = {1, -2, BASE}
+var p: Point = {3}
+var empty[2] = {}
+data table
+  7, 8
+  9
+enddata
+data one 1 enddata
+`
+
+	s, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{
+		VariableOffset:      20,
+		VariableOffset + 1:  1,
+		VariableOffset + 2:  -2,
+		VariableOffset + 3:  10,
+		VariableOffset + 5:  3,
+		VariableOffset + 9:  7,
+		VariableOffset + 10: 8,
+		VariableOffset + 11: 9,
+		VariableOffset + 12: 1,
+	}, s.InitialValues())
+	require.Equal(t, 3, s.VariableSize("table"))
+	require.False(t, s.IsReadOnly(VariableOffset+8))
+	require.True(t, s.IsReadOnly(VariableOffset+9))
+	require.True(t, s.IsReadOnly(VariableOffset+11))
+	require.True(t, s.IsReadOnly(VariableOffset+12))
+}
+
+func TestParser_InitializerErrors(t *testing.T) {
+	script := `var list[2] = {1, 2, 3}
+var a = "text"
+var b = {1 2}
+var c = list
+data open 1, 2
+`
+
+	_, err := LoadScript([]byte(script), "test.fx", testParserConfig())
+
+	require.EqualError(t, err, `syntax error at test.fx:1:5: 3 values for 'list' with 2 elements
+parse error at test.fx:2:10: unexpected type 'string'
+syntax error at test.fx:3:12: unexpected number '2', expected one of ',', '}'
+parse error at test.fx:4:9: unresolved symbol 'list'
+syntax error at test.fx:5:6: data 'open' is not closed`)
+}
+
+func TestErrorList_Sort(t *testing.T) {
+	at := func(line int) error {
+		return &SyntaxError{&SourceInfo{Filename: "test.fx", Line: line, Column: 1}, &UnknownCommandError{"x"}}
+	}
+
+	plain1 := &UnknownModuleError{"a"}
+	plain2 := &UnknownModuleError{"b"}
+
+	errs := ErrorList{at(3), plain1, at(1), plain2, at(2)}
+	errs.sort()
+
+	require.Equal(t, ErrorList{plain1, plain2, at(1), at(2), at(3)}, errs)
+}
@@ -17,6 +17,9 @@ type TokenIterator struct {
 
 	prev *TokenIterator
 
+	// depth is the number of inserted sources below the main source
+	depth int
+
 	lastInsertId *atomic.Int64
 }
 
@@ -39,7 +42,9 @@ func NewTokenIterator(prefix string, source TokenSource, bufSize int) *TokenIter
 }
 
 func (i *TokenIterator) Filename() (fileName string) {
-	fileName = i.src.Filename()
+	if i.src != nil {
+		fileName = i.src.Filename()
+	}
 
 	if fileName == "" && i.prev != nil {
 		return i.prev.Filename()
@@ -99,9 +104,12 @@ func (i *TokenIterator) Insert(prefix string, src TokenSource) {
 		bufSize:      i.bufSize,
 		drained:      i.drained,
 		prev:         i.prev,
+		depth:        i.depth,
 		lastInsertId: i.lastInsertId,
 	}
 
+	i.depth++
+
 	if prefix == "" {
 		prefix = i.prefix
 	}
@@ -112,6 +120,15 @@ func (i *TokenIterator) Insert(prefix string, src TokenSource) {
 	i.drained = false
 }
 
+// nextDepth returns the depth of the source that the next token is read from.
+func (i *TokenIterator) nextDepth() int {
+	if err := i.fillBuffer(); err != nil || i.buf.Len() > 0 || i.prev == nil {
+		return i.depth
+	}
+
+	return i.prev.nextDepth()
+}
+
 func (i *TokenIterator) Peek(n int) (tok *Token, err error) {
 	if err = i.fillBuffer(); err != nil {
 		return
@@ -156,7 +173,6 @@ func (i *TokenIterator) NextToken() (tok *Token, err error) {
 			if i.prev == nil {
 				i.prefix = ""
 				i.src = nil
-				i.buf = nil
 				i.drained = true
 			} else {
 				*i = *i.prev
@@ -1,8 +1,13 @@
 package fx
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
-func (p *Parser) evalStaticVariableBracketExpression(script *Script) (v int, err error) {
+// parseLength parses the bracketed length of a dimension or a field array of name, which must be
+// positive.
+func (p *Parser) parseLength(script *Script, name string) (length int, err error) {
 	var expr ExpressionNode
 	var firstTokenInBrackets *Token
 
@@ -10,19 +15,50 @@ func (p *Parser) evalStaticVariableBracketExpression(script *Script) (v int, err
 		return
 	}
 
-	evalValue, evalErr := script.Eval(expr, func(identifier Identifier) any {
-		err = &ParseError{firstTokenInBrackets.SourceInfo, &UnresolvedSymbolError{fmt.Sprintf("%d", identifier)}}
+	if length, err = p.evalStaticExpression(script, expr, firstTokenInBrackets); err != nil {
+		return
+	}
+
+	if length < 1 {
+		err = &ParseError{firstTokenInBrackets.SourceInfo, &InvalidLengthError{name, length}}
+	}
+
+	return
+}
+
+// evalStatic evaluates an expression at parse time. Errors are reported at tok, the first token of
+// the expression.
+func (p *Parser) evalStatic(script *Script, expr ExpressionNode, tok *Token) (v any, err error) {
+	v, evalErr := script.Eval(expr, func(identifier Identifier) any {
+		name, ok := script.VariableName(int(identifier))
+
+		if !ok {
+			name = fmt.Sprintf("%d", identifier)
+		}
+
+		err = &ParseError{tok.SourceInfo, &UnresolvedSymbolError{name}}
 		return 0
 	})
 
 	if evalErr != nil {
-		return 0, evalErr
+		return nil, evalErr
+	}
+
+	return
+}
+
+// evalStaticExpression evaluates an expression that must be an integer at parse time.
+func (p *Parser) evalStaticExpression(script *Script, expr ExpressionNode, tok *Token) (v int, err error) {
+	var evalValue any
+
+	if evalValue, err = p.evalStatic(script, expr, tok); err != nil {
+		return
 	}
 
 	var ok bool
 
 	if v, ok = evalValue.(int); !ok {
-		err = &ParseError{firstTokenInBrackets.SourceInfo, &UnexpectedTypeError{fmt.Sprintf("%T", evalValue)}}
+		err = &ParseError{tok.SourceInfo, &UnexpectedTypeError{fmt.Sprintf("%T", evalValue)}}
 	}
 
 	return
@@ -61,6 +97,67 @@ func (p *Parser) parseVariableBracketExpression(script *Script) (expr Expression
 	return
 }
 
+// variableShape is the shape of a var declared with dimensions like `var grid[8][4]` or with a
+// struct. Its elements take consecutive addresses, row by row.
+type variableShape struct {
+	dimensions []int
+	layout     *Struct
+}
+
+// elementSize returns the number of addresses of one element.
+func (v *variableShape) elementSize() int {
+	if v.layout != nil {
+		return v.layout.Size
+	}
+
+	return 1
+}
+
+// checked reports whether accesses of the var check their indices against each dimension or field.
+func (v *variableShape) checked() bool {
+	return len(v.dimensions) > 1 || v.layout != nil
+}
+
+// size returns the number of addresses of the var after depth indices, e.g. of a row of a
+// two-dimensional array for depth 1.
+func (v *variableShape) size(depth int) (n int) {
+	n = v.elementSize()
+
+	for _, d := range v.dimensions[min(depth, len(v.dimensions)):] {
+		n *= d
+	}
+
+	return
+}
+
+// length returns the number of elements of the dimension after depth indices, which is 1 if there
+// are no more dimensions.
+func (v *variableShape) length(depth int) int {
+	if depth >= len(v.dimensions) {
+		return 1
+	}
+
+	return v.dimensions[depth]
+}
+
+func (p *Parser) parseDimensions(script *Script, name string) (dimensions []int, err error) {
+	var next *Token
+
+	for {
+		if next, err = p.peek(); err != nil || next.Type != LBRACKET {
+			return
+		}
+
+		var d int
+
+		if d, err = p.parseLength(script, name); err != nil {
+			return
+		}
+
+		dimensions = append(dimensions, d)
+	}
+}
+
 func (p *Parser) parseVariableDeclaration(script *Script) (err error) {
 	if _, err = p.advance(); err != nil {
 		return
@@ -72,7 +169,15 @@ func (p *Parser) parseVariableDeclaration(script *Script) (err error) {
 		return
 	}
 
-	offset := script.addVariable(nameIdent.Value)
+	var name string
+
+	if name, err = p.parseQualifiedName(nameIdent); err != nil {
+		return
+	}
+
+	if name, err = p.declare(script, SymbolVariable, nameIdent, name, script.isVariable); err != nil {
+		return
+	}
 
 	next, err := p.peek()
 
@@ -80,20 +185,30 @@ func (p *Parser) parseVariableDeclaration(script *Script) (err error) {
 		return
 	}
 
-	if next.Type == LBRACKET {
-		var l int
+	shape := &variableShape{}
 
-		if l, err = p.evalStaticVariableBracketExpression(script); err != nil {
+	if next.Type == COLON {
+		if shape.layout, err = p.parseStructType(script); err != nil {
 			return
 		}
+	}
 
-		// skip zero
-		for i := range l - 1 {
-			script.addVariableWithOffset(fmt.Sprintf("__%s_%d", nameIdent.Value, i+1), offset+i+1)
-		}
+	if shape.dimensions, err = p.parseDimensions(script, name); err != nil {
+		return
 	}
 
-	return
+	size := shape.size(0)
+	offset := script.addVariable(name, size)
+
+	if shape.layout != nil || len(shape.dimensions) > 0 {
+		script.shapes[name] = shape
+	}
+
+	if next, err = p.peek(); err != nil || next.Type != ASSIGN {
+		return
+	}
+
+	return p.parseInitializer(script, nameIdent, name, offset, size)
 }
 
 func (p *Parser) parseArrayAccess(script *Script, identToken *Token, varIdent int) (expr ExpressionNode, err error) {
@@ -107,3 +222,154 @@ func (p *Parser) parseArrayAccess(script *Script, identToken *Token, varIdent in
 
 	return
 }
+
+// addIndex returns the sum of two indices, which is folded if both are constant.
+func addIndex(sourceInfo *SourceInfo, a ExpressionNode, b ExpressionNode) ExpressionNode {
+	if a == nil {
+		return b
+	}
+
+	intA, okA := a.(*IntegerNode)
+	intB, okB := b.(*IntegerNode)
+
+	switch {
+	case okA && okB:
+		return &IntegerNode{sourceInfo, intA.Value + intB.Value}
+	case okB && intB.Value == 0:
+		return a
+	}
+
+	return &BinaryOpNode{sourceInfo, a, &Token{sourceInfo, ADD, SynPlus}, b}
+}
+
+// scaleIndex returns the product of an index and a constant, which is folded if the index is
+// constant.
+func scaleIndex(sourceInfo *SourceInfo, index ExpressionNode, factor int) ExpressionNode {
+	if factor == 1 {
+		return index
+	}
+
+	if n, ok := index.(*IntegerNode); ok {
+		return &IntegerNode{sourceInfo, n.Value * factor}
+	}
+
+	return &BinaryOpNode{sourceInfo, index, &Token{sourceInfo, MUL, SynAsterisk}, &IntegerNode{sourceInfo, factor}}
+}
+
+// checkIndex returns the index of a dimension or field array with a check against its length. A
+// constant index within the length doesn't need one.
+func checkIndex(sourceInfo *SourceInfo, name string, index ExpressionNode, length int) ExpressionNode {
+	if n, ok := index.(*IntegerNode); ok && n.Value >= 0 && n.Value < length {
+		return index
+	}
+
+	return &IndexCheckNode{sourceInfo, name, index, length}
+}
+
+// parseShapedAccess parses the access of an element or field of a var with a shape, e.g.
+// `grid[x][y]` or `es[i].pos[1]`. It is compiled to an index into the consecutive addresses of
+// the var, here `x * 4 + y` for a `var grid[8][4]` and `i * sizeof(Name) + offset(pos) + 1`.
+// Fewer indices than dimensions access the first element of a row. Every index is checked against
+// its dimension or field, unless the var has a single dimension, which is covered by the check of
+// the whole var.
+func (p *Parser) parseShapedAccess(script *Script, tok *Token, varIdent int, v *variableShape, fieldName string) (expr ExpressionNode, err error) {
+	var index ExpressionNode
+	var next *Token
+
+	name := script.variableNames[varIdent]
+	checked := v.checked()
+
+	if fieldName == "" {
+		for i, d := range v.dimensions {
+			if next, err = p.peek(); err != nil {
+				return
+			}
+
+			if next.Type != LBRACKET {
+				if index != nil {
+					index = scaleIndex(tok.SourceInfo, index, d)
+				}
+
+				continue
+			}
+
+			var element ExpressionNode
+
+			if element, _, err = p.parseVariableBracketExpression(script); err != nil {
+				return
+			}
+
+			if checked {
+				element = checkIndex(tok.SourceInfo, name+strings.Repeat("[]", i), element, d)
+			}
+
+			if i > 0 {
+				index = scaleIndex(tok.SourceInfo, index, d)
+			}
+
+			index = addIndex(tok.SourceInfo, index, element)
+		}
+
+		if index != nil {
+			index = scaleIndex(tok.SourceInfo, index, v.elementSize())
+		}
+
+		if next, err = p.peek(); err != nil {
+			return
+		}
+
+		if v.layout != nil && next.Type == DOT {
+			if _, err = p.advance(); err != nil {
+				return
+			}
+
+			var fieldTok *Token
+
+			if fieldTok, err = p.advance(); err != nil {
+				return
+			}
+
+			if fieldTok.Type != IDENT {
+				err = &SyntaxError{fieldTok.SourceInfo, &UnexpectedTokenError{[]TokenType{IDENT}, fieldTok}}
+				return
+			}
+
+			fieldName = fieldTok.Value
+		}
+	}
+
+	if fieldName != "" {
+		field, ok := v.layout.Field(fieldName)
+
+		if !ok {
+			err = &SyntaxError{tok.SourceInfo, &UnknownFieldError{v.layout.Name, fieldName}}
+			return
+		}
+
+		index = addIndex(tok.SourceInfo, index, &IntegerNode{tok.SourceInfo, field.Offset})
+
+		if next, err = p.peek(); err != nil {
+			return
+		}
+
+		if next.Type == LBRACKET {
+			var element ExpressionNode
+
+			if element, _, err = p.parseVariableBracketExpression(script); err != nil {
+				return
+			}
+
+			fieldPath := name + strings.Repeat("[]", len(v.dimensions)) + "." + fieldName
+			index = addIndex(tok.SourceInfo, index, checkIndex(tok.SourceInfo, fieldPath, element, field.Length))
+		}
+	}
+
+	if index == nil {
+		expr = &IdentifierNode{tok.SourceInfo, Identifier(varIdent)}
+		return
+	}
+
+	expr = &ArrayAccessNode{tok.SourceInfo, Identifier(varIdent), index}
+
+	return
+}
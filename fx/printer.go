@@ -0,0 +1,408 @@
+package fx
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Printer renders a parsed script back to fx source. Macros and defs are expanded, includes are
+// inlined and local labels are printed with their full names, so the output parses to the same
+// commands without any other files. Structs are printed before the vars, and accesses of vars with
+// several dimensions or a struct are printed with one index per dimension and the field, e.g.
+// `grid[x][0]` or `es[i].pos[1]`.
+type Printer struct {
+	Commands    CommandTypeTable
+	Identifiers IdentifierTable
+
+	// Annotate adds the pc and source position of every command as a comment.
+	Annotate bool
+
+	commandNames    map[CommandType]string
+	identifierNames map[Identifier]string
+}
+
+func (pr *Printer) init() {
+	if pr.commandNames != nil {
+		return
+	}
+
+	pr.commandNames = make(map[CommandType]string)
+	pr.identifierNames = make(map[Identifier]string)
+
+	for name, typ := range pr.Commands {
+		if prev, ok := pr.commandNames[typ]; !ok || name < prev {
+			pr.commandNames[typ] = name
+		}
+	}
+
+	for name, identifier := range pr.Identifiers {
+		if prev, ok := pr.identifierNames[identifier]; !ok || name < prev {
+			pr.identifierNames[identifier] = name
+		}
+	}
+}
+
+func (pr *Printer) commandName(typ CommandType) string {
+	pr.init()
+
+	if name, ok := pr.commandNames[typ]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("cmd%d", typ)
+}
+
+func (pr *Printer) identifierName(s *Script, identifier Identifier) string {
+	pr.init()
+
+	if name, ok := s.VariableName(int(identifier)); ok {
+		return name
+	}
+
+	if name, ok := pr.identifierNames[identifier]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(identifier))
+}
+
+func formatFloat(v float64) string {
+	str := strconv.FormatFloat(v, 'f', -1, 64)
+
+	if !strings.Contains(str, ".") {
+		str += ".0"
+	}
+
+	return str
+}
+
+func (pr *Printer) operand(s *Script, expr ExpressionNode) string {
+	if n, ok := expr.(*IndexCheckNode); ok {
+		expr = n.Index
+	}
+
+	if _, ok := expr.(*BinaryOpNode); ok {
+		return "(" + pr.Expression(s, expr) + ")"
+	}
+
+	return pr.Expression(s, expr)
+}
+
+// Expression renders an expression. Nested binary operations are parenthesized, so the output does
+// not depend on the operator precedence.
+func (pr *Printer) Expression(s *Script, expr ExpressionNode) string {
+	switch n := expr.(type) {
+	case *IntegerNode:
+		return strconv.Itoa(n.Value)
+	case *FloatNode:
+		return formatFloat(n.Value)
+	case *StringNode:
+		return `"` + n.Value + `"`
+	case *IdentifierNode:
+		return pr.identifierName(s, n.Identifier)
+	case *AddressNode:
+		if label, ok := s.LabelAt(n.Address); ok {
+			return label
+		}
+
+		return strconv.Itoa(n.Address)
+	case *ArrayAccessNode:
+		if access, ok := pr.shapedAccess(s, n); ok {
+			return access
+		}
+
+		if shape, ok := s.shapes[s.variableNames[int(n.Variable)]]; ok && shape.checked() {
+			// an index that was not parsed from an access addresses the element directly
+			return "*(&" + pr.identifierName(s, n.Variable) + " + " + pr.operand(s, n.Index) + ")"
+		}
+
+		return pr.identifierName(s, n.Variable) + "[" + pr.Expression(s, n.Index) + "]"
+	case *IndexCheckNode:
+		return pr.Expression(s, n.Index)
+	case *ImportNode:
+		if n.Index != nil {
+			return n.Module + "." + n.Name + "[" + pr.Expression(s, n.Index) + "]"
+		}
+
+		return n.Module + "." + n.Name
+	case *UnaryOpNode:
+		return tokenText(n.Operator) + pr.operand(s, n.Expr)
+	case *BinaryOpNode:
+		return pr.operand(s, n.Left) + " " + tokenText(n.Operator) + " " + pr.operand(s, n.Right)
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprintf("%v", expr)
+}
+
+// linearIndex splits an index compiled from a shaped access into its constant part and the index
+// checks with their factors. ok is false for other expressions.
+func linearIndex(expr ExpressionNode, factor int, checks map[*IndexCheckNode]int) (constant int, ok bool) {
+	switch n := expr.(type) {
+	case *IntegerNode:
+		return n.Value * factor, true
+	case *IndexCheckNode:
+		checks[n] += factor
+		return 0, true
+	case *BinaryOpNode:
+		switch n.Operator.Type {
+		case ADD:
+			left, okLeft := linearIndex(n.Left, factor, checks)
+			right, okRight := linearIndex(n.Right, factor, checks)
+
+			return left + right, okLeft && okRight
+		case MUL:
+			if right, isInt := n.Right.(*IntegerNode); isInt {
+				return linearIndex(n.Left, factor*right.Value, checks)
+			}
+		}
+	}
+
+	return
+}
+
+// shapedAccess renders an access of a var with several dimensions or a struct like it was parsed.
+// Constant indices are recovered from the folded index by the strides of the dimensions, the
+// others from their index checks, which are named after their dimension or field.
+func (pr *Printer) shapedAccess(s *Script, n *ArrayAccessNode) (access string, ok bool) {
+	shape, ok := s.shapes[s.variableNames[int(n.Variable)]]
+
+	if !ok || !shape.checked() {
+		return "", false
+	}
+
+	checks := make(map[*IndexCheckNode]int)
+	constant, ok := linearIndex(n.Index, 1, checks)
+
+	if !ok {
+		return
+	}
+
+	indices := make([]string, len(shape.dimensions))
+
+	var fieldCheck *IndexCheckNode
+
+	for check, factor := range checks {
+		depth := 0
+
+		for rest := check.Variable; strings.HasSuffix(rest, "[]"); rest = rest[:len(rest)-2] {
+			depth++
+		}
+
+		switch {
+		case depth == 0 && shape.layout != nil && factor == 1 && fieldCheck == nil:
+			fieldCheck = check
+		case depth < len(shape.dimensions) && factor == shape.size(depth+1) && indices[depth] == "":
+			indices[depth] = pr.Expression(s, check.Index)
+		default:
+			return "", false
+		}
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(pr.identifierName(s, n.Variable))
+
+	for depth, d := range shape.dimensions {
+		stride := shape.size(depth + 1)
+		index := constant / stride
+		constant -= index * stride
+
+		if index < 0 || index >= d || index > 0 && indices[depth] != "" {
+			return "", false
+		}
+
+		if indices[depth] == "" {
+			indices[depth] = strconv.Itoa(index)
+		}
+
+		sb.WriteString("[" + indices[depth] + "]")
+	}
+
+	if shape.layout == nil {
+		return sb.String(), constant == 0
+	}
+
+	for _, field := range shape.layout.Fields {
+		if constant < field.Offset || constant >= field.Offset+field.Length {
+			continue
+		}
+
+		sb.WriteString("." + field.Name)
+
+		switch {
+		case fieldCheck != nil && constant == field.Offset && strings.HasSuffix(fieldCheck.Variable, "."+field.Name):
+			sb.WriteString("[" + pr.Expression(s, fieldCheck.Index) + "]")
+		case fieldCheck != nil:
+			return "", false
+		case field.Length > 1:
+			sb.WriteString("[" + strconv.Itoa(constant-field.Offset) + "]")
+		}
+
+		return sb.String(), true
+	}
+
+	return "", false
+}
+
+// Command renders a command with its arguments.
+func (pr *Printer) Command(s *Script, cmd *CommandNode) string {
+	args := make([]string, len(cmd.Args))
+
+	for i, arg := range cmd.Args {
+		args[i] = pr.Expression(s, arg)
+	}
+
+	if len(args) == 0 {
+		return pr.commandName(cmd.Type)
+	}
+
+	return pr.commandName(cmd.Type) + " " + strings.Join(args, ", ")
+}
+
+// printVariable returns the declaration of the var at offset with its initial values. Data tables
+// are printed as data blocks.
+func printVariable(s *Script, offset int) string {
+	name := s.variableNames[offset]
+	n := s.variableSizes[offset]
+	decl := name
+
+	shape, shaped := s.shapes[name]
+
+	switch {
+	case shaped && shape.layout != nil:
+		decl += ": " + shape.layout.Name
+		fallthrough
+	case shaped:
+		for _, d := range shape.dimensions {
+			decl += fmt.Sprintf("[%d]", d)
+		}
+	case n > 1:
+		decl += fmt.Sprintf("[%d]", n)
+	}
+
+	var values []string
+
+	for addr := offset; addr < offset+n; addr++ {
+		if _, ok := s.initialValues[addr]; ok {
+			// gaps between initial values are printed as 0
+			for len(values) < addr-offset {
+				values = append(values, "0")
+			}
+
+			values = append(values, strconv.Itoa(s.initialValues[addr]))
+		}
+	}
+
+	switch {
+	case s.readOnly[offset] && len(values) == 0:
+		return fmt.Sprintf("data %s\nenddata\n", name)
+	case s.readOnly[offset]:
+		return fmt.Sprintf("data %s\n%s%s\nenddata\n", name, formatIndent, strings.Join(values, ", "))
+	case (shaped || n > 1) && len(values) > 0:
+		return fmt.Sprintf("var %s = {%s}\n", decl, strings.Join(values, ", "))
+	case len(values) > 0:
+		return fmt.Sprintf("var %s = %s\n", decl, values[0])
+	}
+
+	return fmt.Sprintf("var %s\n", decl)
+}
+
+// printStruct returns the declaration of a struct.
+func printStruct(layout *Struct) string {
+	fields := make([]string, len(layout.Fields))
+
+	for i, field := range layout.Fields {
+		fields[i] = field.Name
+
+		if field.Length > 1 {
+			fields[i] += fmt.Sprintf("[%d]", field.Length)
+		}
+	}
+
+	return fmt.Sprintf("struct %s\n%s%s\nendstruct\n", layout.Name, formatIndent, strings.Join(fields, ", "))
+}
+
+// Fprint writes the script as source: all structs and vars, followed by the commands and their
+// labels.
+func (pr *Printer) Fprint(w io.Writer, s *Script) (err error) {
+	var sb strings.Builder
+
+	for _, name := range slices.Sorted(maps.Keys(s.structs)) {
+		sb.WriteString(printStruct(s.structs[name]))
+	}
+
+	for _, offset := range slices.Sorted(maps.Keys(s.variableNames)) {
+		sb.WriteString(printVariable(s, offset))
+	}
+
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+
+	indent := ""
+
+	for pc := 0; pc <= len(s.commands); pc++ {
+		labels := s.LabelsAt(pc)
+
+		if len(labels) > 0 && pc > 0 {
+			sb.WriteString("\n")
+		}
+
+		for _, label := range labels {
+			sb.WriteString(label + ":\n")
+			indent = formatIndent
+		}
+
+		if pc < len(s.commands) {
+			line := indent + pr.Command(s, s.commands[pc])
+
+			if pr.Annotate {
+				line = fmt.Sprintf("%-40s # %04d %s", line, pc, s.commands[pc].SourceInfo.Position())
+			}
+
+			sb.WriteString(line + "\n")
+		}
+	}
+
+	_, err = io.WriteString(w, sb.String())
+
+	return
+}
+
+// Listing writes a disassembly of the script: every command with its pc and source position,
+// preceded by its labels. Jump targets are resolved to their pc.
+func (pr *Printer) Listing(w io.Writer, s *Script) (err error) {
+	var sb strings.Builder
+
+	for pc, cmd := range s.commands {
+		for _, label := range s.LabelsAt(pc) {
+			sb.WriteString(label + ":\n")
+		}
+
+		line := fmt.Sprintf("%04d  %-24s %s", pc, cmd.SourceInfo.Position(), pr.Command(s, cmd))
+
+		var targets []string
+
+		for _, arg := range cmd.Args {
+			if addr, ok := arg.(*AddressNode); ok {
+				targets = append(targets, fmt.Sprintf("%04d", addr.Address))
+			}
+		}
+
+		if len(targets) > 0 {
+			line += "  -> " + strings.Join(targets, ", ")
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	_, err = io.WriteString(w, sb.String())
+
+	return
+}
@@ -0,0 +1,118 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const printerTestScript = `var counter
+var list[3]
+
+main:
+  set counter, 0
+%loop:
+  set list[1], counter * 2
+  set counter, counter + 1
+  jumpIf counter < 3, %loop
+`
+
+func printerTestConfig() *ParserConfig {
+	return &ParserConfig{
+		CommandTypes: CommandTypeTable{
+			"set":    CmdSet,
+			"jumpIf": CmdJumpIf,
+		},
+	}
+}
+
+func TestScript_ReverseLookup(t *testing.T) {
+	s, err := LoadScript([]byte(printerTestScript), "test.fx", printerTestConfig())
+
+	require.NoError(t, err)
+
+	name, ok := s.LabelAt(1)
+
+	require.True(t, ok)
+	require.Equal(t, "mainloop", name)
+
+	_, ok = s.LabelAt(2)
+
+	require.False(t, ok)
+
+	name, ok = s.VariableName(VariableOffset)
+
+	require.True(t, ok)
+	require.Equal(t, "counter", name)
+
+	name, ok = s.VariableName(VariableOffset + 3)
+
+	require.True(t, ok)
+	require.Equal(t, "list[2]", name)
+
+	_, ok = s.VariableName(VariableOffset + 4)
+
+	require.False(t, ok)
+}
+
+func TestPrinter_Listing(t *testing.T) {
+	cfg := printerTestConfig()
+	s, err := LoadScript([]byte(printerTestScript), "test.fx", cfg)
+
+	require.NoError(t, err)
+
+	var sb strings.Builder
+
+	require.NoError(t, (&Printer{Commands: cfg.CommandTypes}).Listing(&sb, s))
+	require.Equal(t, `main:
+0000  test.fx:5:3              set counter, 0
+mainloop:
+0001  test.fx:7:3              set list[1], counter * 2
+0002  test.fx:8:3              set counter, counter + 1
+0003  test.fx:9:3              jumpIf counter < 3, mainloop  -> 0001
+`, sb.String())
+
+	sb.Reset()
+
+	require.NoError(t, (&Printer{Commands: cfg.CommandTypes, Annotate: true}).Fprint(&sb, s))
+
+	printed, err := LoadScript([]byte(sb.String()), "printed.fx", cfg)
+
+	require.NoError(t, err)
+	require.Equal(t, s.Labels(), printed.Labels())
+	require.Contains(t, sb.String(), "jumpIf counter < 3, mainloop           # 0003 test.fx:9:3\n")
+}
+
+func TestPrinter_Shapes(t *testing.T) {
+	src := `struct Enemy
+  hp, pos[2]
+endstruct
+var grid[3][4] = {1, 2}
+var es: Enemy[2]
+var boss: Enemy
+var i
+
+set grid[1][2], grid[i][3]
+set grid[2][0], grid[i][i + 1]
+set es[1].pos[i], es[i].hp
+set boss.pos[1], boss.hp
+set grid[5][0], 1
+`
+
+	cfg := printerTestConfig()
+
+	s, err := LoadScript([]byte(src), "test.fx", cfg)
+
+	require.NoError(t, err)
+
+	var printed strings.Builder
+
+	require.NoError(t, (&Printer{Commands: cfg.CommandTypes}).Fprint(&printed, s))
+	require.Equal(t, src, printed.String())
+
+	// an index that is not compiled from an access is printed as address
+	s.Commands()[0].Args[0] = &ArrayAccessNode{Variable: Identifier(s.Variables()["grid"]), Index: &IdentifierNode{Identifier: Identifier(s.Variables()["i"])}}
+
+	require.Equal(t, "set *(&grid + i), grid[i][3]", (&Printer{Commands: cfg.CommandTypes}).Command(s, s.Commands()[0]))
+}
@@ -1,12 +1,18 @@
 package fx
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+)
 
 const VariableOffset = 1024 * 1024 * 16
 
 type Script struct {
 	commands []*CommandNode
 
+	// commandNames are the names of the user commands in commands, by type.
+	commandNames map[CommandType]string
+
 	labels  map[string]int
 	symbols map[string][]*AddressNode
 	defines map[string]ExpressionNode
@@ -14,11 +20,32 @@ type Script struct {
 
 	variables     map[string]int
 	variableNames map[int]string
+	variableSizes map[int]int
+	variableSpace int
+
+	initialValues map[int]int
+	readOnly      map[int]bool
+
+	structs map[string]*Struct
+	shapes  map[string]*variableShape
+
+	operators BinaryOperatorTable
+
+	module   string
+	filename string
+	imports  map[string]*SourceInfo
+	exports  map[string]*SourceInfo
+
+	namespaces map[string]*SourceInfo
+
+	declarations []*Declaration
+	references   []*Reference
 }
 
 func newScript() *Script {
 	return &Script{
-		commands: make([]*CommandNode, 0),
+		commands:     make([]*CommandNode, 0),
+		commandNames: make(map[CommandType]string),
 
 		labels:  make(map[string]int),
 		symbols: make(map[string][]*AddressNode),
@@ -27,20 +54,44 @@ func newScript() *Script {
 
 		variables:     make(map[string]int),
 		variableNames: make(map[int]string),
+		variableSizes: make(map[int]int),
+
+		initialValues: make(map[int]int),
+		readOnly:      make(map[int]bool),
+
+		structs: make(map[string]*Struct),
+		shapes:  make(map[string]*variableShape),
+
+		imports: make(map[string]*SourceInfo),
+		exports: make(map[string]*SourceInfo),
+
+		namespaces: make(map[string]*SourceInfo),
 	}
 }
 
-func (s *Script) addVariable(varName string) (offset int) {
-	offset = VariableOffset + len(s.variables)
+// addVariable reserves size consecutive addresses for a var and returns the first.
+func (s *Script) addVariable(varName string, size int) (offset int) {
+	offset = VariableOffset + s.variableSpace
 
-	s.addVariableWithOffset(varName, offset)
+	s.addVariableWithOffset(varName, offset, size)
 
 	return
 }
 
-func (s *Script) addVariableWithOffset(varName string, offset int) {
+func (s *Script) addVariableWithOffset(varName string, offset int, size int) {
 	s.variables[varName] = offset
 	s.variableNames[offset] = varName
+	s.variableSizes[offset] = size
+	s.variableSpace = max(s.variableSpace, offset-VariableOffset+size)
+}
+
+// addCommand appends a command. name is the name of its type in the command table.
+func (s *Script) addCommand(cmd *CommandNode, name string) {
+	s.commands = append(s.commands, cmd)
+
+	if cmd.Type >= UserCommandOffset {
+		s.commandNames[cmd.Type] = name
+	}
 }
 
 func (s *Script) addSymbol(label string, addr *AddressNode) {
@@ -86,6 +137,60 @@ func (s *Script) Labels() map[string]int {
 	return s.labels
 }
 
+// LabelsAt returns the names of all labels at pc in alphabetical order.
+func (s *Script) LabelsAt(pc int) (labels []string) {
+	for name, labelPC := range s.labels {
+		if labelPC == pc {
+			labels = append(labels, name)
+		}
+	}
+
+	slices.Sort(labels)
+
+	return
+}
+
+// LabelAt returns the first name of a label at pc, see LabelsAt.
+func (s *Script) LabelAt(pc int) (name string, ok bool) {
+	if labels := s.LabelsAt(pc); len(labels) > 0 {
+		return labels[0], true
+	}
+
+	return
+}
+
+// VariableName returns the name of the var at addr. Array elements are named like `list[2]`.
+func (s *Script) VariableName(addr int) (name string, ok bool) {
+	if name, ok = s.variableNames[addr]; ok {
+		return
+	}
+
+	for offset, size := range s.variableSizes {
+		if addr > offset && addr < offset+size {
+			return fmt.Sprintf("%s[%d]", s.variableNames[offset], addr-offset), true
+		}
+	}
+
+	return
+}
+
+// VariableSize returns the number of addresses of a var, which is 1 for plain vars and 0 for
+// unknown vars.
+func (s *Script) VariableSize(name string) int {
+	offset, ok := s.variables[name]
+
+	if !ok {
+		return 0
+	}
+
+	return s.variableSizes[offset]
+}
+
+// VariableSpace returns the number of addresses of all vars, starting at VariableOffset.
+func (s *Script) VariableSpace() int {
+	return s.variableSpace
+}
+
 func (s *Script) Symbols() map[string][]*AddressNode {
 	return s.symbols
 }
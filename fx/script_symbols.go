@@ -0,0 +1,127 @@
+package fx
+
+type SymbolKind int
+
+const (
+	SymbolLabel SymbolKind = iota
+	SymbolMacro
+	SymbolDefine
+	SymbolVariable
+	SymbolIdentifier
+	SymbolModule
+	SymbolCommand
+	SymbolStruct
+	SymbolBuiltin
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case SymbolLabel:
+		return "label"
+	case SymbolMacro:
+		return "macro"
+	case SymbolDefine:
+		return "def"
+	case SymbolVariable:
+		return "var"
+	case SymbolIdentifier:
+		return "identifier"
+	case SymbolModule:
+		return "module"
+	case SymbolCommand:
+		return "command"
+	case SymbolStruct:
+		return "struct"
+	case SymbolBuiltin:
+		return "built-in"
+	default:
+		return "unknown"
+	}
+}
+
+// Declaration is the place where a label, macro, def or var is declared.
+type Declaration struct {
+	*SourceInfo
+	Kind SymbolKind
+	Name string
+}
+
+// Reference is a usage of a declared symbol or a host identifier.
+type Reference struct {
+	*SourceInfo
+	Kind SymbolKind
+	Name string
+}
+
+func (s *Script) addDeclaration(kind SymbolKind, name string, sourceInfo *SourceInfo) {
+	s.declarations = append(s.declarations, &Declaration{sourceInfo, kind, name})
+}
+
+func (s *Script) addReference(kind SymbolKind, name string, sourceInfo *SourceInfo) (ref *Reference) {
+	ref = &Reference{sourceInfo, kind, name}
+	s.references = append(s.references, ref)
+
+	return
+}
+
+func (s *Script) isLabel(name string) bool {
+	_, ok := s.labels[name]
+	return ok
+}
+
+func (s *Script) isDefine(name string) bool {
+	_, ok := s.defines[name]
+	return ok
+}
+
+func (s *Script) isVariable(name string) bool {
+	_, ok := s.variables[name]
+	return ok
+}
+
+func (s *Script) isMacro(name string) bool {
+	_, ok := s.macros[name]
+	return ok
+}
+
+func (s *Script) isStruct(name string) bool {
+	_, ok := s.structs[name]
+	return ok
+}
+
+func (s *Script) isStructVariable(name string) bool {
+	v, ok := s.shapes[name]
+	return ok && v.layout != nil
+}
+
+func (s *Script) Declarations() []*Declaration {
+	return s.declarations
+}
+
+func (s *Script) References() []*Reference {
+	return s.references
+}
+
+// Declaration returns the last declaration of the symbol, which is the one in effect after parsing.
+func (s *Script) Declaration(kind SymbolKind, name string) (decl *Declaration, ok bool) {
+	for i := len(s.declarations) - 1; i >= 0; i-- {
+		if d := s.declarations[i]; d.Kind == kind && d.Name == name {
+			return d, true
+		}
+	}
+
+	return
+}
+
+func (s *Script) Macro(name string) (m *Macro, ok bool) {
+	m, ok = s.macros[name]
+	return
+}
+
+func (s *Script) Macros() map[string]*Macro {
+	return s.macros
+}
+
+func (s *Script) Defines() map[string]ExpressionNode {
+	return s.defines
+}
@@ -0,0 +1,151 @@
+package fxtest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Section names of the .fxt format.
+const (
+	SectionExpect = "EXPECT"
+	SectionMemory = "MEMORY"
+	SectionError  = "ERROR"
+	SectionFile   = "FILE"
+)
+
+// Line is a line of an expectation section with its line number in the .fxt file.
+type Line struct {
+	Number int
+	Text   string
+}
+
+// Case is a parsed .fxt file. The script comes first and is followed by sections that start with
+// a header line like `--- EXPECT ---`:
+//
+//	EXPECT            the values of all eval commands in order, strings are quoted and floats
+//	                  contain a '.'
+//	MEMORY            final values as `name = value`, array elements as `name[i] = value`
+//	ERROR             expected parse or runtime errors as `file:line:column: message`
+//	FILE <path>       a file that can be included from the script
+//
+// Empty lines and lines starting with '#' are ignored in EXPECT, MEMORY and ERROR.
+type Case struct {
+	Filename string
+	Script   []byte
+
+	Expect []*Line
+	Memory []*Line
+	Errors []*Line
+	Files  map[string][]byte
+
+	// sections that were present, even if empty
+	sections map[string]bool
+}
+
+type HeaderError struct {
+	Filename string
+	Line     int
+	Header   string
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("%s:%d: invalid section header '%s'", e.Filename, e.Line, e.Header)
+}
+
+// parseHeader returns the name and argument of a section header line.
+func parseHeader(line string) (name string, arg string, ok bool) {
+	if !strings.HasPrefix(line, "--- ") || !strings.HasSuffix(line, " ---") || len(line) < 8 {
+		return
+	}
+
+	name, arg, _ = strings.Cut(strings.TrimSpace(line[4:len(line)-4]), " ")
+
+	return name, strings.TrimSpace(arg), true
+}
+
+// Parse splits the contents of a .fxt file into the script and its sections.
+func Parse(filename string, data []byte) (c *Case, err error) {
+	c = &Case{
+		Filename: filename,
+		Files:    make(map[string][]byte),
+		sections: make(map[string]bool),
+	}
+
+	lines := bytes.SplitAfter(data, []byte("\n"))
+
+	var script bytes.Buffer
+	var section *[]*Line
+
+	var fileName string
+	var file *bytes.Buffer
+
+	flush := func() {
+		if file != nil {
+			c.Files[fileName] = file.Bytes()
+			file = nil
+		}
+	}
+
+	for i, rawLine := range lines {
+		line := strings.TrimRight(string(rawLine), "\r\n")
+
+		if name, arg, ok := parseHeader(line); ok {
+			flush()
+
+			c.sections[name] = true
+
+			switch {
+			case name == SectionExpect && arg == "":
+				section = &c.Expect
+			case name == SectionMemory && arg == "":
+				section = &c.Memory
+			case name == SectionError && arg == "":
+				section = &c.Errors
+			case name == SectionFile && arg != "":
+				section = nil
+				fileName = path.Clean(arg)
+				file = &bytes.Buffer{}
+			default:
+				return nil, &HeaderError{filename, i + 1, line}
+			}
+
+			continue
+		}
+
+		switch {
+		case file != nil:
+			file.Write(rawLine)
+		case section != nil:
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				*section = append(*section, &Line{i + 1, trimmed})
+			}
+		case len(c.sections) == 0:
+			script.Write(rawLine)
+		}
+	}
+
+	flush()
+
+	c.Script = script.Bytes()
+
+	return
+}
+
+// ReadFile reads and parses a .fxt file. The case is named after the base name of the file.
+func ReadFile(filename string) (c *Case, err error) {
+	var data []byte
+
+	if data, err = os.ReadFile(filename); err != nil {
+		return
+	}
+
+	return Parse(path.Base(filename), data)
+}
+
+// HasSection reports whether the file contains a section, even if it has no lines.
+func (c *Case) HasSection(name string) bool {
+	return c.sections[name]
+}
@@ -0,0 +1,352 @@
+package fxtest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/vm"
+	"github.com/stretchr/testify/require"
+)
+
+// Extension is the file extension of test cases.
+const Extension = "fxt"
+
+// EvalCommand records the values of its arguments for the EXPECT section.
+const EvalCommand = "eval"
+
+// EvalCommandType is the type of EvalCommand. The types of other commands must not collide with it.
+const EvalCommandType = fx.UserCommandOffset
+
+type Config struct {
+	// Commands are available in addition to eval. Their types are kept as they are and must be
+	// greater than EvalCommandType and unique.
+	Commands []*vm.Command
+
+	Identifiers fx.IdentifierTable
+	Symbols     fx.SymbolTable
+	LookupFn    fx.LookupFn
+
+	// FS serves includes that are not provided by FILE sections and may be nil.
+	FS fs.FS
+
+	Hooks *vm.Hooks
+}
+
+// Result is the outcome of a case, for checks beyond the ones of the .fxt format.
+type Result struct {
+	Script       *fx.Script
+	ParserConfig *fx.ParserConfig
+
+	Memory map[fx.Identifier]int
+	Values []any
+	Errors fx.ErrorList
+
+	parser *fx.Parser
+}
+
+type env struct {
+	memory map[fx.Identifier]int
+	values []any
+	errs   fx.ErrorList
+}
+
+func (e *env) Get(identifier fx.Identifier) int {
+	return e.memory[identifier]
+}
+
+func (e *env) Set(identifier fx.Identifier, value int) {
+	e.memory[identifier] = value
+}
+
+func (e *env) HandleError(err error) {
+	e.errs = append(e.errs, err)
+}
+
+func (e *env) handleEval(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
+	for _, arg := range args {
+		v, err := f.Eval(arg)
+
+		if err != nil {
+			f.HandleError(err)
+			return
+		}
+
+		e.values = append(e.values, v)
+	}
+
+	return
+}
+
+// overlayFS serves the FILE sections of a case and falls back to base.
+type overlayFS struct {
+	files fstest.MapFS
+	base  fs.FS
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	if _, ok := o.files[name]; ok || o.base == nil {
+		return o.files.Open(name)
+	}
+
+	return o.base.Open(name)
+}
+
+func (cfg *Config) runtimeConfig(e *env) (rtCfg *vm.RuntimeConfig, err error) {
+	commands := []*vm.Command{
+		{Name: EvalCommand, Type: EvalCommandType, Handler: e.handleEval},
+	}
+
+	names := map[fx.CommandType]string{EvalCommandType: EvalCommand}
+
+	for _, cmd := range cfg.Commands {
+		if cmd.Type <= EvalCommandType {
+			err = fmt.Errorf("type %d of command '%s' must be greater than %d", cmd.Type, cmd.Name, EvalCommandType)
+			return
+		}
+
+		if name, ok := names[cmd.Type]; ok {
+			err = fmt.Errorf("commands '%s' and '%s' have the same type %d", name, cmd.Name, cmd.Type)
+			return
+		}
+
+		names[cmd.Type] = cmd.Name
+		commands = append(commands, cmd)
+	}
+
+	rtCfg = &vm.RuntimeConfig{
+		UserCommands: commands,
+		Identifiers:  cfg.Identifiers,
+		Hooks:        cfg.Hooks,
+	}
+
+	return
+}
+
+// Run parses and runs a case and checks all of its sections. A case without sections is skipped.
+func Run(t testing.TB, c *Case, cfg *Config) (res *Result) {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	e := &env{
+		memory: make(map[fx.Identifier]int),
+		values: make([]any, 0),
+	}
+
+	files := make(fstest.MapFS)
+
+	for name, data := range c.Files {
+		files[name] = &fstest.MapFile{Data: data}
+	}
+
+	rtCfg, err := cfg.runtimeConfig(e)
+
+	if err != nil {
+		t.Fatalf("%s: invalid config: %v", c.Filename, err)
+	}
+
+	res = &Result{
+		ParserConfig: rtCfg.ParserConfig(fx.NewParserFS(&overlayFS{files, cfg.FS}), cfg.LookupFn),
+		Memory:       e.memory,
+	}
+
+	res.ParserConfig.Symbols = cfg.Symbols
+	res.parser = fx.NewParser(fx.NewLexer(c.Script, c.Filename), res.ParserConfig)
+
+	script, err := res.parser.Parse()
+
+	if err != nil {
+		if !errors.As(err, &res.Errors) {
+			res.Errors = fx.ErrorList{err}
+		}
+
+		checkErrors(t, c, res)
+
+		return
+	}
+
+	res.Script = script
+
+	rt := vm.NewRuntime(script, rtCfg)
+
+	rt.InitMemory(e)
+	rt.Start(0, e)
+
+	res.Values = e.values
+	res.Errors = e.errs
+
+	checkErrors(t, c, res)
+	checkExpect(t, c, res)
+	checkMemory(t, c, res)
+
+	if !c.HasSection(SectionExpect) && !c.HasSection(SectionMemory) && !c.HasSection(SectionError) {
+		t.Skip("no sections found")
+	}
+
+	return
+}
+
+// RunFiles runs every .fxt file matching pattern as a subtest named after the file.
+func RunFiles(t *testing.T, pattern string, cfg *Config) {
+	t.Helper()
+
+	filenames, err := filepath.Glob(pattern)
+
+	require.NoError(t, err)
+	require.NotEmpty(t, filenames, "no test cases match '%s'", pattern)
+
+	slices.Sort(filenames)
+
+	for _, filename := range filenames {
+		t.Run(strings.TrimSuffix(path.Base(filename), "."+Extension), func(t *testing.T) {
+			c, err := ReadFile(filename)
+
+			require.NoError(t, err)
+
+			Run(t, c, cfg)
+		})
+	}
+}
+
+func (c *Case) at(section string, line *Line) string {
+	return fmt.Sprintf("at %s line %s:%d", section, c.Filename, line.Number)
+}
+
+// errorText renders an error like the lines of the ERROR section.
+func errorText(d *fx.Diagnostic) string {
+	if d.Line == 0 {
+		return d.Message
+	}
+
+	return (&fx.SourceInfo{Filename: d.Filename, Line: d.Line, Column: d.Column}).Position() + ": " + d.Message
+}
+
+func checkErrors(t testing.TB, c *Case, res *Result) {
+	t.Helper()
+
+	actual := make([]string, 0, len(res.Errors))
+
+	for _, d := range fx.Diagnostics(res.Errors, nil) {
+		actual = append(actual, errorText(d))
+	}
+
+	if !c.HasSection(SectionError) {
+		if len(actual) > 0 {
+			t.Fatalf("%s: unexpected errors:\n%s", c.Filename, strings.Join(actual, "\n"))
+		}
+
+		return
+	}
+
+	expected := make([]string, 0, len(c.Errors))
+
+	for _, line := range c.Errors {
+		expected = append(expected, line.Text)
+	}
+
+	require.Equal(t, expected, actual, "errors of %s do not match", c.Filename)
+}
+
+func checkExpect(t testing.TB, c *Case, res *Result) {
+	t.Helper()
+
+	for i, line := range c.Expect {
+		at := c.at(SectionExpect, line)
+
+		if i >= len(res.Values) {
+			t.Fatalf("unexpected end of results %s", at)
+		}
+
+		value := res.Values[i]
+
+		switch {
+		case strings.HasPrefix(line.Text, `"`):
+			require.IsType(t, "", value, "result expected to be a string %s", at)
+
+			expected, err := strconv.Unquote(line.Text)
+
+			require.NoError(t, err, "unable to parse string %s", at)
+			require.EqualValues(t, expected, value, "value mismatch %s", at)
+		case strings.Contains(line.Text, "."):
+			require.Equal(t, reflect.Float64, reflect.ValueOf(value).Kind(), "result expected to be a float64 %s", at)
+
+			expected, err := strconv.ParseFloat(line.Text, 64)
+
+			require.NoError(t, err, "unable to parse float64 %s", at)
+			require.EqualValues(t, expected, value, "value mismatch %s", at)
+		default:
+			require.Equal(t, reflect.Int, reflect.ValueOf(value).Kind(), "result expected to be an int %s", at)
+
+			expected, err := strconv.ParseInt(line.Text, 10, 64)
+
+			require.NoError(t, err, "unable to parse int %s", at)
+			require.EqualValues(t, int(expected), value, "value mismatch %s", at)
+		}
+	}
+
+	if c.HasSection(SectionExpect) && len(res.Values) > len(c.Expect) {
+		t.Fatalf("%s: not all results were checked: missing %d EXPECT line(s)", c.Filename, len(res.Values)-len(c.Expect))
+	}
+}
+
+// address resolves a var, an element like `grid[1][2]` or `e.field`, or an identifier, the same way
+// as the script does.
+func address(res *Result, name string) (identifier fx.Identifier, ok bool) {
+	expr, err := res.parser.FeedExpression(res.Script, []byte(name), SectionMemory)
+
+	if err != nil {
+		return
+	}
+
+	switch n := expr.(type) {
+	case *fx.IdentifierNode:
+		return n.Identifier, true
+	case *fx.ArrayAccessNode:
+		addr, err := res.Script.EvalArrayAccessAddress(n, func(identifier fx.Identifier) any {
+			return res.Memory[identifier]
+		})
+
+		return fx.Identifier(addr), err == nil
+	}
+
+	return
+}
+
+func checkMemory(t testing.TB, c *Case, res *Result) {
+	t.Helper()
+
+	for _, line := range c.Memory {
+		at := c.at(SectionMemory, line)
+
+		name, valueText, ok := strings.Cut(line.Text, "=")
+
+		if !ok {
+			t.Fatalf("expected 'name = value' %s", at)
+		}
+
+		name = strings.TrimSpace(name)
+
+		identifier, ok := address(res, name)
+
+		if !ok {
+			t.Fatalf("unknown var or identifier '%s' %s", name, at)
+		}
+
+		expected, err := strconv.Atoi(strings.TrimSpace(valueText))
+
+		require.NoError(t, err, "unable to parse int %s", at)
+		require.Equal(t, expected, res.Memory[identifier], "value of '%s' mismatch %s", name, at)
+	}
+}
@@ -0,0 +1,212 @@
+package fxtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse("main.fxt", []byte(`eval 1
+--- EXPECT ---
+# comment
+1
+--- FILE lib/a.fx ---
+set A, 2
+--- MEMORY ---
+A = 2
+`))
+
+	require.NoError(t, err)
+	require.Equal(t, "eval 1\n", string(c.Script))
+	require.Equal(t, []*Line{{4, "1"}}, c.Expect)
+	require.Equal(t, []*Line{{8, "A = 2"}}, c.Memory)
+	require.Equal(t, map[string][]byte{"lib/a.fx": []byte("set A, 2\n")}, c.Files)
+	require.True(t, c.HasSection(SectionExpect))
+	require.False(t, c.HasSection(SectionError))
+
+	_, err = Parse("main.fxt", []byte("nop\n--- UNKNOWN ---\n"))
+
+	require.EqualError(t, err, "main.fxt:2: invalid section header '--- UNKNOWN ---'")
+}
+
+func TestRun(t *testing.T) {
+	c, err := Parse("main.fxt", []byte(`@include lib/inc.fx
+
+var list[3]
+
+set list[2], 7
+double A
+eval A, 1.5, "ok"
+--- EXPECT ---
+10
+1.5
+"ok"
+--- MEMORY ---
+A = 10
+list[2] = 7
+list[1] = 0
+--- FILE lib/inc.fx ---
+set A, 5
+`))
+
+	require.NoError(t, err)
+
+	res := Run(t, c, &Config{
+		Commands: []*vm.Command{
+			{Name: "double", Type: EvalCommandType + 1, Handler: func(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
+				identifier := args[0].(*fx.IdentifierNode).Identifier
+				f.Set(identifier, f.Get(identifier)*2)
+				return
+			}},
+		},
+		Identifiers: fx.IdentifierTable{"A": 1},
+	})
+
+	require.Equal(t, []any{10, 1.5, "ok"}, res.Values)
+}
+
+func TestRun_Errors(t *testing.T) {
+	c, err := Parse("main.fxt", []byte(`nop
+  goto nowhere
+--- ERROR ---
+main.fxt:2:8: unknown label: 'nowhere'
+`))
+
+	require.NoError(t, err)
+
+	res := Run(t, c, nil)
+
+	require.Nil(t, res.Script)
+	require.Len(t, res.Errors, 1)
+
+	c, err = Parse("main.fxt", []byte(`nop
+fail 3
+--- ERROR ---
+main.fxt:2:6: failed with 3
+`))
+
+	require.NoError(t, err)
+
+	Run(t, c, &Config{
+		Commands: []*vm.Command{
+			{Name: "fail", Type: EvalCommandType + 1, Handler: func(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
+				v, _ := f.Eval(args[0])
+				f.HandleError(&fx.RuntimeError{SourceInfo: args[0].(*fx.IntegerNode).SourceInfo, Err: fmt.Errorf("failed with %v", v)})
+				return
+			}},
+		},
+	})
+}
+
+func TestRun_ShapedMemory(t *testing.T) {
+	c, err := Parse("main.fxt", []byte(`struct Enemy
+  hp
+  pos[2]
+endstruct
+
+var grid[3][4]
+var boss: Enemy
+var enemies: Enemy[2]
+
+set grid[1][2], 5
+set boss.pos[1], 7
+set enemies[1].hp, 9
+--- MEMORY ---
+grid[1][2] = 5
+grid[2][1] = 0
+boss.pos[1] = 7
+enemies[1].hp = 9
+enemies[0].hp = 0
+`))
+
+	require.NoError(t, err)
+
+	res := Run(t, c, nil)
+
+	grid := res.Script.Variables()["grid"]
+
+	require.Equal(t, 5, res.Memory[fx.Identifier(grid+1*4+2)])
+
+	for _, name := range []string{"grid[3][0]", "grid[0][4]", "boss.pos[2]", "boss.speed", "unknown"} {
+		_, ok := address(res, name)
+
+		require.False(t, ok, name)
+	}
+}
+
+func TestConfig_CommandTypes(t *testing.T) {
+	handler := func(*vm.Frame, []fx.ExpressionNode) (jumpTarget int, jump bool) { return }
+
+	rtCfg, err := (&Config{Commands: []*vm.Command{
+		{Name: "b", Type: EvalCommandType + 5, Handler: handler},
+		{Name: "a", Type: EvalCommandType + 2, Handler: handler},
+	}}).runtimeConfig(&env{})
+
+	require.NoError(t, err)
+	require.Equal(t, EvalCommandType+5, rtCfg.UserCommands[1].Type)
+	require.Equal(t, EvalCommandType+2, rtCfg.UserCommands[2].Type)
+
+	_, err = (&Config{Commands: []*vm.Command{{Name: "a", Handler: handler}}}).runtimeConfig(&env{})
+
+	require.EqualError(t, err, fmt.Sprintf("type 0 of command 'a' must be greater than %d", EvalCommandType))
+
+	_, err = (&Config{Commands: []*vm.Command{
+		{Name: "a", Type: EvalCommandType + 1, Handler: handler},
+		{Name: "b", Type: EvalCommandType + 1, Handler: handler},
+	}}).runtimeConfig(&env{})
+
+	require.EqualError(t, err, fmt.Sprintf("commands 'a' and 'b' have the same type %d", EvalCommandType+1))
+}
+
+func TestRun_ReadOnlyCommand(t *testing.T) {
+	c, err := Parse("main.fxt", []byte(`data table
+  1, 2
+enddata
+var hp
+
+poke table
+poke hp
+eval table, hp
+--- EXPECT ---
+1
+99
+--- ERROR ---
+main.fxt:6:1: 'table' is read-only
+`))
+
+	require.NoError(t, err)
+
+	Run(t, c, &Config{
+		Commands: []*vm.Command{
+			{Name: "poke", Type: EvalCommandType + 1, Handler: func(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
+				f.Set(args[0].(*fx.IdentifierNode).Identifier, 99)
+				return
+			}},
+		},
+	})
+}
+
+func TestRun_PanicCommand(t *testing.T) {
+	c, err := Parse("main.fxt", []byte(`eval 1
+crash
+eval 2
+--- EXPECT ---
+1
+--- ERROR ---
+main.fxt:2:1: panic: boom
+`))
+
+	require.NoError(t, err)
+
+	Run(t, c, &Config{
+		Commands: []*vm.Command{
+			{Name: "crash", Type: EvalCommandType + 1, Handler: func(*vm.Frame, []fx.ExpressionNode) (jumpTarget int, jump bool) {
+				panic("boom")
+			}},
+		},
+	})
+}
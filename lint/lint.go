@@ -0,0 +1,351 @@
+package lint
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/fx/ast"
+)
+
+// Code identifies a check. Codes are stable and can be used to disable checks.
+type Code string
+
+const (
+	CodeUnusedLabel    Code = "FX001"
+	CodeUnreachable    Code = "FX002"
+	CodeUnreadVariable Code = "FX003"
+	CodeUnusedMacro    Code = "FX004"
+	CodeUnusedDefine   Code = "FX005"
+	CodeMissingRet     Code = "FX006"
+)
+
+// Finding is a problem reported by a check. It implements fx.SourceError, so it can be rendered
+// with fx.NewDiagnostic.
+type Finding struct {
+	*fx.SourceInfo
+	Code    Code
+	Message string
+}
+
+func (f *Finding) Error() string {
+	return fmt.Sprintf("%s: %s", f.Code, f.Message)
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.SourceInfo, f.Error())
+}
+
+type Config struct {
+	// Exported are labels and defs used by the host, e.g. labels started with Runtime.Call.
+	// They are never reported as unused.
+	Exported []string
+
+	// Terminators are user commands that never continue with the next command, like exit.
+	Terminators []fx.CommandType
+
+	// Disabled checks are not run.
+	Disabled []Code
+}
+
+type linter struct {
+	script *fx.Script
+	cfg    *Config
+
+	findings []*Finding
+	reported map[string]bool
+}
+
+// Lint runs all enabled checks on a parsed script. Findings are sorted by position.
+func Lint(script *fx.Script, cfg *Config) []*Finding {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	l := &linter{
+		script: script,
+		cfg:    cfg,
+
+		reported: make(map[string]bool),
+	}
+
+	checks := []struct {
+		code Code
+		fn   func()
+	}{
+		{CodeUnusedLabel, func() { l.checkUnused(fx.SymbolLabel, CodeUnusedLabel) }},
+		{CodeUnreachable, l.checkUnreachable},
+		{CodeUnreadVariable, l.checkUnreadVariables},
+		{CodeUnusedMacro, func() { l.checkUnused(fx.SymbolMacro, CodeUnusedMacro) }},
+		{CodeUnusedDefine, func() { l.checkUnused(fx.SymbolDefine, CodeUnusedDefine) }},
+		{CodeMissingRet, l.checkMissingRet},
+	}
+
+	for _, check := range checks {
+		if !slices.Contains(cfg.Disabled, check.code) {
+			check.fn()
+		}
+	}
+
+	slices.SortStableFunc(l.findings, func(a, b *Finding) int {
+		return cmp.Or(
+			cmp.Compare(a.Filename, b.Filename),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Column, b.Column),
+			cmp.Compare(a.Code, b.Code),
+		)
+	})
+
+	return l.findings
+}
+
+// report adds a finding. Code expanded from macros is reported once per source position.
+func (l *linter) report(sourceInfo *fx.SourceInfo, code Code, format string, args ...any) {
+	if sourceInfo == nil {
+		sourceInfo = &fx.SourceInfo{}
+	}
+
+	key := string(code) + " " + sourceInfo.Position()
+
+	if l.reported[key] {
+		return
+	}
+
+	l.reported[key] = true
+
+	l.findings = append(l.findings, &Finding{sourceInfo, code, fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) referenced(kind fx.SymbolKind) map[string]bool {
+	names := make(map[string]bool)
+
+	for _, ref := range l.script.References() {
+		if ref.Kind == kind {
+			names[ref.Name] = true
+		}
+	}
+
+	for _, name := range l.cfg.Exported {
+		names[name] = true
+	}
+
+	return names
+}
+
+// declarations returns the declarations of a kind, once per name.
+func (l *linter) declarations(kind fx.SymbolKind) (decls []*fx.Declaration) {
+	seen := make(map[string]bool)
+
+	for _, decl := range l.script.Declarations() {
+		if decl.Kind == kind && !seen[decl.Name] {
+			seen[decl.Name] = true
+			decls = append(decls, decl)
+		}
+	}
+
+	return
+}
+
+// checkUnused reports declarations of a kind that are never referenced, e.g. labels that are never
+// jumped to.
+func (l *linter) checkUnused(kind fx.SymbolKind, code Code) {
+	referenced := l.referenced(kind)
+
+	verb := "used"
+
+	if kind == fx.SymbolLabel {
+		verb = "referenced"
+	}
+
+	for _, decl := range l.declarations(kind) {
+		if !referenced[decl.Name] {
+			l.report(decl.SourceInfo, code, "%s '%s' is never %s", kind, decl.Name, verb)
+		}
+	}
+}
+
+func (l *linter) terminates(cmd *fx.CommandNode) bool {
+	switch cmd.Type {
+	case fx.CmdGoto, fx.CmdExit, fx.CmdRet:
+		return true
+	}
+
+	return slices.Contains(l.cfg.Terminators, cmd.Type)
+}
+
+func (l *linter) labelPCs() map[int]bool {
+	pcs := make(map[int]bool)
+
+	for _, pc := range l.script.Labels() {
+		pcs[pc] = true
+	}
+
+	return pcs
+}
+
+func (l *linter) checkUnreachable() {
+	labels := l.labelPCs()
+	commands := l.script.Commands()
+
+	for pc := 1; pc < len(commands); pc++ {
+		prev := commands[pc-1]
+
+		if l.terminates(prev) && !labels[pc] {
+			l.report(commands[pc].SourceInfo, CodeUnreachable, "unreachable code after '%s'", commandName(prev.Type))
+
+			// only report the first command of unreachable code
+			for pc+1 < len(commands) && !labels[pc+1] {
+				pc++
+			}
+		}
+	}
+}
+
+func commandName(typ fx.CommandType) string {
+	switch typ {
+	case fx.CmdGoto:
+		return "goto"
+	case fx.CmdExit:
+		return "exit"
+	case fx.CmdRet:
+		return "ret"
+	}
+
+	return fmt.Sprintf("command %d", typ)
+}
+
+func (l *linter) checkUnreadVariables() {
+	read := make(map[fx.Identifier]bool)
+	written := make(map[fx.Identifier]bool)
+
+	walk := func(expr fx.ExpressionNode) {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *fx.IdentifierNode:
+				read[n.Identifier] = true
+			case *fx.ArrayAccessNode:
+				read[n.Variable] = true
+			}
+
+			return true
+		})
+	}
+
+	for _, cmd := range l.script.Commands() {
+		args := cmd.Args
+
+		if (cmd.Type == fx.CmdSet || cmd.Type == fx.CmdPop) && len(args) > 0 {
+			switch target := args[0].(type) {
+			case *fx.IdentifierNode:
+				written[target.Identifier] = true
+				args = args[1:]
+			case *fx.ArrayAccessNode:
+				written[target.Variable] = true
+				walk(target.Index)
+				args = args[1:]
+			}
+		}
+
+		for _, arg := range args {
+			walk(arg)
+		}
+	}
+
+	variables := l.script.Variables()
+
+	for _, decl := range l.declarations(fx.SymbolVariable) {
+		addr := fx.Identifier(variables[decl.Name])
+
+		if written[addr] && !read[addr] {
+			l.report(decl.SourceInfo, CodeUnreadVariable, "var '%s' is written but never read", decl.Name)
+		}
+	}
+}
+
+// reachesEnd follows the control flow from pc and reports whether it can run past the last
+// command without returning. Dynamic jump targets are not followed.
+func (l *linter) reachesEnd(pc int) bool {
+	commands := l.script.Commands()
+	visited := make(map[int]bool)
+	pending := []int{pc}
+
+	for len(pending) > 0 {
+		pc, pending = pending[len(pending)-1], pending[:len(pending)-1]
+
+		for !visited[pc] {
+			if pc < 0 || pc >= len(commands) {
+				return true
+			}
+
+			visited[pc] = true
+			cmd := commands[pc]
+
+			if cmd.Type == fx.CmdJumpIf && len(cmd.Args) > 1 {
+				if target, ok := cmd.Args[1].(*fx.AddressNode); ok {
+					pending = append(pending, target.Address)
+				}
+			}
+
+			if cmd.Type == fx.CmdGoto && len(cmd.Args) > 0 {
+				if target, ok := cmd.Args[0].(*fx.AddressNode); ok {
+					pc = target.Address
+					continue
+				}
+			}
+
+			if l.terminates(cmd) {
+				break
+			}
+
+			pc++
+		}
+	}
+
+	return false
+}
+
+func (l *linter) checkMissingRet() {
+	labels := make(map[int]string)
+
+	for name, pc := range l.script.Labels() {
+		if prev, ok := labels[pc]; !ok || name < prev {
+			labels[pc] = name
+		}
+	}
+
+	checked := make(map[int]bool)
+
+	for _, cmd := range l.script.Commands() {
+		if cmd.Type != fx.CmdCall || len(cmd.Args) == 0 {
+			continue
+		}
+
+		target, ok := cmd.Args[0].(*fx.AddressNode)
+
+		if !ok || checked[target.Address] {
+			continue
+		}
+
+		checked[target.Address] = true
+
+		if !l.reachesEnd(target.Address) {
+			continue
+		}
+
+		name, ok := labels[target.Address]
+
+		if !ok {
+			l.report(cmd.SourceInfo, CodeMissingRet, "call target can reach the end of the script without 'ret'")
+			continue
+		}
+
+		sourceInfo := cmd.SourceInfo
+
+		if decl, ok := l.script.Declaration(fx.SymbolLabel, name); ok {
+			sourceInfo = decl.SourceInfo
+		}
+
+		l.report(sourceInfo, CodeMissingRet, "call target '%s' can reach the end of the script without 'ret'", name)
+	}
+}
@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/stretchr/testify/require"
+)
+
+func loadScript(t *testing.T, src string) *fx.Script {
+	t.Helper()
+
+	cfg := &fx.ParserConfig{
+		CommandTypes: fx.CommandTypeTable{
+			"set":    fx.CmdSet,
+			"goto":   fx.CmdGoto,
+			"call":   fx.CmdCall,
+			"ret":    fx.CmdRet,
+			"exit":   fx.CmdExit,
+			"jumpIf": fx.CmdJumpIf,
+			"pop":    fx.CmdPop,
+		},
+		Identifiers: fx.IdentifierTable{"A": 1},
+	}
+
+	script, err := fx.LoadScript([]byte(src), "test.fx", cfg)
+
+	require.NoError(t, err)
+
+	return script
+}
+
+type result struct {
+	Code Code
+	Line int
+}
+
+func results(findings []*Finding) (r []result) {
+	for _, f := range findings {
+		r = append(r, result{f.Code, f.Line})
+	}
+
+	return
+}
+
+func TestLint(t *testing.T) {
+	src := `var used
+var unread
+def USED 1
+def UNUSED 2
+
+macro usedMacro
+  set A, USED
+endmacro
+
+macro unusedMacro
+  ret
+endmacro
+
+usedMacro
+set unread, 1
+set used, 2
+set A, used
+call sub
+call leaky
+goto end
+set A, 3
+
+unusedLabel:
+  set A, 4
+
+sub:
+  jumpIf A, %_done
+  set A, 5
+%_done:
+  ret
+  set A, 6
+
+end:
+  exit
+  set A, 8
+
+leaky:
+  set A, 7
+  jumpIf A, sub
+`
+
+	findings := Lint(loadScript(t, src), nil)
+
+	require.Equal(t, []result{
+		{CodeUnreadVariable, 2},
+		{CodeUnusedDefine, 4},
+		{CodeUnusedMacro, 10},
+		{CodeUnreachable, 21},
+		{CodeUnusedLabel, 23},
+		{CodeUnreachable, 31},
+		{CodeUnreachable, 35},
+		{CodeMissingRet, 37},
+	}, results(findings))
+
+	require.Equal(t, "test.fx:23:1: FX001: label 'unusedLabel' is never referenced", findings[4].String())
+}
+
+func TestLint_Config(t *testing.T) {
+	src := `entry:
+  set A, 1
+  exit
+  set A, 2
+`
+
+	script := loadScript(t, src)
+
+	require.Equal(t, []result{{CodeUnusedLabel, 1}, {CodeUnreachable, 4}}, results(Lint(script, nil)))
+	require.Equal(t, []result{{CodeUnreachable, 4}}, results(Lint(script, &Config{Exported: []string{"entry"}})))
+	require.Empty(t, Lint(script, &Config{Exported: []string{"entry"}, Disabled: []Code{CodeUnreachable}}))
+}
@@ -0,0 +1,139 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// conn reads and writes JSON-RPC messages with LSP base protocol headers.
+type conn struct {
+	r *textproto.Reader
+	w io.Writer
+
+	mu sync.Mutex
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{
+		r: textproto.NewReader(bufio.NewReader(r)),
+		w: w,
+	}
+}
+
+func (c *conn) read() (msg *message, err error) {
+	var header textproto.MIMEHeader
+
+	if header, err = c.r.ReadMIMEHeader(); err != nil {
+		return
+	}
+
+	var length int
+
+	if length, err = strconv.Atoi(strings.TrimSpace(header.Get("Content-Length"))); err != nil {
+		err = fmt.Errorf("invalid Content-Length: %w", err)
+		return
+	}
+
+	body := make([]byte, length)
+
+	if _, err = io.ReadFull(c.r.R, body); err != nil {
+		return
+	}
+
+	msg = &message{}
+
+	if err = json.Unmarshal(body, msg); err != nil {
+		err = &responseError{codeParseError, err.Error()}
+	}
+
+	return
+}
+
+func (c *conn) write(msg *message) (err error) {
+	msg.JSONRPC = "2.0"
+
+	var body []byte
+
+	if body, err = json.Marshal(msg); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return
+	}
+
+	_, err = c.w.Write(body)
+
+	return
+}
+
+// reply answers the request with the given id. A nil id answers a message that could not be
+// parsed, which JSON-RPC replies to with a null id.
+func (c *conn) reply(id *json.RawMessage, result any, err error) error {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+
+	msg := &message{ID: id}
+
+	if err != nil {
+		respErr, ok := err.(*responseError)
+
+		if !ok {
+			respErr = &responseError{codeInvalidParams, err.Error()}
+		}
+
+		msg.Error = respErr
+	} else if result == nil {
+		msg.Result = json.RawMessage("null")
+	} else {
+		msg.Result = result
+	}
+
+	return c.write(msg)
+}
+
+func (c *conn) notify(method string, params any) (err error) {
+	var raw []byte
+
+	if raw, err = json.Marshal(params); err != nil {
+		return
+	}
+
+	return c.write(&message{Method: method, Params: raw})
+}
@@ -0,0 +1,561 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/nitwhiz/fxscript/fx"
+)
+
+// Server is a language server for fx scripts, speaking LSP over a single connection.
+type Server struct {
+	cfg  *fx.ParserConfig
+	root fs.FS
+
+	conn *conn
+	docs map[string]*document
+
+	// published tracks which URIs received diagnostics for which document
+	published map[string][]string
+
+	shutdown bool
+}
+
+type document struct {
+	uri   string
+	path  string
+	lines []string
+
+	script *fx.Script
+}
+
+// NewServer creates a server that parses documents with the commands, identifiers and symbols of cfg.
+// root is the file system the document URIs are resolved against, usually os.DirFS("/").
+func NewServer(cfg *fx.ParserConfig, root fs.FS) *Server {
+	return &Server{
+		cfg:  cfg,
+		root: root,
+
+		docs:      make(map[string]*document),
+		published: make(map[string][]string),
+	}
+}
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported uri scheme: %s", u.Scheme)
+	}
+
+	return strings.TrimPrefix(u.Path, "/"), nil
+}
+
+func pathToURI(p string) string {
+	return (&url.URL{Scheme: "file", Path: "/" + p}).String()
+}
+
+// Run serves requests read from r until the client sends "exit" or r is closed.
+func (s *Server) Run(r io.Reader, w io.Writer) (err error) {
+	s.conn = newConn(r, w)
+
+	for {
+		var msg *message
+
+		if msg, err = s.conn.read(); err != nil {
+			var respErr *responseError
+
+			// the message was read completely, so the next one can still be served
+			if errors.As(err, &respErr) {
+				if err = s.conn.reply(nil, nil, respErr); err != nil {
+					return
+				}
+
+				continue
+			}
+
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+
+			return
+		}
+
+		if msg.Method == "exit" {
+			return
+		}
+
+		if err = s.handle(msg); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (err error) {
+	var result any
+	var reqErr error
+
+	// after shutdown, requests fail and notifications are dropped until exit
+	if s.shutdown {
+		if msg.ID == nil {
+			return
+		}
+
+		return s.conn.reply(msg.ID, nil, &responseError{codeInvalidRequest, "server is shut down"})
+	}
+
+	switch msg.Method {
+	case "initialize":
+		result = &InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:   1,
+				DefinitionProvider: true,
+				HoverProvider:      true,
+				CompletionProvider: map[string]any{},
+			},
+			ServerInfo: map[string]string{"name": "fxls"},
+		}
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+
+		if reqErr = json.Unmarshal(msg.Params, &params); reqErr == nil {
+			reqErr = s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+
+		if reqErr = json.Unmarshal(msg.Params, &params); reqErr == nil && len(params.ContentChanges) > 0 {
+			reqErr = s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+
+		if reqErr = json.Unmarshal(msg.Params, &params); reqErr == nil {
+			delete(s.docs, params.TextDocument.URI)
+		}
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+
+		if reqErr = json.Unmarshal(msg.Params, &params); reqErr == nil {
+			result = s.definition(params)
+		}
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+
+		if reqErr = json.Unmarshal(msg.Params, &params); reqErr == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+
+		if reqErr = json.Unmarshal(msg.Params, &params); reqErr == nil {
+			result = s.completion(params)
+		}
+	default:
+		reqErr = &responseError{codeMethodNotFound, "method not found: " + msg.Method}
+	}
+
+	if msg.ID == nil {
+		return
+	}
+
+	return s.conn.reply(msg.ID, result, reqErr)
+}
+
+func (s *Server) parse(doc *document, text string) (warnings fx.ErrorList, err error) {
+	cfg := *s.cfg
+	cfg.FS = fx.NewParserFS(s.root)
+	cfg.WarningFn = func(err error) {
+		warnings = append(warnings, err)
+	}
+
+	doc.script, err = fx.LoadScript([]byte(text), doc.path, &cfg)
+
+	return
+}
+
+func (s *Server) update(uri string, text string) (err error) {
+	var p string
+
+	if p, err = uriToPath(uri); err != nil {
+		return
+	}
+
+	doc := &document{
+		uri:   uri,
+		path:  p,
+		lines: strings.Split(text, "\n"),
+	}
+
+	s.docs[uri] = doc
+
+	warnings, parseErr := s.parse(doc, text)
+
+	return s.publishDiagnostics(doc, parseErr, warnings)
+}
+
+func (s *Server) publishDiagnostics(doc *document, parseErr error, warnings fx.ErrorList) (err error) {
+	byURI := make(map[string][]*Diagnostic)
+
+	for _, uri := range s.published[doc.uri] {
+		byURI[uri] = []*Diagnostic{}
+	}
+
+	byURI[doc.uri] = []*Diagnostic{}
+
+	diags := fx.Diagnostics(parseErr, nil)
+
+	for _, w := range warnings {
+		diags = append(diags, fx.NewDiagnostic(w, fx.SeverityWarning, nil))
+	}
+
+	for _, d := range diags {
+		uri := doc.uri
+
+		if d.Filename != "" && d.Filename != doc.path {
+			uri = pathToURI(d.Filename)
+		}
+
+		severity := SeverityError
+
+		if d.Severity == fx.SeverityWarning {
+			severity = SeverityWarning
+		}
+
+		byURI[uri] = append(byURI[uri], &Diagnostic{
+			Range:    s.wordRange(uri, d.Line, d.Column),
+			Severity: severity,
+			Source:   "fx",
+			Message:  d.Message,
+		})
+	}
+
+	s.published[doc.uri] = s.published[doc.uri][:0]
+
+	uris := make([]string, 0, len(byURI))
+
+	for uri := range byURI {
+		uris = append(uris, uri)
+	}
+
+	slices.Sort(uris)
+
+	for _, uri := range uris {
+		if len(byURI[uri]) > 0 {
+			s.published[doc.uri] = append(s.published[doc.uri], uri)
+		}
+
+		if err = s.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{uri, byURI[uri]}); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func isWordChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' || c == '.'
+}
+
+// sourceLine returns a line of a file, preferring the contents of open documents over the file system.
+func (s *Server) sourceLine(p string, line int) (string, bool) {
+	var lines []string
+
+	if doc, ok := s.docs[pathToURI(p)]; ok {
+		lines = doc.lines
+	} else if data, err := fs.ReadFile(s.root, p); err == nil {
+		lines = strings.Split(string(data), "\n")
+	}
+
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// word returns the 1-based column range [start, end) of the word at column col in line.
+func word(line string, col int) (start int, end int) {
+	i := col - 1
+
+	if i < 0 || i > len(line) {
+		return col, col
+	}
+
+	start, end = i, i
+
+	for start > 0 && isWordChar(line[start-1]) {
+		start--
+	}
+
+	for end < len(line) && isWordChar(line[end]) {
+		end++
+	}
+
+	return start + 1, end + 1
+}
+
+func (s *Server) wordRange(uri string, line int, col int) Range {
+	p, _ := uriToPath(uri)
+
+	start, end := col, col+1
+
+	if text, ok := s.sourceLine(p, line); ok {
+		if start, end = word(text, col); start == end {
+			end = start + 1
+		}
+	}
+
+	return Range{
+		Start: Position{Line: max(line-1, 0), Character: max(start-1, 0)},
+		End:   Position{Line: max(line-1, 0), Character: max(end-1, 0)},
+	}
+}
+
+func (s *Server) location(sourceInfo *fx.SourceInfo, docPath string) *Location {
+	p := sourceInfo.Filename
+
+	if p == "" {
+		p = docPath
+	}
+
+	uri := pathToURI(p)
+
+	return &Location{uri, s.wordRange(uri, sourceInfo.Line, sourceInfo.Column)}
+}
+
+type symbol struct {
+	kind fx.SymbolKind
+	name string
+
+	sourceInfo *fx.SourceInfo
+}
+
+func inWord(sourceInfo *fx.SourceInfo, p string, line int, start int, end int) bool {
+	return sourceInfo != nil && (sourceInfo.Filename == p || sourceInfo.Filename == "") &&
+		sourceInfo.Line == line && sourceInfo.Column >= start && sourceInfo.Column < end
+}
+
+// symbolAt finds the reference or declaration under the cursor.
+func (s *Server) symbolAt(doc *document, pos Position) (sym *symbol, ok bool) {
+	if doc.script == nil || pos.Line >= len(doc.lines) {
+		return
+	}
+
+	line := pos.Line + 1
+	start, end := word(doc.lines[pos.Line], pos.Character+1)
+
+	if start == end {
+		return
+	}
+
+	for _, ref := range doc.script.References() {
+		if inWord(ref.SourceInfo, doc.path, line, start, end) {
+			return &symbol{ref.Kind, ref.Name, ref.SourceInfo}, true
+		}
+	}
+
+	for _, decl := range doc.script.Declarations() {
+		if inWord(decl.SourceInfo, doc.path, line, start, end) {
+			return &symbol{decl.Kind, decl.Name, decl.SourceInfo}, true
+		}
+	}
+
+	return
+}
+
+func (s *Server) includeAt(doc *document, pos Position) (*Location, bool) {
+	if pos.Line >= len(doc.lines) {
+		return nil, false
+	}
+
+	directive, ok := strings.CutPrefix(strings.TrimSpace(doc.lines[pos.Line]), "@include")
+
+	if !ok {
+		return nil, false
+	}
+
+	if fields := strings.Fields(directive); len(fields) > 0 {
+		target := path.Join(path.Dir(doc.path), fields[0])
+
+		if _, err := fs.Stat(s.root, target); err == nil {
+			return &Location{URI: pathToURI(target)}, true
+		}
+	}
+
+	return nil, false
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) any {
+	doc, ok := s.docs[params.TextDocument.URI]
+
+	if !ok {
+		return nil
+	}
+
+	if loc, ok := s.includeAt(doc, params.Position); ok {
+		return loc
+	}
+
+	sym, ok := s.symbolAt(doc, params.Position)
+
+	if !ok {
+		return nil
+	}
+
+	decl, ok := doc.script.Declaration(sym.kind, sym.name)
+
+	if !ok {
+		return nil
+	}
+
+	return s.location(decl.SourceInfo, doc.path)
+}
+
+func (s *Server) describeValue(script *fx.Script, expr fx.ExpressionNode) (string, bool) {
+	unresolved := false
+
+	v, err := script.Eval(expr, func(fx.Identifier) any {
+		unresolved = true
+		return 0
+	})
+
+	if err != nil || unresolved {
+		return "", false
+	}
+
+	if str, ok := v.(string); ok {
+		return fmt.Sprintf("%q", str), true
+	}
+
+	return fmt.Sprintf("%v", v), true
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) any {
+	doc, ok := s.docs[params.TextDocument.URI]
+
+	if !ok {
+		return nil
+	}
+
+	sym, ok := s.symbolAt(doc, params.Position)
+
+	if !ok {
+		return nil
+	}
+
+	var contents []string
+
+	if decl, ok := doc.script.Declaration(sym.kind, sym.name); ok {
+		p := decl.Filename
+
+		if p == "" {
+			p = doc.path
+		}
+
+		if line, ok := s.sourceLine(p, decl.Line); ok {
+			contents = append(contents, "```fx\n"+strings.TrimSpace(line)+"\n```")
+		}
+	}
+
+	switch sym.kind {
+	case fx.SymbolDefine:
+		if expr, ok := doc.script.Defines()[sym.name]; ok {
+			if value, ok := s.describeValue(doc.script, expr); ok {
+				contents = append(contents, fmt.Sprintf("def `%s` = `%s`", sym.name, value))
+			}
+		}
+	case fx.SymbolVariable:
+		if addr, ok := doc.script.Variables()[sym.name]; ok {
+			contents = append(contents, fmt.Sprintf("var `%s` at address `%d` (`0x%x`)", sym.name, addr, addr))
+		}
+	case fx.SymbolIdentifier:
+		if addr, ok := s.cfg.Identifiers[sym.name]; ok {
+			contents = append(contents, fmt.Sprintf("identifier `%s` at address `%d` (`0x%x`)", sym.name, addr, int(addr)))
+		}
+	case fx.SymbolLabel:
+		if pc, ok := doc.script.Label(sym.name); ok {
+			contents = append(contents, fmt.Sprintf("label `%s` at pc `%d`", sym.name, pc))
+		}
+	case fx.SymbolMacro:
+		if m, ok := doc.script.Macro(sym.name); ok {
+			minArgs, maxArgs := m.ArgCount()
+
+			switch {
+			case maxArgs < 0:
+				contents = append(contents, fmt.Sprintf("macro `%s`, at least %d argument(s)", sym.name, minArgs))
+			case minArgs == maxArgs:
+				contents = append(contents, fmt.Sprintf("macro `%s`, %d argument(s)", sym.name, minArgs))
+			default:
+				contents = append(contents, fmt.Sprintf("macro `%s`, %d to %d arguments", sym.name, minArgs, maxArgs))
+			}
+		}
+	}
+
+	if len(contents) == 0 {
+		return nil
+	}
+
+	r := s.wordRange(doc.uri, sym.sourceInfo.Line, sym.sourceInfo.Column)
+
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: strings.Join(contents, "\n\n")},
+		Range:    &r,
+	}
+}
+
+var keywords = []string{"var", "def", "macro", "endmacro", "import", "export", "namespace", "endnamespace", "using", "struct", "endstruct", "data", "enddata"}
+
+func (s *Server) completion(params TextDocumentPositionParams) any {
+	items := make([]*CompletionItem, 0)
+
+	for _, kw := range keywords {
+		items = append(items, &CompletionItem{Label: kw, Kind: CompletionKindKeyword})
+	}
+
+	for name := range s.cfg.CommandTypes {
+		items = append(items, &CompletionItem{Label: name, Kind: CompletionKindFunction, Detail: "command"})
+	}
+
+	for name := range s.cfg.Identifiers {
+		items = append(items, &CompletionItem{Label: name, Kind: CompletionKindVariable, Detail: "identifier"})
+	}
+
+	if doc, ok := s.docs[params.TextDocument.URI]; ok && doc.script != nil {
+		for name := range doc.script.Macros() {
+			items = append(items, &CompletionItem{Label: name, Kind: CompletionKindFunction, Detail: "macro"})
+		}
+
+		for name := range doc.script.Defines() {
+			items = append(items, &CompletionItem{Label: name, Kind: CompletionKindConstant, Detail: "def"})
+		}
+
+		for name := range doc.script.Variables() {
+			items = append(items, &CompletionItem{Label: name, Kind: CompletionKindVariable, Detail: "var"})
+		}
+
+		for name := range doc.script.Labels() {
+			items = append(items, &CompletionItem{Label: name, Kind: CompletionKindReference, Detail: "label"})
+		}
+	}
+
+	slices.SortFunc(items, func(a, b *CompletionItem) int {
+		return strings.Compare(a.Label, b.Label)
+	})
+
+	return &CompletionList{Items: items}
+}
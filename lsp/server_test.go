@@ -0,0 +1,183 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/stretchr/testify/require"
+)
+
+type session struct {
+	in bytes.Buffer
+	id int
+}
+
+func (s *session) send(method string, params any) {
+	s.id++
+
+	body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": s.id, "method": method, "params": params})
+
+	_, _ = fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *session) notify(method string, params any) {
+	body, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+
+	_, _ = fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func runSession(t *testing.T, root fstest.MapFS, s *session) (responses map[int]json.RawMessage, diagnostics []*PublishDiagnosticsParams) {
+	t.Helper()
+
+	cfg := &fx.ParserConfig{
+		CommandTypes: fx.CommandTypeTable{"set": fx.CmdSet, "goto": fx.CmdGoto, "call": fx.CmdCall, "ret": fx.CmdRet},
+		Identifiers:  fx.IdentifierTable{"hp": 7},
+	}
+
+	var out bytes.Buffer
+
+	require.NoError(t, NewServer(cfg, root).Run(&s.in, &out))
+
+	c := newConn(&out, nil)
+	responses = make(map[int]json.RawMessage)
+
+	for {
+		msg, err := c.read()
+
+		if err != nil {
+			break
+		}
+
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params PublishDiagnosticsParams
+
+			require.NoError(t, json.Unmarshal(msg.Params, &params))
+
+			diagnostics = append(diagnostics, &params)
+			continue
+		}
+
+		// replies to unparsable messages have a null id
+		var id int
+
+		if msg.ID != nil {
+			require.NoError(t, json.Unmarshal(*msg.ID, &id))
+		}
+
+		raw, _ := json.Marshal(msg.Result)
+
+		if msg.Error != nil {
+			raw, _ = json.Marshal(msg.Error)
+		}
+
+		responses[id] = raw
+	}
+
+	return
+}
+
+func TestServer(t *testing.T) {
+	src := "def LIMIT 4 * 2\nvar counter\n\nloop:\n  set counter, LIMIT\n  goto loop\n  set hp, 1\n"
+
+	root := fstest.MapFS{"game/main.fx": {Data: []byte(src)}}
+
+	s := &session{}
+	uri := "file:///game/main.fx"
+
+	s.send("initialize", map[string]any{})
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "text": src}})
+	s.send("textDocument/definition", TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{5, 8}})
+	s.send("textDocument/hover", TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{4, 17}})
+	s.send("textDocument/hover", TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{6, 7}})
+	s.send("textDocument/completion", TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{6, 0}})
+	s.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri},
+		"contentChanges": []map[string]any{{"text": "var counter\nset counter, 1\ngoto missing\n"}},
+	})
+	s.send("shutdown", nil)
+	s.notify("exit", nil)
+
+	responses, diagnostics := runSession(t, root, s)
+
+	var loc Location
+
+	require.NoError(t, json.Unmarshal(responses[2], &loc))
+	require.Equal(t, Location{uri, Range{Position{3, 0}, Position{3, 4}}}, loc)
+
+	var hover Hover
+
+	require.NoError(t, json.Unmarshal(responses[3], &hover))
+	require.Contains(t, hover.Contents.Value, "def LIMIT 4 * 2")
+	require.Contains(t, hover.Contents.Value, "def `LIMIT` = `8`")
+
+	require.NoError(t, json.Unmarshal(responses[4], &hover))
+	require.Contains(t, hover.Contents.Value, "identifier `hp` at address `7`")
+
+	var completion CompletionList
+
+	require.NoError(t, json.Unmarshal(responses[5], &completion))
+
+	labels := make([]string, 0, len(completion.Items))
+
+	for _, item := range completion.Items {
+		labels = append(labels, item.Label)
+	}
+
+	require.Subset(t, labels, []string{"LIMIT", "counter", "goto", "hp", "loop", "macro", "set"})
+
+	require.Len(t, diagnostics, 2)
+	require.Empty(t, diagnostics[0].Diagnostics)
+	require.Len(t, diagnostics[1].Diagnostics, 1)
+	require.Equal(t, 2, diagnostics[1].Diagnostics[0].Range.Start.Line)
+	require.Contains(t, diagnostics[1].Diagnostics[0].Message, "missing")
+}
+
+func TestServer_IncludeDefinition(t *testing.T) {
+	main := "@include lib/util.fx\ncall helper\n"
+
+	root := fstest.MapFS{
+		"game/main.fx":     {Data: []byte(main)},
+		"game/lib/util.fx": {Data: []byte("\nhelper:\n  ret\n")},
+	}
+
+	s := &session{}
+	uri := "file:///game/main.fx"
+
+	s.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "text": main}})
+	s.send("textDocument/definition", TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{0, 12}})
+	s.send("textDocument/definition", TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{1, 7}})
+	s.notify("exit", nil)
+
+	responses, _ := runSession(t, root, s)
+
+	var loc Location
+
+	require.NoError(t, json.Unmarshal(responses[1], &loc))
+	require.Equal(t, "file:///game/lib/util.fx", loc.URI)
+
+	require.NoError(t, json.Unmarshal(responses[2], &loc))
+	require.Equal(t, Location{"file:///game/lib/util.fx", Range{Position{1, 0}, Position{1, 6}}}, loc)
+}
+
+func TestServer_Errors(t *testing.T) {
+	s := &session{}
+	uri := "file:///game/main.fx"
+
+	_, _ = fmt.Fprintf(&s.in, "Content-Length: %d\r\n\r\n%s", 5, "{oops")
+
+	s.send("initialize", map[string]any{})
+	s.send("shutdown", nil)
+	s.send("textDocument/hover", TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{0, 0}})
+	s.notify("exit", nil)
+
+	responses, _ := runSession(t, fstest.MapFS{}, s)
+
+	require.Contains(t, string(responses[0]), `"code":-32700`)
+	require.Contains(t, string(responses[1]), `"capabilities"`)
+	require.Equal(t, "null", string(responses[2]))
+	require.JSONEq(t, `{"code":-32600,"message":"server is shut down"}`, string(responses[3]))
+}
@@ -0,0 +1,116 @@
+package plugins
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/vm"
+)
+
+// Plugin is a named set of user commands. Command types are assigned when the plugins are
+// combined into a runtime config, so plugins don't need to coordinate them.
+type Plugin struct {
+	Name     string
+	Commands []*vm.Command
+}
+
+type DuplicatePluginError struct {
+	Name string
+}
+
+func (e *DuplicatePluginError) Error() string {
+	return fmt.Sprintf("plugin '%s' is already registered", e.Name)
+}
+
+type UnknownPluginError struct {
+	Name string
+}
+
+func (e *UnknownPluginError) Error() string {
+	return fmt.Sprintf("unknown plugin '%s'", e.Name)
+}
+
+type DuplicateCommandError struct {
+	Command string
+	Plugins []string
+}
+
+func (e *DuplicateCommandError) Error() string {
+	return fmt.Sprintf("command '%s' is provided by plugins '%s' and '%s'", e.Command, e.Plugins[0], e.Plugins[1])
+}
+
+var (
+	mu       sync.Mutex
+	registry = make(map[string]*Plugin)
+)
+
+// Register adds a plugin to the registry. It is meant to be called from init functions.
+func Register(p *Plugin) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := registry[p.Name]; ok {
+		panic(&DuplicatePluginError{p.Name})
+	}
+
+	registry[p.Name] = p
+}
+
+func Lookup(name string) (p *Plugin, ok bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	p, ok = registry[name]
+	return
+}
+
+// Names returns the names of all registered plugins, sorted.
+func Names() (names []string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return
+}
+
+// Commands combines the commands of the named plugins and assigns their command types, starting
+// at fx.UserCommandOffset.
+func Commands(names ...string) (commands []*vm.Command, err error) {
+	provider := make(map[string]string)
+
+	for _, name := range names {
+		p, ok := Lookup(name)
+
+		if !ok {
+			return nil, &UnknownPluginError{name}
+		}
+
+		for _, cmd := range p.Commands {
+			if other, ok := provider[cmd.Name]; ok {
+				return nil, &DuplicateCommandError{cmd.Name, []string{other, p.Name}}
+			}
+
+			if slices.ContainsFunc(vm.BaseCommands, func(base *vm.Command) bool { return base.Name == cmd.Name }) {
+				return nil, &DuplicateCommandError{cmd.Name, []string{"base", p.Name}}
+			}
+
+			provider[cmd.Name] = p.Name
+
+			commands = append(commands, &vm.Command{
+				Name:    cmd.Name,
+				Type:    fx.UserCommandOffset + fx.CommandType(len(commands)),
+				Handler: cmd.Handler,
+			})
+		}
+	}
+
+	return
+}
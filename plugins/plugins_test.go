@@ -0,0 +1,50 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands(t *testing.T) {
+	Register(&Plugin{
+		Name: "test-sound",
+		Commands: []*vm.Command{
+			{Name: "playSound"},
+			{Name: "stopSound"},
+		},
+	})
+
+	Register(&Plugin{
+		Name:     "test-print",
+		Commands: []*vm.Command{{Name: "print"}},
+	})
+
+	commands, err := Commands("std", "test-sound")
+
+	require.NoError(t, err)
+	require.Len(t, commands, 4)
+
+	for i, cmd := range commands {
+		require.Equal(t, fx.UserCommandOffset+fx.CommandType(i), cmd.Type)
+	}
+
+	require.Equal(t, "playSound", commands[2].Name)
+
+	_, err = Commands("std", "test-print")
+
+	var duplicateErr *DuplicateCommandError
+
+	require.ErrorAs(t, err, &duplicateErr)
+	require.Equal(t, []string{"std", "test-print"}, duplicateErr.Plugins)
+
+	_, err = Commands("missing")
+
+	require.ErrorAs(t, err, new(*UnknownPluginError))
+
+	require.Panics(t, func() {
+		Register(&Plugin{Name: "std"})
+	})
+}
@@ -0,0 +1,66 @@
+package plugins
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/vm"
+)
+
+// Output is where the std plugin prints to.
+var Output io.Writer = os.Stdout
+
+type AssertionError struct {
+	Message string
+}
+
+func (e *AssertionError) Error() string {
+	return "assertion failed: " + e.Message
+}
+
+func handlePrint(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
+	values := make([]string, len(args))
+
+	for i, arg := range args {
+		v, err := f.Eval(arg)
+
+		if err != nil {
+			f.HandleError(err)
+			return
+		}
+
+		values[i] = fmt.Sprintf("%v", v)
+	}
+
+	_, _ = fmt.Fprintln(Output, strings.Join(values, " "))
+
+	return
+}
+
+func handleAssert(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
+	type Args struct {
+		Condition int    `arg:""`
+		Message   string `arg:"1,optional"`
+	}
+
+	return vm.WithArgs(f, args, func(f *vm.Frame, a *Args) (jumpTarget int, jump bool) {
+		if a.Condition == 0 {
+			f.HandleError(&fx.RuntimeError{SourceInfo: args[0].Source(), Err: &AssertionError{a.Message}})
+		}
+
+		return
+	})
+}
+
+func init() {
+	Register(&Plugin{
+		Name: "std",
+		Commands: []*vm.Command{
+			{Name: "print", Handler: handlePrint},
+			{Name: "assert", Handler: handleAssert},
+		},
+	})
+}
@@ -0,0 +1,332 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/vm"
+)
+
+const (
+	Prompt             = "fx> "
+	ContinuationPrompt = "... "
+
+	filename = "repl"
+)
+
+const help = `enter commands, def, var, labels and macros to run them, or an expression to print its value
+
+  :labels  list all labels with their pc
+  :vars    list all vars with their address and value
+  :mem     show all memory that was written
+  :stack   show the call and operand stack
+  :reset   start over with an empty script and memory
+  :help    show this help
+  :quit    leave the repl
+`
+
+// memory is the environment of the repl. Runtime errors are printed right away.
+type memory struct {
+	values map[fx.Identifier]int
+	out    io.Writer
+}
+
+func (m *memory) Get(identifier fx.Identifier) int {
+	return m.values[identifier]
+}
+
+func (m *memory) Set(identifier fx.Identifier, value int) {
+	m.values[identifier] = value
+}
+
+func (m *memory) HandleError(err error) {
+	_ = fx.RenderDiagnostics(m.out, err, nil)
+}
+
+// REPL parses input one line at a time into a single script and runs the new commands on a
+// persistent frame, so vars, labels, macros and both stacks survive between lines.
+type REPL struct {
+	parserConfig  *fx.ParserConfig
+	runtimeConfig *vm.RuntimeConfig
+	out           io.Writer
+
+	parser *fx.Parser
+	script *fx.Script
+	memory *memory
+	frame  *vm.Frame
+
+	// pending collects the lines of an unfinished macro, conditional or continued line
+	pending []string
+	depth   int
+}
+
+func New(parserConfig *fx.ParserConfig, runtimeConfig *vm.RuntimeConfig, out io.Writer) *REPL {
+	r := &REPL{
+		parserConfig:  parserConfig,
+		runtimeConfig: runtimeConfig,
+		out:           out,
+	}
+
+	r.Reset()
+
+	return r
+}
+
+// Reset discards the script, the memory and both stacks.
+func (r *REPL) Reset() {
+	r.parser = fx.NewParser(fx.NewLexer(nil, filename), r.parserConfig)
+
+	// an empty source can not fail to parse
+	r.script, _ = r.parser.Parse()
+
+	r.memory = &memory{
+		values: make(map[fx.Identifier]int),
+		out:    r.out,
+	}
+
+	r.frame = vm.NewRuntime(r.script, r.runtimeConfig).NewFrame(0, r.memory)
+
+	r.pending = nil
+	r.depth = 0
+}
+
+func (r *REPL) printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(r.out, format, a...)
+}
+
+// Pending reports whether the repl waits for more lines to complete the input.
+func (r *REPL) Pending() bool {
+	return len(r.pending) > 0
+}
+
+// blockDepth returns by how much a line opens or closes macros and conditionals.
+func blockDepth(line string) (depth int) {
+	l := fx.NewLexer([]byte(line), filename)
+
+	for {
+		tok, err := l.NextToken()
+
+		if err != nil || tok.Type == fx.EOF {
+			return
+		}
+
+		switch tok.Type {
+		case fx.MACRO, fx.NAMESPACE, fx.STRUCT, fx.DATA:
+			depth++
+		case fx.ENDMACRO, fx.ENDNAMESPACE, fx.ENDSTRUCT, fx.ENDDATA:
+			depth--
+		case fx.PREPROCESSOR:
+			name, _, _ := strings.Cut(tok.Value, " ")
+
+			switch name {
+			case "if", "ifdef", "ifndef":
+				depth++
+			case "endif":
+				depth--
+			}
+		}
+	}
+}
+
+// isExpression reports whether src is an expression rather than a statement.
+func (r *REPL) isExpression(src string) bool {
+	l := fx.NewLexer([]byte(src), filename)
+
+	var tokens []*fx.Token
+
+	for len(tokens) < 3 {
+		tok, err := l.NextToken()
+
+		if err != nil {
+			return false
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	switch tokens[0].Type {
+	case fx.IDENT:
+		if _, ok := r.parserConfig.CommandTypes[tokens[0].Value]; ok {
+			return false
+		}
+
+		if _, ok := r.script.Macro(tokens[0].Value); ok {
+			return false
+		}
+
+		return tokens[1].Type != fx.COLON
+	case fx.PERCENT:
+		return tokens[1].Type != fx.IDENT || tokens[2].Type != fx.COLON
+	case fx.NUMBER, fx.STRING, fx.LPAREN, fx.ADD, fx.SUB, fx.EXCL, fx.INV, fx.DOLLAR:
+		return true
+	}
+
+	return false
+}
+
+// Line handles one line of input and reports whether the repl should quit.
+func (r *REPL) Line(line string) (quit bool) {
+	if len(r.pending) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+		return r.command(strings.TrimSpace(line))
+	}
+
+	r.pending = append(r.pending, line)
+	r.depth += blockDepth(line)
+
+	if r.depth > 0 || strings.HasSuffix(strings.TrimRight(line, " \t"), "\\") {
+		return
+	}
+
+	src := strings.Join(r.pending, "\n")
+
+	r.pending = nil
+	r.depth = 0
+
+	if strings.TrimSpace(src) == "" {
+		return
+	}
+
+	if r.isExpression(src) {
+		r.eval(src)
+	} else {
+		r.exec(src)
+	}
+
+	return
+}
+
+func (r *REPL) eval(src string) {
+	expr, err := r.parser.FeedExpression(r.script, []byte(src), filename)
+
+	if err != nil {
+		_ = fx.RenderDiagnostics(r.out, err, nil)
+		return
+	}
+
+	v, err := r.frame.Eval(expr)
+
+	if err != nil {
+		_ = fx.RenderDiagnostics(r.out, err, nil)
+		return
+	}
+
+	r.printf("%v (%T)\n", v, v)
+}
+
+// exec parses src and runs the commands it added.
+func (r *REPL) exec(src string) {
+	pc := r.script.PC()
+	space := r.script.VariableSpace()
+
+	if err := r.parser.Feed(r.script, []byte(src), filename); err != nil {
+		_ = fx.RenderDiagnostics(r.out, err, nil)
+		return
+	}
+
+	// only the vars declared by src get their initial values, the others keep theirs
+	for addr, v := range r.script.InitialValues() {
+		if addr >= fx.VariableOffset+space {
+			r.memory.Set(fx.Identifier(addr), v)
+		}
+	}
+
+	r.frame.SetPC(pc)
+	r.frame.Run()
+}
+
+func (r *REPL) command(line string) (quit bool) {
+	switch line {
+	case ":labels":
+		labels := r.script.Labels()
+
+		for _, name := range slices.Sorted(maps.Keys(labels)) {
+			r.printf("%-24s %d\n", name, labels[name])
+		}
+	case ":vars":
+		for _, v := range r.variables() {
+			r.printf("%-24s %d = %d\n", v.name, v.addr, r.memory.values[fx.Identifier(v.addr)])
+		}
+	case ":mem":
+		names := make(map[fx.Identifier]string)
+
+		for name, identifier := range r.parserConfig.Identifiers {
+			names[identifier] = name
+		}
+
+		for _, v := range r.variables() {
+			names[fx.Identifier(v.addr)] = v.name
+		}
+
+		for _, identifier := range slices.Sorted(maps.Keys(r.memory.values)) {
+			name, ok := names[identifier]
+
+			if !ok {
+				name = fmt.Sprintf("[%d]", identifier)
+			}
+
+			r.printf("%-24s %d\n", name, r.memory.values[identifier])
+		}
+	case ":stack":
+		r.printf("call:    %v\n", r.frame.CallStack())
+		r.printf("operand: %v\n", r.frame.OperandStack())
+	case ":reset":
+		r.Reset()
+	case ":help":
+		r.printf("%s", help)
+	case ":quit", ":q":
+		return true
+	default:
+		r.printf("unknown command '%s', try :help\n", line)
+	}
+
+	return
+}
+
+type variable struct {
+	name string
+	addr int
+}
+
+// variables returns all vars ordered by address. Array elements are named like in the source.
+func (r *REPL) variables() (vars []*variable) {
+	for name, addr := range r.script.Variables() {
+		vars = append(vars, &variable{name, addr})
+
+		for i := 1; i < r.script.VariableSize(name); i++ {
+			vars = append(vars, &variable{fmt.Sprintf("%s[%d]", name, i), addr + i})
+		}
+	}
+
+	slices.SortFunc(vars, func(a, b *variable) int {
+		return a.addr - b.addr
+	})
+
+	return
+}
+
+// Run reads lines from in until it ends or :quit is entered.
+func (r *REPL) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+
+	for {
+		if r.Pending() {
+			r.printf("%s", ContinuationPrompt)
+		} else {
+			r.printf("%s", Prompt)
+		}
+
+		if !scanner.Scan() {
+			r.printf("\n")
+			return scanner.Err()
+		}
+
+		if r.Line(scanner.Text()) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nitwhiz/fxscript/vm"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestREPL() (*REPL, *strings.Builder) {
+	out := &strings.Builder{}
+	runtimeConfig := &vm.RuntimeConfig{}
+
+	return New(runtimeConfig.ParserConfig(nil, nil), runtimeConfig, out), out
+}
+
+func TestREPL(t *testing.T) {
+	r, out := newTestREPL()
+
+	for _, line := range []string{
+		"var a",
+		"var list[3]",
+		"def step 2",
+		"macro inc $v",
+		"  set $v, $v + step",
+		"endmacro",
+		"inc a",
+		"inc a",
+		"set list[1], a * 10",
+		"a",
+		"a / 3",
+		"a / 3.0",
+		":vars",
+	} {
+		require.False(t, r.Line(line))
+	}
+
+	require.Equal(t, "4 (int)\n1 (int)\n1.3333333333333333 (float64)\n"+
+		"a                        16777216 = 4\n"+
+		"list                     16777217 = 0\n"+
+		"list[1]                  16777218 = 40\n"+
+		"list[2]                  16777219 = 0\n", out.String())
+}
+
+func TestREPL_Stacks(t *testing.T) {
+	r, out := newTestREPL()
+
+	for _, line := range []string{
+		"var x",
+		"fn:",
+		"  push 7",
+		"  ret",
+		"push 1",
+		"call fn",
+		":stack",
+		"pop x",
+		":stack",
+		"x",
+		":labels",
+	} {
+		r.Line(line)
+	}
+
+	// the body of fn already ran once when it was entered
+	require.Equal(t, "call:    []\noperand: [7 1 7]\n"+
+		"call:    []\noperand: [7 1]\n"+
+		"7 (int)\n"+
+		"fn                       0\n", out.String())
+}
+
+func TestREPL_Errors(t *testing.T) {
+	r, out := newTestREPL()
+
+	r.Line("goto nowhere")
+	require.Contains(t, out.String(), "nowhere")
+	require.Empty(t, r.script.Commands())
+
+	out.Reset()
+
+	r.Line("var a")
+	r.Line("set a, 3")
+	r.Line(":reset")
+	r.Line(":vars")
+	require.True(t, r.Line(":quit"))
+	require.Empty(t, out.String())
+}
+
+func TestREPL_Initializers(t *testing.T) {
+	r, out := newTestREPL()
+
+	for _, line := range []string{
+		"var hp = 10",
+		"set hp, hp + 1",
+		"var list[2] = {5, 6}",
+		"data primes",
+		"  2, 3",
+		"enddata",
+		"hp + list[1] + primes[1]",
+		"set primes[0], 1",
+		"primes[0]",
+	} {
+		require.False(t, r.Line(line))
+	}
+
+	require.Equal(t, "20 (int)\n"+
+		"repl:1:1: error: 'primes' is read-only\n"+
+		"2 (int)\n", out.String())
+}
+
+func TestREPL_FailedFeed(t *testing.T) {
+	r, out := newTestREPL()
+
+	for _, line := range []string{
+		"var a",
+		"namespace ui",
+		"  var count",
+		"  def W 3",
+		"  macro show",
+		"  endmacro",
+		"  goto nowhere",
+		"endnamespace",
+	} {
+		require.False(t, r.Line(line))
+	}
+
+	require.Contains(t, out.String(), "nowhere")
+	require.Equal(t, 1, r.script.VariableSpace())
+
+	out.Reset()
+
+	// the names of the failed input can be declared again
+	for _, line := range []string{
+		"namespace ui",
+		"  var count",
+		"  def W 3",
+		"  macro show",
+		"  endmacro",
+		"endnamespace",
+		"ui.W",
+		":vars",
+	} {
+		require.False(t, r.Line(line))
+	}
+
+	require.Equal(t, "3 (int)\n"+
+		"a                        16777216 = 0\n"+
+		"ui.count                 16777217 = 0\n", out.String())
+}
@@ -2,32 +2,28 @@ package test
 
 import (
 	"bytes"
+	"fmt"
 	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
-	"reflect"
 	"runtime"
 	"slices"
-	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/nitwhiz/fxscript/fx"
+	"github.com/nitwhiz/fxscript/fxtest"
 	"github.com/nitwhiz/fxscript/vm"
 	"github.com/stretchr/testify/require"
 )
 
-const (
-	testFileExt = "fxt"
-)
-
 const (
 	identA = iota
 )
 
 const (
-	cmdEval = fx.UserCommandOffset + iota
+	cmdEval = fxtest.EvalCommandType + iota
 	cmdBreakpoint
 )
 
@@ -42,184 +38,139 @@ func init() {
 	commandNames[cmdBreakpoint] = "break"
 }
 
-type TestEnv struct {
-	t testing.TB
-
-	memory  map[fx.Identifier]int
-	results []any
-}
-
-func NewTestEnv(t testing.TB) *TestEnv {
-	return &TestEnv{
-		t: t,
-
-		memory:  make(map[fx.Identifier]int),
-		results: make([]any, 0),
-	}
-}
-
-func (env *TestEnv) Get(identifier fx.Identifier) (value int) {
-	return env.memory[identifier]
-}
-
-func (env *TestEnv) Set(identifier fx.Identifier, value int) {
-	env.memory[identifier] = value
-}
-
-func (env *TestEnv) HandleError(err error) {
-	env.t.Fatal(err)
-}
-
-func (env *TestEnv) handleEval(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
-	values := make([]any, len(args))
-
-	var err error
-
-	for i, arg := range args {
-		if values[i], err = f.Eval(arg); err != nil {
-			env.HandleError(err)
-		}
-	}
-
-	env.results = append(env.results, values...)
-
-	return
-}
-
-func (env *TestEnv) handleBreak(f *vm.Frame, args []fx.ExpressionNode) (jumpTarget int, jump bool) {
+func handleBreak(*vm.Frame, []fx.ExpressionNode) (jumpTarget int, jump bool) {
 	runtime.Breakpoint()
 	return
 }
 
 func TestIntegration(t *testing.T) {
-	testScripts, err := filepath.Glob("scripts/*." + testFileExt)
+	testScripts, err := filepath.Glob("scripts/*." + fxtest.Extension)
 
 	require.NoError(t, err)
 
 	slices.Sort(testScripts)
 
-	identifiers := fx.IdentifierTable{
-		"A": identA,
+	cfg := &fxtest.Config{
+		Commands: []*vm.Command{
+			{Name: "break", Type: cmdBreakpoint, Handler: handleBreak},
+		},
+		Identifiers: fx.IdentifierTable{
+			"A": identA,
+		},
+		Symbols: fx.SymbolTable{
+			"BUILD_DEMO": 1,
+			"LEVEL":      3,
+		},
+		LookupFn: func(v string) ([]byte, error) {
+			return []byte(v + " \"hello world!\""), nil
+		},
+		FS: os.DirFS("scripts/"),
+		Hooks: &vm.Hooks{
+			PreExecute: func(cmd *fx.CommandNode) {
+				slog.Info("EXEC", slog.String("name", commandNames[cmd.Type]), slog.String("cmd", cmd.String()))
+			},
+			PostUnmarshalArgs: func(args any) {
+				slog.Info("ARGS", slog.Any("args", args))
+			},
+		},
 	}
 
 	for _, scriptPath := range testScripts {
-		t.Run(strings.TrimSuffix(path.Base(scriptPath), "."+testFileExt), func(t *testing.T) {
-			data, err := os.ReadFile(scriptPath)
+		t.Run(strings.TrimSuffix(path.Base(scriptPath), "."+fxtest.Extension), func(t *testing.T) {
+			c, err := fxtest.ReadFile(scriptPath)
 
 			require.NoError(t, err)
+			require.True(t, c.HasSection(fxtest.SectionExpect), "does the script have an EXPECT section?")
 
-			segments := bytes.Split(data, []byte("--- EXPECT ---\n"))
-
-			require.Len(t, segments, 2, "does the script have an EXPECT section?")
-
-			e := NewTestEnv(t)
-
-			rtCfg := &vm.RuntimeConfig{
-				UserCommands: []*vm.Command{
-					{"eval", cmdEval, e.handleEval},
-					{"break", cmdBreakpoint, e.handleBreak},
-				},
-				Identifiers: identifiers,
-				Hooks: &vm.Hooks{
-					PreExecute: func(cmd *fx.CommandNode) {
-						slog.Info("EXEC", slog.String("name", commandNames[cmd.Type]), slog.String("cmd", cmd.String()))
-					},
-					PostUnmarshalArgs: func(args any) {
-						slog.Info("ARGS", slog.Any("args", args))
-					},
-				},
-			}
-
-			parserConfig := rtCfg.ParserConfig(
-				fx.NewParserFS(os.DirFS("scripts/")),
-				func(v string) ([]byte, error) {
-					return []byte(v + " \"hello world!\""), nil
-				},
-			)
-
-			fxs, err := fx.LoadScript(segments[0], path.Base(scriptPath), parserConfig)
+			res := fxtest.Run(t, c, cfg)
 
-			require.NoError(t, err)
+			requireFormatPreservesScript(t, res.Script, c.Script, c.Filename, res.ParserConfig)
+			requirePrintPreservesScript(t, res.Script, res.ParserConfig)
+			requireEncodingPreservesScript(t, res.Script, res.ParserConfig)
+		})
+	}
+}
 
-			rt := vm.NewRuntime(fxs, rtCfg)
-			rt.Start(0, e)
+func commandSignatures(script *fx.Script) []string {
+	signatures := make([]string, len(script.Commands()))
 
-			expectLines := bytes.Split(segments[1], []byte("\n"))
+	for i, cmd := range script.Commands() {
+		signatures[i] = fmt.Sprintf("%02d %v", cmd.Type, cmd.Args)
+	}
 
-			if len(expectLines) <= 1 {
-				t.Skip("no EXPECT lines found")
-			}
+	return signatures
+}
 
-			expectLines = expectLines[:len(expectLines)-1]
+func requireFormatPreservesScript(t *testing.T, fxs *fx.Script, src []byte, filename string, parserConfig *fx.ParserConfig) {
+	t.Helper()
 
-			rPtr := 0
-			expectLineOffset := len(bytes.Split(segments[0], []byte("\n")))
+	formatted, err := fx.Format(src, filename, parserConfig)
 
-			for l, expectLine := range expectLines {
-				if len(expectLine) == 0 {
-					continue
-				}
+	require.NoError(t, err)
 
-				firstChar := expectLine[0]
+	reformatted, err := fx.Format(formatted, filename, parserConfig)
 
-				if firstChar == '#' {
-					continue
-				}
+	require.NoError(t, err)
+	require.Equal(t, string(formatted), string(reformatted), "formatting is not idempotent")
 
-				if len(e.results) <= rPtr {
-					t.Fatal("unexpected end of results")
-				}
+	formattedScript, err := fx.LoadScript(formatted, filename, parserConfig)
 
-				value := e.results[rPtr]
+	require.NoError(t, err)
+	require.Equal(t, commandSignatures(fxs), commandSignatures(formattedScript))
+	require.Equal(t, fxs.Labels(), formattedScript.Labels())
+	require.Equal(t, fxs.Variables(), formattedScript.Variables())
+	require.Equal(t, fxs.InitialValues(), formattedScript.InitialValues())
+}
 
-				currentLineInFile := expectLineOffset + l + 1
+func requirePrintPreservesScript(t *testing.T, fxs *fx.Script, parserConfig *fx.ParserConfig) {
+	t.Helper()
 
-				switch firstChar {
-				case '"':
-					t.Log(value)
+	printer := &fx.Printer{Commands: parserConfig.CommandTypes, Identifiers: parserConfig.Identifiers}
 
-					require.IsType(t, "", value, "result expected to be a string at EXPECT line "+scriptPath+":"+strconv.Itoa(currentLineInFile))
+	var src bytes.Buffer
 
-					expectedString := string(expectLine[1 : len(expectLine)-1])
+	require.NoError(t, printer.Fprint(&src, fxs))
 
-					require.EqualValues(t, expectedString, value, "value mismatch at EXPECT line "+scriptPath+":"+strconv.Itoa(currentLineInFile))
-				default:
-					if bytes.Contains(expectLine, []byte(".")) {
-						t.Log(value)
+	printedScript, err := fx.LoadScript(src.Bytes(), "printed.fx", parserConfig)
 
-						valueKind := reflect.ValueOf(value).Kind()
+	require.NoError(t, err, src.String())
+	require.Equal(t, commandSignatures(fxs), commandSignatures(printedScript), src.String())
+	require.Equal(t, fxs.Variables(), printedScript.Variables())
+	require.Equal(t, fxs.InitialValues(), printedScript.InitialValues())
+}
 
-						if valueKind != reflect.Float64 {
-							t.Fatal("result is expected to be a float64 at EXPECT line " + scriptPath + ":" + strconv.Itoa(currentLineInFile))
-						}
+func requireEncodingPreservesScript(t *testing.T, fxs *fx.Script, parserConfig *fx.ParserConfig) {
+	t.Helper()
 
-						expectedFloat, err := strconv.ParseFloat(string(expectLine), 64)
+	data, err := fxs.MarshalBinary()
 
-						require.NoError(t, err, "unable to parse float64 at EXPECT line "+scriptPath+":"+strconv.Itoa(currentLineInFile))
-						require.EqualValues(t, expectedFloat, value, "value mismatch at EXPECT line "+scriptPath+":"+strconv.Itoa(currentLineInFile))
-					} else {
-						t.Log(value)
+	require.NoError(t, err)
 
-						valueKind := reflect.ValueOf(value).Kind()
+	decoded, err := fx.DecodeScript(data, parserConfig)
 
-						if valueKind != reflect.Int {
-							t.Fatal("result is expected to be an int at EXPECT line " + scriptPath + ":" + strconv.Itoa(currentLineInFile))
-						}
+	require.NoError(t, err)
+	require.Equal(t, fxs.Commands(), decoded.Commands())
+	require.Equal(t, fxs.Labels(), decoded.Labels())
+	require.Equal(t, fxs.Variables(), decoded.Variables())
+	require.Equal(t, fxs.Defines(), decoded.Defines())
+	require.Equal(t, fxs.InitialValues(), decoded.InitialValues())
+	require.Equal(t, fxs.Structs(), decoded.Structs())
+
+	for name := range fxs.Variables() {
+		dimensions, layout, ok := fxs.VariableShape(name)
+		decodedDimensions, decodedLayout, decodedOk := decoded.VariableShape(name)
+
+		require.Equal(t, ok, decodedOk, name)
+		require.Equal(t, dimensions, decodedDimensions, name)
+		require.Equal(t, layout, decodedLayout, name)
+	}
 
-						expectedInt, err := strconv.ParseInt(string(expectLine), 10, 64)
+	var buf bytes.Buffer
 
-						require.NoError(t, err, "unable to parse int64 at EXPECT line "+scriptPath+":"+strconv.Itoa(currentLineInFile))
-						require.EqualValues(t, int(expectedInt), value, "value mismatch at EXPECT line "+scriptPath+":"+strconv.Itoa(currentLineInFile))
-					}
-				}
+	require.NoError(t, fx.EncodeScript(&buf, fxs, nil))
 
-				rPtr++
-			}
+	decoded, err = fx.DecodeScript(buf.Bytes(), parserConfig)
 
-			if rPtr < len(e.results) {
-				missingChecks := len(e.results) - rPtr
-				t.Fatal("not all results were checked: missing " + strconv.Itoa(missingChecks) + " EXPECT line(s)")
-			}
-		})
-	}
+	require.NoError(t, err)
+	require.Equal(t, commandSignatures(fxs), commandSignatures(decoded))
 }
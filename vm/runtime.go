@@ -1,6 +1,9 @@
 package vm
 
 import (
+	"maps"
+	"slices"
+
 	"github.com/nitwhiz/fxscript/fx"
 )
 
@@ -49,30 +52,33 @@ func NewRuntime(s *fx.Script, cfg *RuntimeConfig) *Runtime {
 }
 
 func (r *Runtime) NewFrame(pc int, env Environment) *Frame {
-	return &Frame{
-		Environment:  env,
+	f := &Frame{
 		Runtime:      r,
 		pc:           pc,
 		callStack:    make([]int, r.callStackSize),
 		operandStack: make([]int, r.operandStackSize),
 	}
-}
 
-// Start starts a new frame to run from a specific PC
-func (r *Runtime) Start(pc int, env Environment) {
-	f := r.NewFrame(pc, env)
+	f.Environment = &frameEnvironment{env, f}
 
-	commands := f.script.Commands()
+	return f
+}
 
-	for ; f.pc < len(commands); f.pc++ {
-		jumpTarget, jump, _ := f.ExecuteCommand(commands[f.pc])
+// InitMemory writes the initial values of the vars and data tables of the script to env. It is
+// called once before the script runs, read-only addresses are written as well.
+func (r *Runtime) InitMemory(env Environment) {
+	values := r.script.InitialValues()
 
-		if jump {
-			f.pc = jumpTarget - 1
-		}
+	for _, addr := range slices.Sorted(maps.Keys(values)) {
+		env.Set(fx.Identifier(addr), values[addr])
 	}
 }
 
+// Start starts a new frame to run from a specific PC
+func (r *Runtime) Start(pc int, env Environment) {
+	r.NewFrame(pc, env).Run()
+}
+
 func (r *Runtime) Label(name string) (pc int, ok bool) {
 	return r.script.Label(name)
 }
@@ -91,5 +97,5 @@ func (r *Runtime) Script() *fx.Script {
 }
 
 func (r *Runtime) MemorySize() int {
-	return len(r.script.Variables())
+	return r.script.VariableSpace()
 }
@@ -1,17 +1,34 @@
 package vm
 
 import (
+	"fmt"
+
 	"github.com/nitwhiz/fxscript/fx"
 )
 
 var _ Environment = (*Frame)(nil)
 
+// PanicError is a panic of a command handler. Frame.ExecuteCommand recovers it and reports it as a
+// fx.RuntimeError at the position of the command.
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Frame runs a script with an Environment. Writes to data tables by commands and handlers are
+// reported to the Environment and skipped.
 type Frame struct {
 	Environment
 	*Runtime
 
 	pc int
 
+	// cmd is the command that is executed, errors of its writes are reported at its position
+	cmd *fx.CommandNode
+
 	callStackPointer int
 	callStack        []int
 
@@ -19,6 +36,40 @@ type Frame struct {
 	operandStack        []int
 }
 
+// frameEnvironment is the Environment of a frame. It guards the data tables of the script, so
+// handlers that call Frame.Set can't write them either.
+type frameEnvironment struct {
+	Environment
+	frame *Frame
+}
+
+func (e *frameEnvironment) Set(identifier fx.Identifier, value int) {
+	f := e.frame
+
+	if f.script.IsReadOnly(int(identifier)) {
+		name, _ := f.script.VariableName(int(identifier))
+
+		f.runtimeError(&fx.ReadOnlyError{Variable: name})
+
+		return
+	}
+
+	e.Environment.Set(identifier, value)
+}
+
+// runtimeError reports err at the position of the command that is executed.
+func (f *Frame) runtimeError(err error) (runtimeErr *fx.RuntimeError) {
+	runtimeErr = &fx.RuntimeError{Err: err}
+
+	if f.cmd != nil {
+		runtimeErr.SourceInfo = f.cmd.SourceInfo
+	}
+
+	f.HandleError(runtimeErr)
+
+	return
+}
+
 func (f *Frame) setValue(identifier fx.Identifier, value int) {
 	f.Environment.Set(identifier, value)
 }
@@ -27,9 +78,16 @@ func (f *Frame) getValue(identifier fx.Identifier) (value int) {
 	return f.Environment.Get(identifier)
 }
 
-func (f *Frame) pushCallStack(v int) {
+func (f *Frame) pushCallStack(v int) bool {
+	if f.callStackPointer == len(f.callStack) {
+		f.runtimeError(&fx.StackOverflowError{Stack: "call", Size: len(f.callStack)})
+		return false
+	}
+
 	f.callStack[f.callStackPointer] = v
 	f.callStackPointer++
+
+	return true
 }
 
 func (f *Frame) popCallStack() (int, bool) {
@@ -41,9 +99,16 @@ func (f *Frame) popCallStack() (int, bool) {
 	return f.callStack[f.callStackPointer], true
 }
 
-func (f *Frame) pushOperandStack(v int) {
+func (f *Frame) pushOperandStack(v int) bool {
+	if f.operandStackPointer == len(f.operandStack) {
+		f.runtimeError(&fx.StackOverflowError{Stack: "operand", Size: len(f.operandStack)})
+		return false
+	}
+
 	f.operandStack[f.operandStackPointer] = v
 	f.operandStackPointer++
+
+	return true
 }
 
 func (f *Frame) popOperandStack() (int, bool) {
@@ -55,7 +120,56 @@ func (f *Frame) popOperandStack() (int, bool) {
 	return f.operandStack[f.operandStackPointer], true
 }
 
+// Run executes commands from the current pc until the frame runs past the last command. A panic of
+// a handler stops the frame at the end of the script. A frame can be run again after commands were
+// added to the script, e.g. by fx.Parser.Feed.
+func (f *Frame) Run() {
+	commands := f.script.Commands()
+
+	for ; f.pc < len(commands); f.pc++ {
+		jumpTarget, jump, err := f.ExecuteCommand(commands[f.pc])
+
+		if err != nil {
+			f.pc = len(commands)
+			return
+		}
+
+		if jump {
+			f.pc = jumpTarget - 1
+		}
+	}
+}
+
+func (f *Frame) PC() int {
+	return f.pc
+}
+
+func (f *Frame) SetPC(pc int) {
+	f.pc = pc
+}
+
+// CallStack returns the return addresses on the call stack, the innermost call last.
+func (f *Frame) CallStack() []int {
+	return f.callStack[:f.callStackPointer]
+}
+
+// OperandStack returns the values on the operand stack, the top of the stack last.
+func (f *Frame) OperandStack() []int {
+	return f.operandStack[:f.operandStackPointer]
+}
+
+// ExecuteCommand runs the handler of cmd. A panic of the handler is reported to the Environment as
+// a fx.RuntimeError wrapping a PanicError and returned.
 func (f *Frame) ExecuteCommand(cmd *fx.CommandNode) (pc int, jump bool, err error) {
+	f.cmd = cmd
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			pc, jump = 0, false
+			err = f.runtimeError(&PanicError{Value: rec})
+		}
+	}()
+
 	f.preExecute(cmd)
 
 	pc, jump = f.handlers[cmd.Type](f, cmd.Args)
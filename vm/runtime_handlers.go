@@ -61,7 +61,10 @@ func handleCall(f *Frame, cmdArgs []fx.ExpressionNode) (jumpTarget int, jump boo
 	}
 
 	return WithArgs(f, cmdArgs, func(f *Frame, args *Args) (jumpTarget int, jump bool) {
-		f.pushCallStack(f.pc + 1)
+		// a call that overflows the stack stops the frame
+		if !f.pushCallStack(f.pc + 1) {
+			return f.script.EndOfScript(), true
+		}
 
 		return args.Addr, true
 	})